@@ -6,7 +6,7 @@ package main
 
 // @title Swagger Convertation_service API
 // @version 1.0
-// @description Convertation_service for sources RU,TH
+// @description Convertation_service for sources RU,TH,KZ,RU_METALS
 // @host localhost:8080
 // @BasePath /
 // @produce json
@@ -15,6 +15,9 @@ package main
 // @externalDocs.description OpenAPI
 // @license.name  Apache 2.0
 // @license.url   http://www.apache.org/licenses/LICENSE-2.0.htm
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name X-Admin-Token
 import (
 	"context"
 	"errors"
@@ -27,12 +30,16 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
 
 const ver = "4"
 
+// Время на остановку сервера и на закрытие бд после сигнала
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	AppConfig := config.NewAppConfig()
 	//Инициализация сервера c контекстом. В контекст будет послан сигнал о выключении
@@ -54,11 +61,18 @@ func main() {
 		log.Println("Error in intializing. Stopping immediatly. Check logs")
 		os.Exit(1)
 	}
+	httpServer.Handler = APIHandler.Router
 	//Graceful shutdown
-	stop_db := make(chan bool, 1)
 	g, _ := errgroup.WithContext(mainCtx)
-	//Горутина для выключения
-	go APIHandler.StartUpdate(AppConfig, mainCtx)
+	//Горутина обновления источников. Ее завершения ждем до закрытия бд:
+	//лидер освобождает аренду запросом к бд уже после сигнала
+	g.Go(func() error {
+		err := APIHandler.StartUpdate(AppConfig, mainCtx)
+		if err != nil && mainCtx.Err() == nil {
+			log.Printf("Update stopped. Error: %s", err.Error())
+		}
+		return err
+	})
 	// Запуск сервера
 	go func() {
 		log.Println("Starting server")
@@ -75,25 +89,23 @@ func main() {
 		<-mainCtx.Done()
 		//Производим отключение с таймаутом
 		log.Printf("Gracefully stopping server")
-		shutdown_ctx, cancel := context.WithCancel(mainCtx)
+		//Контекст сигнала уже отменен, поэтому таймаут отсчитывается от нового контекста
+		shutdown_ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
 		httpServer.Shutdown(shutdown_ctx)
 		log.Printf("Server stopped")
-		// Посылаем сигнал к бд
-		stop_db <- true
 		return http.ErrServerClosed
 	})
-	// Сначала отключаем сервер потом подключения к бд
-	go func() error {
-		for {
-			for range stop_db {
-				log.Printf("Closing connect with DB")
-				return APIHandler.ExitConnectWithDb(mainCtx)
-			}
-		}
-	}()
-	if err := g.Wait(); err != nil {
-		log.Printf("Service stopped")
+	g.Wait()
+	// Сначала отключаем сервер и обновление, потом подключения к бд. Закрытие ждем до выхода из main:
+	// хранилище в памяти сохраняет DB_FILE только при закрытии
+	log.Printf("Closing connect with DB")
+	close_ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := APIHandler.ExitConnectWithDb(close_ctx); err != nil {
+		log.Printf("Cannot close connect with DB. Error: %s", err.Error())
+		return
 	}
+	log.Printf("Service stopped")
 
 }
@@ -0,0 +1,78 @@
+// Команда export выгружает снимки курсов всех источников из хранилища в файл JSON Lines.
+// Хранилище и источники задаются теми же переменными окружения, что и у сервиса.
+// Файл с расширением .gz или флаг -gzip сжимают выгрузку
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"io"
+	"log"
+	"main/config"
+	"main/internal/pkg/services/backup"
+	"main/internal/pkg/services/repo"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func main() {
+	out := flag.String("o", "", "output file, stdout if empty")
+	compress := flag.Bool("gzip", false, "compress output with gzip")
+	sources := flag.String("sources", "", "comma separated sources, all configured sources if empty")
+	flag.Parse()
+	logger := log.New(os.Stderr, "export ", log.LstdFlags)
+	if err := run(*out, *compress, *sources, logger); err != nil {
+		logger.Println("Export failed. Error: " + err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(out string, compress bool, sources string, logger *log.Logger) (err error) {
+	AppConfig := config.NewAppConfig()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	storage, err := repo.NewStorage(ctx, AppConfig)
+	if err != nil {
+		return err
+	}
+	defer storage.Database.Close(ctx)
+	list := AppConfig.Sources
+	if sources != "" {
+		list = strings.Split(sources, ",")
+	}
+	var w io.Writer = os.Stdout
+	if out != "" {
+		//Файл записывается рядом и переименовывается в конце, чтобы прерванная выгрузка не заменила прежнюю
+		f, err := os.Create(out + ".tmp")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		w = f
+	}
+	if compress || strings.HasSuffix(out, ".gz") {
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		w = gz
+	}
+	count, err := backup.Export(ctx, backup.Stores{Database: storage.Database, Policy: storage.Policy, Override: storage.Override}, list, w)
+	if err != nil {
+		return err
+	}
+	if gz, ok := w.(*gzip.Writer); ok {
+		if err = gz.Close(); err != nil {
+			return err
+		}
+	}
+	if out != "" {
+		if err = os.Rename(out+".tmp", out); err != nil {
+			return err
+		}
+	}
+	logger.Printf("Exported %d snapshots", count)
+	return nil
+}
@@ -0,0 +1,65 @@
+// Команда import загружает снимки курсов из файла JSON Lines, созданного командой export, в хранилище,
+// заданное теми же переменными окружения, что и у сервиса. Файл проверяется целиком до записи.
+// Снимки, которые уже есть в хранилище, пропускаются, поэтому повторная загрузка безопасна
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"main/config"
+	"main/internal/pkg/services/backup"
+	"main/internal/pkg/services/repo"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	in := flag.String("i", "", "input file, plain or gzip, stdin if empty")
+	check := flag.Bool("check", false, "validate file without writing")
+	flag.Parse()
+	logger := log.New(os.Stdout, "import ", log.LstdFlags)
+	if err := run(*in, *check, logger); err != nil {
+		logger.Println("Import failed. Error: " + err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(in string, check bool, logger *log.Logger) (err error) {
+	var r io.Reader = os.Stdin
+	if in != "" {
+		f, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if r, err = backup.NewReader(r); err != nil {
+		return err
+	}
+	recs, err := backup.Read(r)
+	if err != nil {
+		return err
+	}
+	logger.Printf("File is valid, %d records", len(recs))
+	if check {
+		return nil
+	}
+	AppConfig := config.NewAppConfig()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	storage, err := repo.NewStorage(ctx, AppConfig)
+	if err != nil {
+		return err
+	}
+	defer storage.Database.Close(ctx)
+	stored, skipped, err := backup.Import(ctx, backup.Stores{Database: storage.Database, Policy: storage.Policy, Override: storage.Override}, recs)
+	if err != nil {
+		return err
+	}
+	logger.Printf("Imported %d snapshots, %d already present", stored, skipped)
+	return nil
+}
@@ -0,0 +1,41 @@
+// Команда migrate переводит данные Redis на версию схемы ключей, с которой работает сервис.
+// Настройки подключения берутся из тех же переменных окружения, что и у сервиса. Повторный запуск безопасен.
+// С флагом -dry-run изменения только выводятся в лог
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"main/config"
+	"main/internal/pkg/services/repo/redisdb"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print changes without writing them")
+	flag.Parse()
+	logger := log.New(os.Stdout, "migrate ", log.LstdFlags)
+	AppConfig := config.NewAppConfig()
+	if AppConfig.DbBackend != config.DbRedis && AppConfig.DbBackend != "" {
+		logger.Println("Nothing to migrate: db backend " + AppConfig.DbBackend + " manages its schema itself")
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	client, err := redisdb.NewClient(AppConfig.DbUrl, AppConfig.Db)
+	if err != nil {
+		logger.Println("Wrong db settings provided. Error: " + err.Error())
+		os.Exit(1)
+	}
+	defer client.Close()
+	from, err := client.Migrate(ctx, AppConfig.DbAttempts, AppConfig.KnownSources(), *dryRun, logger)
+	if err != nil {
+		logger.Printf("Migration from schema version %d failed. Error: %s", from, err.Error())
+		stop()
+		client.Close()
+		os.Exit(1)
+	}
+}
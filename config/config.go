@@ -3,20 +3,35 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
+	"log"
+	"main/internal/pkg/domain"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Здесь находится вся нужная информация для корректной работы приложения
 type AppConfig struct {
-	//Ключи доступа к источникам
-	SourceKeys map[string]string
+	//Способы аутентификации и ключи доступа к источникам
+	SourceAuth map[string]AuthConfig
 	//Ссылки на источники
 	SourceLinks map[string]string
+	//Ссылки на ключевые ставки источников
+	PolicyLinks map[string]string
+	//Источники, описанные в файле SOURCES_FILE
+	SourceDefinitions []domain.SourceDefinition
+	//Хранилище: redis, memory или sqlite
+	DbBackend string
+	//Файл бд sqlite или файл, в который хранилище в памяти сохраняется при остановке и из которого загружается при запуске
+	DbFile string
 	//Ссылка на подключение к бд
 	DbUrl string
+	//Режим подключения к бд, TLS и учетные данные
+	Db DbConfig
 	//Максимальное количество переподключений к бд
 	DbAttempts int
 	//Коды источников
@@ -29,13 +44,151 @@ type AppConfig struct {
 	TimeoutUP int
 	//Время задержки запросов в источники
 	TimeoutREQ int
+	//Допустимое изменение курса между обновлениями в процентах
+	AnomalyThreshold float64
+	//Допустимое изменение курса по кодам валют, заменяет AnomalyThreshold
+	AnomalyThresholds map[string]float64
+	//Токены администраторов и их имена
+	AdminTokens map[string]string
+	//Срок одобрения предложений изменить курсы в часах
+	ProposalTTL int
+	//Перезапрашивать источник при поврежденной записи в бд
+	DbSelfHeal bool
+	//Обновлять источники только в реплике, получившей аренду лидерства
+	LeaderElection bool
+	//Срок аренды лидерства в секундах
+	LeaderTTL int
+	//Срок хранения курсов в кэше в секундах, 0 отключает кэш
+	CacheTTL int
+	//Запрашивать источник, если в бд нет запрошенной валюты
+	FetchOnDemand bool
+	//Ожидание запроса источника по требованию в секундах
+	FetchWait int
+	//Срок, на который валюта, отсутствующая в источнике, не запрашивается повторно, в секундах
+	FetchMissTTL int
+	//Наименьший интервал между запросами источника по требованию в секундах
+	FetchInterval int
+	//Количество хранимых снимков источника, 0 - хранить все
+	SnapshotKeep int
+	//Отвечать на ошибки прежним форматом: код 200 и поле code в теле
+	LegacyEnvelope bool
+}
+
+// Хранилища данных
+const (
+	DbRedis  = "redis"
+	DbMemory = "memory"
+	DbSQLite = "sqlite"
+)
+
+// Режимы подключения к бд
+const (
+	DbStandalone = "standalone"
+	DbSentinel   = "sentinel"
+	DbCluster    = "cluster"
+)
+
+// Настройки подключения к бд. Для standalone адрес, номер бд и учетные данные берутся из DB_URL,
+// явно заданные DB_USER и DB_PASSWORD их заменяют
+type DbConfig struct {
+	//Режим: standalone, sentinel, cluster
+	Mode string
+	//Адреса sentinel или узлов кластера host:port
+	Addrs []string
+	//Имя мастера в sentinel
+	MasterName string
+	//Пользователь и пароль ACL
+	Username string
+	Password string
+	//Учетные данные sentinel, если отличаются
+	SentinelUsername string
+	SentinelPassword string
+	//Номер бд (кроме cluster)
+	DB int
+	//Подключение по TLS
+	TLS bool
+	//Файл с корневыми сертификатами для проверки сервера
+	CAFile string
+	//Сертификат и ключ клиента
+	CertFile string
+	KeyFile  string
+	//Имя сервера в сертификате, если отличается от адреса
+	ServerName string
+	//Хэш-теги в ключах, чтобы ключи одного источника попадали в один слот кластера. Для cluster включены всегда
+	HashTags bool
+}
+
+// Настройки аутентификации в источнике
+type AuthConfig struct {
+	//Способ аутентификации: none, header, query, basic, oauth2
+	Type string
+	//Имя заголовка или параметра запроса для ключа
+	Param string
+	//Ключи доступа в порядке приоритета. Для basic и oauth2 в виде "логин:пароль" и "client_id:client_secret"
+	Keys []string
+	//Файл с ключами (по одному в строке). Перечитывается при изменении, что позволяет ротировать ключи без перезапуска
+	KeyFile string
+	//Ссылка на выдачу токена для oauth2
+	TokenURL string
+	//Область доступа токена oauth2
+	Scope string
+}
+
+// Коды встроенных источников
+var builtinSources = []string{"RU", "TH", "KZ", "RU_METALS"}
+
+// Коды всех источников сервиса: встроенные, описанные в SOURCES_FILE и включенные в SOURCES
+func (c *AppConfig) KnownSources() []string {
+	res := slices.Clone(builtinSources)
+	for _, d := range c.SourceDefinitions {
+		res = append(res, d.Code)
+	}
+	res = append(res, c.Sources...)
+	slices.Sort(res)
+	return slices.Compact(res)
+}
+
+// Значения по умолчанию для встроенных источников. Источники, которых нет в vals, получают значение def
+func builtin(def string, vals map[string]string) map[string]string {
+	res := make(map[string]string, len(builtinSources))
+	for _, k := range builtinSources {
+		if v, ok := vals[k]; ok {
+			res[k] = v
+		} else {
+			res[k] = def
+		}
+	}
+	return res
 }
 
 // Создание нового конфига. Достает данные из конфигурационного файла и использует методы getEnv* того же пакета
 func NewAppConfig() *AppConfig {
-	sourceKeys := getEnvWithPattern("SOURCE_KEY", map[string]string{"RU": "", "TH": ""})
-	sourceLinks := getEnvWithPattern("SOURCE_LINK", map[string]string{"RU": "", "TH": ""})
-	sourceUpdates := getEnvWithPattern("SOURCE_TIMES", map[string]string{"RU": "00:00:00", "TH": "18:00:00"})
+	//Источники, описанные в файле без кода на Go
+	definitions := loadSourceDefinitions(getEnv("SOURCES_FILE", ""))
+	defs := func(defaults map[string]string, val func(d domain.SourceDefinition) string) map[string]string {
+		for _, d := range definitions {
+			defaults[d.Code] = val(d)
+		}
+		return defaults
+	}
+	empty := func(domain.SourceDefinition) string { return "" }
+
+	sourceKeys := getEnvWithPattern("SOURCE_KEY", defs(builtin("", nil), empty))
+	sourceAuthTypes := getEnvWithPattern("SOURCE_AUTH", defs(builtin("none", map[string]string{"TH": "header"}),
+		func(domain.SourceDefinition) string { return "none" }))
+	sourceAuthParams := getEnvWithPattern("SOURCE_AUTH_PARAM", defs(builtin("", map[string]string{"TH": "X-IBM-Client-Id"}), empty))
+	sourceKeyFiles := getEnvWithPattern("SOURCE_KEY_FILE", defs(builtin("", nil), empty))
+	sourceTokenURLs := getEnvWithPattern("SOURCE_TOKEN_URL", defs(builtin("", nil), empty))
+	sourceScopes := getEnvWithPattern("SOURCE_SCOPE", defs(builtin("", nil), empty))
+	sourceLinks := getEnvWithPattern("SOURCE_LINK", defs(builtin("", nil),
+		func(d domain.SourceDefinition) string { return d.URL }))
+	sourceUpdates := getEnvWithPattern("SOURCE_TIMES", defs(builtin("00:00:00", map[string]string{"TH": "18:00:00", "KZ": "18:00:00"}),
+		func(d domain.SourceDefinition) string {
+			if d.UpdateTime == "" {
+				return "00:00:00"
+			}
+			return d.UpdateTime
+		}))
 
 	// Генерация списка источников
 	sources := make([]string, 0, len(sourceUpdates))
@@ -43,16 +196,62 @@ func NewAppConfig() *AppConfig {
 		sources = append(sources, k)
 	}
 
+	sourceAuth := make(map[string]AuthConfig, len(sourceAuthTypes))
+	for k, v := range sourceAuthTypes {
+		sourceAuth[k] = AuthConfig{
+			Type:     v,
+			Param:    sourceAuthParams[k],
+			Keys:     splitList(sourceKeys[k]),
+			KeyFile:  sourceKeyFiles[k],
+			TokenURL: sourceTokenURLs[k],
+			Scope:    sourceScopes[k],
+		}
+	}
+
 	return &AppConfig{
-		SourceKeys:    sourceKeys,
-		SourceLinks:   sourceLinks,
-		DbUrl:         getEnv("DB_URL", ""),
-		DbAttempts:    getEnvAsInt("DB_ATT", 5),
-		Sources:       sources,
-		Loc:           getEnvAsLoc("LOC", &time.Location{}),
-		SourceUpdates: sourceUpdates,
-		TimeoutUP:     getEnvAsInt("TIMEOUT_UP", 600),
-		TimeoutREQ:    getEnvAsInt("TIMEOUT_REQ", 20),
+		SourceDefinitions: definitions,
+		SourceAuth:        sourceAuth,
+		SourceLinks:       sourceLinks,
+		PolicyLinks:       getEnvWithPattern("POLICY_LINK", map[string]string{"RU": "", "TH": ""}),
+		DbBackend:         getEnv("DB_BACKEND", DbRedis),
+		DbFile:            getEnv("DB_FILE", ""),
+		DbUrl:             getEnv("DB_URL", ""),
+		DbAttempts:        getEnvAsInt("DB_ATT", 5),
+		Db: DbConfig{
+			Mode:             getEnv("DB_MODE", DbStandalone),
+			Addrs:            splitList(getEnv("DB_ADDRS", "")),
+			MasterName:       getEnv("DB_MASTER", ""),
+			Username:         getEnv("DB_USER", ""),
+			Password:         getEnv("DB_PASSWORD", ""),
+			SentinelUsername: getEnv("DB_SENTINEL_USER", ""),
+			SentinelPassword: getEnv("DB_SENTINEL_PASSWORD", ""),
+			DB:               getEnvAsInt("DB_NUMBER", 0),
+			TLS:              getEnvAsBool("DB_TLS", false),
+			CAFile:           getEnv("DB_TLS_CA", ""),
+			CertFile:         getEnv("DB_TLS_CERT", ""),
+			KeyFile:          getEnv("DB_TLS_KEY", ""),
+			ServerName:       getEnv("DB_TLS_SERVER_NAME", ""),
+			HashTags:         getEnvAsBool("DB_HASH_TAGS", false),
+		},
+		Sources:           sources,
+		Loc:               getEnvAsLoc("LOC", &time.Location{}),
+		SourceUpdates:     sourceUpdates,
+		TimeoutUP:         getEnvAsInt("TIMEOUT_UP", 600),
+		TimeoutREQ:        getEnvAsInt("TIMEOUT_REQ", 20),
+		AnomalyThreshold:  getEnvAsFloat("ANOMALY_THRESHOLD", 10),
+		AnomalyThresholds: getEnvAsFloatMap("ANOMALY_THRESHOLDS"),
+		AdminTokens:       getEnvAsTokens("ADMIN_TOKENS"),
+		ProposalTTL:       getEnvAsInt("PROPOSAL_TTL", 24),
+		DbSelfHeal:        getEnvAsBool("DB_SELF_HEAL", false),
+		LeaderElection:    getEnvAsBool("LEADER_ELECTION", false),
+		LeaderTTL:         getEnvAsInt("LEADER_TTL", 15),
+		CacheTTL:          getEnvAsInt("CACHE_TTL", 300),
+		FetchOnDemand:     getEnvAsBool("FETCH_ON_DEMAND", true),
+		FetchWait:         getEnvAsInt("FETCH_WAIT", 10),
+		FetchMissTTL:      getEnvAsInt("FETCH_MISS_TTL", 3600),
+		FetchInterval:     getEnvAsInt("FETCH_INTERVAL", 60),
+		SnapshotKeep:      getEnvAsInt("SNAPSHOT_KEEP", 500),
+		LegacyEnvelope:    getEnvAsBool("LEGACY_ENVELOPE", false),
 	}
 }
 
@@ -77,6 +276,34 @@ func getEnvWithPattern(key string, defaultVal map[string]string) map[string]stri
 	return val
 }
 
+// Чтение описаний источников из JSON-файла. Без файла возвращается пустой список.
+// Нечитаемый файл останавливает запуск, чтобы источники не пропадали незаметно
+func loadSourceDefinitions(path string) []domain.SourceDefinition {
+	definitions := make([]domain.SourceDefinition, 0)
+	if path == "" {
+		return definitions
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Cannot read sources file %s: %s", path, err.Error())
+	}
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		log.Fatalf("Cannot parse sources file %s: %s", path, err.Error())
+	}
+	return definitions
+}
+
+// Разбиение списка значений, записанных через запятую. Пустые значения пропускаются
+func splitList(val string) []string {
+	res := make([]string, 0)
+	for _, v := range strings.Split(val, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
 // Получение переменной в типе int по методу getEnv
 func getEnvAsInt(key string, defaultVal int) int {
 	valstr := getEnv(key, "")
@@ -86,6 +313,49 @@ func getEnvAsInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
+// Получение переменной в типе bool по методу getEnv
+func getEnvAsBool(key string, defaultVal bool) bool {
+	valstr := getEnv(key, "")
+	if val, err := strconv.ParseBool(valstr); err == nil {
+		return val
+	}
+	return defaultVal
+}
+
+// Получение переменной в типе float64 по методу getEnv
+func getEnvAsFloat(key string, defaultVal float64) float64 {
+	valstr := getEnv(key, "")
+	if val, err := strconv.ParseFloat(valstr, 64); err == nil {
+		return val
+	}
+	return defaultVal
+}
+
+// Получение списка вида "JPY:25,XAU:5" по методу getEnv. Неверные элементы пропускаются
+func getEnvAsFloatMap(key string) map[string]float64 {
+	res := make(map[string]float64)
+	for _, item := range splitList(getEnv(key, "")) {
+		k, v, _ := strings.Cut(item, ":")
+		if val, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			res[strings.TrimSpace(k)] = val
+		}
+	}
+	return res
+}
+
+// Получение токенов администраторов из списка вида "имя:токен,имя:токен" по методу getEnv.
+// Возвращает отображение токена в имя
+func getEnvAsTokens(key string) map[string]string {
+	res := make(map[string]string)
+	for _, item := range splitList(getEnv(key, "")) {
+		name, token, ok := strings.Cut(item, ":")
+		if ok && name != "" && token != "" {
+			res[strings.TrimSpace(token)] = strings.TrimSpace(name)
+		}
+	}
+	return res
+}
+
 // Получение переменной в типе time.Location по методу getEnv
 func getEnvAsLoc(key string, defaultVal *time.Location) *time.Location {
 	valstr := getEnv(key, "")
@@ -23,7 +23,7 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/convert": {
+        "/v1/sources/{source}/convert": {
             "get": {
                 "description": "Конвертация валют в зависимости от источника, требуется предоставление двух кодов валют, суммы конвертации, и курса обмена.",
                 "tags": [
@@ -43,28 +43,28 @@ const docTemplate = `{
                         "type": "string",
                         "description": "first",
                         "name": "first",
-                        "in": "path",
+                        "in": "query",
                         "required": true
                     },
                     {
                         "type": "string",
                         "description": "second",
                         "name": "second",
-                        "in": "path",
+                        "in": "query",
                         "required": true
                     },
                     {
                         "type": "string",
                         "description": "amount",
                         "name": "amount",
-                        "in": "path",
+                        "in": "query",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "exchange",
+                        "description": "buy or sell",
                         "name": "exchange",
-                        "in": "path",
+                        "in": "query",
                         "required": true
                     }
                 ],
@@ -90,27 +90,39 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/handler.Response"
+                            "$ref": "#/definitions/handler.Problem"
                         }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/handler.Response"
+                            "$ref": "#/definitions/handler.Problem"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed",
+                        "schema": {
+                            "$ref": "#/definitions/handler.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/handler.Response"
+                            "$ref": "#/definitions/handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.Problem"
                         }
                     }
                 }
             }
         },
-        "/getAll": {
+        "/v1/sources/{source}/rates": {
             "get": {
-                "description": "Получить все валюты из источника. Если источник не указан, берутся данные из источника по умолчанию (ЦБ РФ)",
+                "description": "Получить все валюты из источника. В прежнем пути '/getall' без источника берутся данные из источника по умолчанию (ЦБ РФ)",
                 "consumes": [
                     "application/json"
                 ],
@@ -156,19 +168,107 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/handler.Response"
+                            "$ref": "#/definitions/handler.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.Problem"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed",
+                        "schema": {
+                            "$ref": "#/definitions/handler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/sources/{source}/rates/{code}": {
+            "get": {
+                "description": "Курс одной валюты источника с учетом ручного курса. Валюта ищется так же, как в конвертации, в том числе в связанном источнике",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "GetAll"
+                ],
+                "summary": "Курс валюты",
+                "operationId": "rate",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "source",
+                        "name": "source",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "currency code",
+                        "name": "code",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/domain.CurrModel"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.Problem"
                         }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/handler.Response"
+                            "$ref": "#/definitions/handler.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/handler.Response"
+                            "$ref": "#/definitions/handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.Problem"
                         }
                     }
                 }
@@ -227,6 +327,35 @@ const docTemplate = `{
                 }
             }
         },
+        "handler.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Код ошибки",
+                    "type": "string"
+                },
+                "detail": {
+                    "description": "Описание ошибки для этого запроса",
+                    "type": "string"
+                },
+                "instance": {
+                    "description": "Путь запроса",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Код ответа HTTP",
+                    "type": "integer"
+                },
+                "title": {
+                    "description": "Краткое описание вида ошибки, не зависит от запроса",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Идентификатор вида ошибки, например /problems/unknown-source",
+                    "type": "string"
+                }
+            }
+        },
         "handler.Response": {
             "type": "object",
             "properties": {
@@ -239,9 +368,21 @@ const docTemplate = `{
                     "type": "array",
                     "items": {}
                 },
+                "error_code": {
+                    "description": "Код ошибки из каталога в режиме LEGACY_ENVELOPE, например INVALID_STATE",
+                    "type": "string"
+                },
                 "message": {
                     "description": "Сообщение для пользователя",
                     "type": "string"
+                },
+                "stale": {
+                    "description": "Бд недоступна, данные - последние прочитанные курсы",
+                    "type": "boolean"
+                },
+                "warning": {
+                    "description": "Код предупреждения из каталога ошибок, например STALE_DATA",
+                    "type": "string"
                 }
             }
         }
@@ -255,7 +396,7 @@ var SwaggerInfo = &swag.Spec{
 	BasePath:         "/",
 	Schemes:          []string{"http"},
 	Title:            "Swagger Convertation_service API",
-	Description:      "Convertation_service for sources RU,TH",
+	Description:      "Convertation_service for sources RU,TH,KZ,RU_METALS",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
 }
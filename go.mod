@@ -3,13 +3,23 @@ module main
 go 1.23.2
 
 require (
+	github.com/ncruces/go-sqlite3 v0.22.0
 	github.com/redis/go-redis/v9 v9.7.0
 	golang.org/x/net v0.35.0
 )
 
 require github.com/joho/godotenv v1.5.1
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require github.com/alicebob/miniredis/v2 v2.33.0
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/ncruces/julianday v1.0.0 // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
 
 require golang.org/x/sync v0.11.0 // direct
 
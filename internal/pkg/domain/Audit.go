@@ -0,0 +1,39 @@
+package domain
+
+import "context"
+
+// Запись журнала изменений курсов, внесенных вручную, и решений по предложениям
+type AuditEntry struct {
+	Time string `json:"time"`
+	//Кто внес изменение. Для изменений через предложение - автор предложения
+	Actor string `json:"actor"`
+	//Кто одобрил предложение и его идентификатор
+	ApprovedBy string `json:"approved_by,omitempty"`
+	Proposal   string `json:"proposal,omitempty"`
+	//Действие, например override_set, override_delete, override_expire, quarantine_release
+	Action string `json:"action"`
+	Source string `json:"source"`
+	Code   string `json:"code,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	//Состояние до и после изменения
+	Before *RateOverride `json:"before,omitempty"`
+	After  *RateOverride `json:"after,omitempty"`
+}
+
+// Сервис журнала изменений
+type AuditService interface {
+	// Добавление записи в журнал. Возвращает ненулевую ошибку при отключении от бд
+	AppendAudit(ctx context.Context, e AuditEntry) (err error)
+	// Получение последних limit записей, начиная с последней
+	GetAudit(ctx context.Context, limit int) (res []AuditEntry, err error)
+}
+
+// Хендлер журнала изменений
+type AuditHandler struct {
+	Service AuditService
+}
+
+// Создание хендлера журнала изменений. Нужна реализация интерфейса AuditService
+func NewAuditHandler(svc AuditService) *AuditHandler {
+	return &AuditHandler{Service: svc}
+}
@@ -16,6 +16,10 @@ type CurrModel struct {
 	RatioBuy string `redis:"RatioBuy" json:"ratio_buy"`
 	//Курс продажи
 	RatioSell string `redis:"RatioSell" json:"ratio_sell"`
+	//Ручной курс, отданный вместо сохраненного. В бд не хранится
+	Override *RateOverride `redis:"-" json:"override,omitempty"`
+	//Снимок, из которого получен курс
+	Snapshot string `redis:"-" json:"-"`
 }
 
 //Приведение к сущности валюты
@@ -32,14 +36,28 @@ func ToCurrModel(date string, source string, code string, name string, ratioBuy
 
 // Сервис бд
 type DatabaseService interface {
-	// Получение данных по источнику и коду валюты. Возвращает сущность валюты пакета domain
+	// Получение данных по источнику и коду валюты из действующего снимка. Возвращает сущность валюты пакета domain
 	// и ненулевую ошибку при отключении от бд
 	GetBySourceAndKey(ctx context.Context, source string, key string) (res CurrModel, err error)
-	// Получение данных по источнику. Возвращает сущности валюты пакета domain
+	// Получение данных по источнику из действующего снимка. Возвращает сущности валюты пакета domain
 	// и ненулевую ошибку при отключении от бд
 	GetAllBySource(ctx context.Context, source string) (res []CurrModel, err error)
-	// Запись приведенных данных к сущности пакета domain.Возврашает ненулевую ошибку при отключении от бд
-	Store(ctx context.Context, curr CurrModel) (err error)
+	// Запись снимка курсов источника и его активация одной транзакцией. Читатели видят либо прежний, либо новый снимок целиком.
+	// Возвращает ErrNotLeader, если токен ограждения снимка меньше последнего записанного для источника,
+	// и ненулевую ошибку при отключении от бд
+	StoreSnapshot(ctx context.Context, snap Snapshot, rates []CurrModel) (err error)
+	// Запись снимка курсов источника без активации, например при загрузке истории.
+	// Возврашает ненулевую ошибку при отключении от бд
+	AddSnapshot(ctx context.Context, snap Snapshot, rates []CurrModel) (err error)
+	// Активация ранее записанного снимка. Возвращает ненулевую ошибку, если снимка нет
+	ActivateSnapshot(ctx context.Context, source string, id string) (err error)
+	// Получение описаний снимков источника от новых к старым
+	GetSnapshots(ctx context.Context, source string) (res []Snapshot, err error)
+	// Получение курсов снимка. Если снимка нет, возвращается пустой список
+	GetSnapshotRates(ctx context.Context, source string, id string) (res []CurrModel, err error)
+	// Удаление старых снимков источника сверх keep последних. Действующий снимок не удаляется.
+	// Возвращает идентификаторы удаленных снимков
+	PruneSnapshots(ctx context.Context, source string, keep int) (removed []string, err error)
 	//Закрытие подключения к бд
 	Close(ctx context.Context) (err error)
 }
@@ -0,0 +1,63 @@
+package domain
+
+import "context"
+
+// Вид расхождения тела ответа с ожидаемой схемой
+type DriftKind string
+
+const (
+	// Поле, которого нет в схеме
+	DriftUnknownField DriftKind = "unknown_field"
+	// Нет обязательного поля
+	DriftMissingField DriftKind = "missing_field"
+	// Значение поля другого типа или формата
+	DriftChangedType DriftKind = "changed_type"
+	// Тело не удалось разобрать
+	DriftMalformed DriftKind = "malformed"
+)
+
+// Расхождение тела ответа со схемой
+type DriftIssue struct {
+	Kind DriftKind `json:"kind"`
+	//Путь к полю, например ValCurs/Valute/Value
+	Path string `json:"path"`
+	//Подробности
+	Detail string `json:"detail,omitempty"`
+}
+
+// Блокирует ли расхождение запись данных. Новые поля не мешают разбору и только попадают в отчет
+func (i DriftIssue) Blocking() bool {
+	return i.Kind != DriftUnknownField
+}
+
+// Отчет о расхождении тела ответа источника со схемой
+type DriftReport struct {
+	//Источник
+	Source string `json:"source"`
+	//Время получения тела ответа
+	Time string `json:"time"`
+	//Расхождения
+	Issues []DriftIssue `json:"issues"`
+	//Тело ответа отправлено в карантин и не записано в бд
+	Quarantined bool `json:"quarantined"`
+	//Тело ответа в карантине
+	Payload string `json:"payload,omitempty"`
+}
+
+// Сервис хранения отчетов о расхождении схем
+type DriftService interface {
+	// Запись отчета. Хранятся только последние отчеты источника. Возвращает ненулевую ошибку при отключении от бд
+	StoreDrift(ctx context.Context, report DriftReport) (err error)
+	// Получение отчетов источника, начиная с последнего. Возвращает ненулевую ошибку при отключении от бд
+	GetDrifts(ctx context.Context, source string) (res []DriftReport, err error)
+}
+
+// Хендлер хранилища отчетов о расхождении схем
+type DriftHandler struct {
+	Service DriftService
+}
+
+// Создание хендлера хранилища отчетов. Нужна реализация интерфейса DriftService
+func NewDriftHandler(svc DriftService) *DriftHandler {
+	return &DriftHandler{Service: svc}
+}
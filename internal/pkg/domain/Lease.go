@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Реплика не держит аренду лидерства, обновление не записывается в бд
+var ErrNotLeader = errors.New("replica is not the leader")
+
+// Сервис аренды лидерства. Источники обновляет только реплика, которая держит аренду.
+// Каждая новая аренда получает токен ограждения больше всех выданных ранее
+type LeaseService interface {
+	// Получение аренды на ttl или продление аренды holder. Возвращает токен ограждения,
+	// если аренда у holder, и 0, если аренду держит другая реплика
+	AcquireLease(ctx context.Context, holder string, ttl time.Duration) (token int64, err error)
+	// Проверка, что аренда с токеном token не истекла и не перешла к другой реплике
+	CheckLease(ctx context.Context, token int64) (valid bool, err error)
+	// Освобождение аренды, если ее держит holder
+	ReleaseLease(ctx context.Context, holder string) (err error)
+}
+
+// Хендлер аренды лидерства
+type LeaseHandler struct {
+	Service LeaseService
+}
+
+// Создание хендлера аренды лидерства. Нужна реализация интерфейса LeaseService
+func NewLeaseHandler(svc LeaseService) *LeaseHandler {
+	return &LeaseHandler{Service: svc}
+}
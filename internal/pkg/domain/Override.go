@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Ручной курс валюты источника. Отдается вместо сохраненного курса до удаления или истечения срока
+type RateOverride struct {
+	Source    string `json:"source"`
+	Code      string `json:"code"`
+	RatioBuy  string `json:"ratio_buy"`
+	RatioSell string `json:"ratio_sell"`
+	//Причина установки
+	Reason string `json:"reason"`
+	//Кто установил
+	Author string `json:"author"`
+	//Время установки
+	Created string `json:"created"`
+	//Время окончания действия (RFC 3339). Пустое значение - без срока
+	Expires string `json:"expires,omitempty"`
+}
+
+// Истек ли срок действия ручного курса к моменту t
+func (o RateOverride) Expired(t time.Time) bool {
+	if o.Expires == "" {
+		return false
+	}
+	exp, err := time.Parse(time.RFC3339, o.Expires)
+	return err == nil && !t.Before(exp)
+}
+
+// Сервис хранения ручных курсов
+type OverrideService interface {
+	// Запись или замена ручного курса. Возвращает ненулевую ошибку при отключении от бд
+	StoreOverride(ctx context.Context, o RateOverride) (err error)
+	// Удаление ручного курса
+	DeleteOverride(ctx context.Context, source string, code string) (err error)
+	// Получение ручного курса. Если курса нет, возвращается курс с пустым Code
+	GetOverride(ctx context.Context, source string, code string) (res RateOverride, err error)
+	// Получение ручных курсов источника
+	GetOverrides(ctx context.Context, source string) (res []RateOverride, err error)
+}
+
+// Хендлер хранилища ручных курсов
+type OverrideHandler struct {
+	Service OverrideService
+}
+
+// Создание хендлера хранилища ручных курсов. Нужна реализация интерфейса OverrideService
+func NewOverrideHandler(svc OverrideService) *OverrideHandler {
+	return &OverrideHandler{Service: svc}
+}
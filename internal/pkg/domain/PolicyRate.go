@@ -0,0 +1,32 @@
+package domain
+
+import "context"
+
+// Ключевая ставка центрального банка. Хранится отдельно от курсов валют
+type PolicyRate struct {
+	//Источник
+	Source string `json:"-"`
+	//Дата вступления ставки в силу
+	Date string `json:"date"`
+	//Ставка, % годовых
+	Rate string `json:"rate"`
+}
+
+// Сервис хранения ключевых ставок
+type PolicyRateService interface {
+	// Получение истории ставок источника, отсортированной по дате вступления в силу.
+	// Возвращает ненулевую ошибку при отключении от бд
+	GetPolicyRates(ctx context.Context, source string) (res []PolicyRate, err error)
+	// Замена истории ставок источника. Возвращает ненулевую ошибку при отключении от бд
+	StorePolicyRates(ctx context.Context, source string, rates []PolicyRate) (err error)
+}
+
+// Хендлер хранилища ключевых ставок
+type PolicyRateHandler struct {
+	Service PolicyRateService
+}
+
+// Создание хендлера хранилища ключевых ставок. Нужна реализация интерфейса PolicyRateService
+func NewPolicyRateHandler(svc PolicyRateService) *PolicyRateHandler {
+	return &PolicyRateHandler{Service: svc}
+}
@@ -0,0 +1,71 @@
+package domain
+
+import "context"
+
+// Вид предложенного изменения курсов
+type ProposalKind string
+
+const (
+	// Установка ручного курса
+	ProposalOverrideSet ProposalKind = "override_set"
+	// Удаление ручного курса
+	ProposalOverrideDelete ProposalKind = "override_delete"
+	// Запись снимка из карантина в бд
+	ProposalQuarantineRelease ProposalKind = "quarantine_release"
+	// Возврат к прежнему снимку курсов
+	ProposalRollback ProposalKind = "snapshot_rollback"
+)
+
+// Статусы предложения
+const (
+	ProposalPending  = "pending"
+	ProposalApproved = "approved"
+	ProposalRejected = "rejected"
+	ProposalExpired  = "expired"
+)
+
+// Предложение изменить курсы вручную. Применяется только после одобрения другим администратором
+type Proposal struct {
+	ID     string       `json:"id"`
+	Kind   ProposalKind `json:"kind"`
+	Source string       `json:"source"`
+	Code   string       `json:"code,omitempty"`
+	//Идентификатор снимка в карантине (quarantine_release) или снимка курсов (snapshot_rollback)
+	Target string `json:"target,omitempty"`
+	//Новый ручной курс (override_set)
+	Override *RateOverride `json:"override,omitempty"`
+	Reason   string        `json:"reason"`
+	//Кто и когда предложил
+	ProposedBy string `json:"proposed_by"`
+	Created    string `json:"created"`
+	//Время, после которого предложение нельзя одобрить
+	Expires string `json:"expires"`
+	//Статус: pending, approved, rejected, expired
+	Status string `json:"status"`
+	//Кто и когда принял решение
+	ResolvedBy string `json:"resolved_by,omitempty"`
+	ResolvedAt string `json:"resolved_at,omitempty"`
+}
+
+// Сервис хранения предложений
+type ProposalService interface {
+	// Запись или перезапись предложения. Возвращает ненулевую ошибку при отключении от бд
+	StoreProposal(ctx context.Context, p Proposal) (err error)
+	// Перезапись предложения, только если сохраненное предложение еще ожидает решения (pending).
+	// Возвращает false, если предложения нет или решение по нему уже принято, и ненулевую ошибку при отключении от бд
+	ResolveProposal(ctx context.Context, p Proposal) (resolved bool, err error)
+	// Получение предложения по идентификатору. Если предложения нет, возвращается предложение с пустым ID
+	GetProposal(ctx context.Context, id string) (res Proposal, err error)
+	// Получение всех предложений от новых к старым
+	GetProposals(ctx context.Context) (res []Proposal, err error)
+}
+
+// Хендлер хранилища предложений
+type ProposalHandler struct {
+	Service ProposalService
+}
+
+// Создание хендлера хранилища предложений. Нужна реализация интерфейса ProposalService
+func NewProposalHandler(svc ProposalService) *ProposalHandler {
+	return &ProposalHandler{Service: svc}
+}
@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"context"
+	"errors"
+)
+
+// Обновление источника отправлено в карантин и не записано в бд
+var ErrQuarantined = errors.New("update quarantined")
+
+// Вид аномалии курса
+type AnomalyKind string
+
+const (
+	// Изменение курса больше допустимого
+	AnomalyJump AnomalyKind = "jump"
+	// Нулевой или отрицательный курс
+	AnomalyNonPositive AnomalyKind = "non_positive"
+	// Курс покупки выше курса продажи
+	AnomalyInverted AnomalyKind = "inverted"
+	// Валюта пропала из источника
+	AnomalyVanished AnomalyKind = "vanished"
+	// В источнике появилась новая валюта
+	AnomalyAppeared AnomalyKind = "appeared"
+)
+
+// Аномалия курса валюты
+type AnomalyFlag struct {
+	Kind   AnomalyKind `json:"kind"`
+	Code   string      `json:"code"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+// Статусы снимка в карантине
+const (
+	QuarantinePending  = "pending"
+	QuarantineApproved = "approved"
+	QuarantineRejected = "rejected"
+)
+
+// Снимок курсов источника, отправленный в карантин. До решения администратора отдаются прежние курсы
+type QuarantinedSnapshot struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	//Время создания
+	Created string `json:"created"`
+	//Статус: pending, approved, rejected
+	Status string `json:"status"`
+	//Найденные аномалии
+	Flags []AnomalyFlag `json:"flags"`
+	//Курсы снимка и их хэш, см. RatesHash
+	Rates []CurrModel `json:"rates"`
+	Hash  string      `json:"hash,omitempty"`
+	//Кто и когда принял решение
+	ResolvedBy string `json:"resolved_by,omitempty"`
+	ResolvedAt string `json:"resolved_at,omitempty"`
+}
+
+// Сервис хранения снимков в карантине
+type QuarantineService interface {
+	// Запись или перезапись снимка. Возвращает ненулевую ошибку при отключении от бд
+	StoreQuarantine(ctx context.Context, q QuarantinedSnapshot) (err error)
+	// Получение снимка по идентификатору. Если снимка нет, возвращается снимок с пустым ID
+	GetQuarantine(ctx context.Context, id string) (res QuarantinedSnapshot, err error)
+	// Получение снимков источника (всех источников при пустом source) от новых к старым
+	GetAllQuarantine(ctx context.Context, source string) (res []QuarantinedSnapshot, err error)
+}
+
+// Хендлер хранилища снимков в карантине
+type QuarantineHandler struct {
+	Service QuarantineService
+}
+
+// Создание хендлера хранилища снимков в карантине. Нужна реализация интерфейса QuarantineService
+func NewQuarantineHandler(svc QuarantineService) *QuarantineHandler {
+	return &QuarantineHandler{Service: svc}
+}
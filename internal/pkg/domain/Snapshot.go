@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+)
+
+// Происхождение снимка курсов
+const (
+	// Обновление из источника
+	SnapshotFetch = "fetch"
+	// Снимок из карантина, записанный после одобрения
+	SnapshotQuarantine = "quarantine"
+	// Курсы, записанные до появления снимков и перенесенные командой migrate
+	SnapshotMigration = "migration"
+)
+
+// Снимок курсов источника. Каждое обновление записывается новым неизменяемым снимком,
+// который затем атомарно становится действующим. К любому прежнему снимку можно вернуться
+type Snapshot struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	//Время записи
+	Created string `json:"created"`
+	//Последняя дата курсов в снимке
+	Date string `json:"date"`
+	//Происхождение: fetch, quarantine, migration
+	Origin string `json:"origin"`
+	//Количество валют
+	Count int `json:"count"`
+	//Хэш курсов снимка, см. RatesHash
+	Hash string `json:"hash,omitempty"`
+	//Действующий ли снимок. В бд не хранится
+	Active bool `json:"active"`
+	//Токен ограждения лидера, записавшего снимок. Бд отклоняет запись с токеном меньше последнего
+	//записанного для источника ошибкой ErrNotLeader. 0 - без проверки. В ответах не выводится
+	Fence int64 `json:"-"`
+}
+
+// Хэш курсов независимо от их порядка. Снимки с одинаковым хэшем содержат одни и те же курсы
+func RatesHash(rates []CurrModel) string {
+	sorted := make([]CurrModel, len(rates))
+	copy(sorted, rates)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Code < sorted[j].Code })
+	sum := sha256.New()
+	for _, c := range sorted {
+		data, _ := json.Marshal(c)
+		sum.Write(data)
+		sum.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Класс ошибки внешнего источника. От класса зависит реакция планировщика обновлений
+type UpstreamErrClass string
+
+const (
+	// Ключ доступа неверен или отозван. Повторять запрос бессмысленно
+	UpstreamAuth UpstreamErrClass = "auth"
+	// Превышена квота запросов по ключу
+	UpstreamQuota UpstreamErrClass = "quota"
+	// Источник отверг параметры запроса
+	UpstreamBadRequest UpstreamErrClass = "bad_request"
+	// Источник на обслуживании или шлюз вернул ошибку 5xx
+	UpstreamMaintenance UpstreamErrClass = "maintenance"
+	// Тело ответа не удалось разобрать
+	UpstreamMalformed UpstreamErrClass = "malformed"
+	// Источник не ответил за отведенное время
+	UpstreamTimeout UpstreamErrClass = "timeout"
+)
+
+// Типизированная ошибка внешнего источника
+type UpstreamError struct {
+	//Источник
+	Source string
+	//Класс ошибки
+	Class UpstreamErrClass
+	//HTTP-статус ответа (0, если ответа не было)
+	Status int
+	//Сообщение источника
+	Message string
+	//Исходная ошибка
+	Err error
+}
+
+func (e *UpstreamError) Error() string {
+	msg := e.Message
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.Status != 0 {
+		return fmt.Sprintf("source %s: %s error (status %d): %s", e.Source, e.Class, e.Status, msg)
+	}
+	return fmt.Sprintf("source %s: %s error: %s", e.Source, e.Class, msg)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Виды ошибок хранилища. Проверяются через errors.Is
+var (
+	// Записи нет
+	ErrNotFound = errors.New("record not found")
+	// Запись повреждена и не может быть прочитана
+	ErrCorruptRecord = errors.New("corrupt record")
+	// Нет связи с бд
+	ErrConnLost = errors.New("db connection lost")
+	// Бд не ответила за отведенное время
+	ErrDBTimeout = errors.New("db timeout")
+)
+
+// Типизированная ошибка хранилища
+type RepoError struct {
+	//Вид ошибки: ErrNotFound, ErrCorruptRecord, ErrConnLost или ErrDBTimeout
+	Kind error
+	//Ключ записи
+	Key string
+	//Исходная ошибка
+	Err error
+}
+
+func (e *RepoError) Error() string {
+	msg := e.Kind.Error()
+	if e.Key != "" {
+		msg += " " + e.Key
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *RepoError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
@@ -32,3 +32,53 @@ type THsourceDTODataDetail struct {
 	BuyingTransfer  string `json:"buying_transfer"`
 	Selling         string `json:"selling"`
 }
+
+//XML-структура (RSS) для Национального банка Казахстана
+type KZsourceDTO struct {
+	XMLName xml.Name `xml:"rss"`
+	Item    []struct {
+		//Полное название валюты
+		FullName string `xml:"fullname"`
+		//Код валюты. В части лент передается в поле fc, в остальных в title
+		FC    string `xml:"fc"`
+		Title string `xml:"title"`
+		//Дата курса в формате dd.mm.yyyy
+		PubDate string `xml:"pubDate"`
+		//Курс за quant единиц валюты
+		Description string `xml:"description"`
+		Quant       string `xml:"quant"`
+	} `xml:"channel>item"`
+}
+
+//XML-структура учетных цен на драгоценные металлы ЦБ РФ
+type RUMetalsDTO struct {
+	XMLName xml.Name `xml:"Metall"`
+	Record  []struct {
+		//Дата в формате dd.mm.yyyy
+		Date string `xml:"Date,attr"`
+		//Код металла: 1 - золото, 2 - серебро, 3 - платина, 4 - палладий
+		Code string `xml:"Code,attr"`
+		//Цена за грамм в рублях
+		Buy  string `xml:"Buy"`
+		Sell string `xml:"Sell"`
+	} `xml:"Record"`
+}
+
+//XML-структура ключевой ставки ЦБ РФ (DailyInfo KeyRateXML)
+type RUPolicyDTO struct {
+	KR []struct {
+		//Дата в формате yyyy-mm-ddThh:mm:ss+hh:mm
+		DT   string `xml:"DT"`
+		Rate string `xml:"Rate"`
+	} `xml:"KR"`
+}
+
+//JSON-структура ставки политики ЦБ Тайланда
+type THPolicyDTO struct {
+	Result struct {
+		Data []struct {
+			Period     string `json:"period"`
+			PolicyRate string `json:"policy_rate"`
+		} `json:"data"`
+	} `json:"result"`
+}
@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Описание источника, заданного в конфигурации без кода на Go
+type SourceDefinition struct {
+	//Код источника (например, BY)
+	Code string `json:"code"`
+	//Шаблон ссылки. Поддерживаются подстановки {date}, {start} и {end} с необязательным форматом Go: {date:02.01.2006}
+	URL string `json:"url"`
+	//Формат тела ответа: JSON, XML или CSV
+	Format string `json:"format"`
+	//Дополнительные заголовки запроса
+	Headers map[string]string `json:"headers,omitempty"`
+	//Путь к списку записей: "data.rates" для JSON, "ValCurs/Valute" для XML. Для CSV не используется
+	Items string `json:"items,omitempty"`
+	//Селекторы полей записи
+	Fields SourceFields `json:"fields"`
+	//Код базовой валюты источника
+	Base string `json:"base"`
+	//Формат даты в теле ответа (в нотации Go). По умолчанию 2006-01-02
+	DateFormat string `json:"date_format,omitempty"`
+	//Десятичный разделитель. По умолчанию точка
+	DecimalSeparator string `json:"decimal_separator,omitempty"`
+	//Разделитель колонок CSV. По умолчанию запятая
+	CSVDelimiter string `json:"csv_delimiter,omitempty"`
+	//Время обновления в формате hh:mm:ss
+	UpdateTime string `json:"update_time,omitempty"`
+}
+
+// Селекторы полей записи. Для JSON - путь через точку, для XML - путь через "/" (атрибуты через "@"),
+// для CSV - название колонки. Путь, начинающийся с "/" (XML) или "$." (JSON), отсчитывается от корня документа
+type SourceFields struct {
+	Code    string `json:"code"`
+	Name    string `json:"name,omitempty"`
+	Nominal string `json:"nominal,omitempty"`
+	Buy     string `json:"buy"`
+	Sell    string `json:"sell,omitempty"`
+	Date    string `json:"date,omitempty"`
+}
+
+// Запись источника до нормализации
+type GenericRecord struct {
+	Date    string
+	Code    string
+	Name    string
+	Nominal string
+	Buy     string
+	Sell    string
+}
+
+var sourceCode = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+var currCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Код валюты в том виде, в котором его записывает парсер источника: без пробелов по краям.
+// Коды декларативных источников не ограничены тремя буквами
+func NormalizeCurrCode(code string) string {
+	return strings.TrimSpace(code)
+}
+
+// Проверка описания источника. Возвращает ошибку с указанием неверного поля
+func (d SourceDefinition) Validate() error {
+	if !sourceCode.MatchString(d.Code) {
+		return errors.New("wrong source code " + d.Code + ". use capital letters, digits and _")
+	}
+	if d.URL == "" {
+		return errors.New("no url provided for source " + d.Code)
+	}
+	switch strings.ToUpper(d.Format) {
+	case "JSON", "XML", "CSV":
+	default:
+		return errors.New("wrong format " + d.Format + " for source " + d.Code + ". use JSON, XML or CSV")
+	}
+	if d.Fields.Code == "" || d.Fields.Buy == "" {
+		return errors.New("fields code and buy are required for source " + d.Code)
+	}
+	if !currCode.MatchString(d.Base) {
+		return errors.New("wrong base currency " + d.Base + " for source " + d.Code)
+	}
+	if d.DecimalSeparator != "" && d.DecimalSeparator != "." && d.DecimalSeparator != "," {
+		return errors.New("wrong decimal separator for source " + d.Code)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"main/internal/pkg/domain"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Допустимое изменение курса валюты в процентах
+func (a *API) anomalyThreshold(code string) float64 {
+	if t, ok := a.anomalyThresholds[code]; ok {
+		return t
+	}
+	return a.defaultThreshold
+}
+
+func parseRatio(val string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(val, ",", ".", 1), 64)
+}
+
+// Сравнение нового снимка курсов источника с сохраненным. Проверяются изменение курса больше допустимого,
+// нулевые и отрицательные курсы, покупка выше продажи, пропавшие и новые валюты.
+// Пропавшие и новые валюты проверяются только при наличии сохраненного снимка
+func (a *API) detectAnomalies(prev []domain.CurrModel, next []domain.CurrModel) (flags []domain.AnomalyFlag) {
+	prevByCode := make(map[string]domain.CurrModel, len(prev))
+	for _, c := range prev {
+		prevByCode[c.Code] = c
+	}
+	nextByCode := make(map[string]domain.CurrModel, len(next))
+	for _, c := range next {
+		nextByCode[c.Code] = c
+	}
+	codes := make([]string, 0, len(nextByCode))
+	for code := range nextByCode {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		c := nextByCode[code]
+		buy, errBuy := parseRatio(c.RatioBuy)
+		sell, errSell := parseRatio(c.RatioSell)
+		if errBuy != nil || errSell != nil || buy <= 0 || sell <= 0 {
+			flags = append(flags, domain.AnomalyFlag{Kind: domain.AnomalyNonPositive, Code: code,
+				Detail: "buy " + c.RatioBuy + ", sell " + c.RatioSell})
+			continue
+		}
+		if buy > sell {
+			flags = append(flags, domain.AnomalyFlag{Kind: domain.AnomalyInverted, Code: code,
+				Detail: "buy " + c.RatioBuy + " > sell " + c.RatioSell})
+		}
+		old, ok := prevByCode[code]
+		if !ok {
+			if len(prev) != 0 {
+				flags = append(flags, domain.AnomalyFlag{Kind: domain.AnomalyAppeared, Code: code})
+			}
+			continue
+		}
+		oldBuy, err := parseRatio(old.RatioBuy)
+		if err != nil || oldBuy <= 0 {
+			continue
+		}
+		change := math.Abs(buy-oldBuy) / oldBuy * 100
+		if threshold := a.anomalyThreshold(code); change > threshold {
+			flags = append(flags, domain.AnomalyFlag{Kind: domain.AnomalyJump, Code: code,
+				Detail: fmt.Sprintf("%s -> %s (%.2f%% > %.2f%%)", old.RatioBuy, c.RatioBuy, change, threshold)})
+		}
+	}
+	prevCodes := make([]string, 0, len(prevByCode))
+	for code := range prevByCode {
+		prevCodes = append(prevCodes, code)
+	}
+	sort.Strings(prevCodes)
+	for _, code := range prevCodes {
+		if _, ok := nextByCode[code]; !ok {
+			flags = append(flags, domain.AnomalyFlag{Kind: domain.AnomalyVanished, Code: code})
+		}
+	}
+	return flags
+}
+
+// Отправка снимка курсов в карантин. Если такой же снимок уже ожидает решения или последним снимком источника
+// в карантине был отклонен такой же снимок, новый не создается, пока источник не опубликует другие курсы.
+// Возвращает ошибку domain.ErrQuarantined, данные в бд не записываются
+func (a *API) quarantine(source string, rates []domain.CurrModel, flags []domain.AnomalyFlag) error {
+	defaultMessage := "quarantine: "
+	all, err := a.QuarantineHandler.Service.GetAllQuarantine(a.mainCtx, source)
+	if err != nil {
+		logger.Println(defaultMessage + "Internal db error. Err:" + err.Error())
+		return err
+	}
+	hash := domain.RatesHash(rates)
+	id := ""
+	for i, q := range all {
+		//У снимков, записанных до появления хэша, он считается по курсам
+		if q.Hash == "" {
+			q.Hash = domain.RatesHash(q.Rates)
+		}
+		if q.Hash != hash {
+			continue
+		}
+		if q.Status == domain.QuarantinePending {
+			id = q.ID
+			break
+		}
+		if q.Status == domain.QuarantineRejected && i == 0 {
+			return fmt.Errorf("%w: source %s, same rates were rejected in snapshot %s", domain.ErrQuarantined, source, q.ID)
+		}
+	}
+	if id == "" {
+		q := domain.QuarantinedSnapshot{
+			ID:      newID(source),
+			Source:  source,
+			Created: time.Now().In(a.timeLoc).Format(time.DateTime),
+			Status:  domain.QuarantinePending,
+			Flags:   flags,
+			Rates:   rates,
+			Hash:    hash,
+		}
+		if err := a.QuarantineHandler.Service.StoreQuarantine(a.mainCtx, q); err != nil {
+			logger.Println(defaultMessage + "Cannot store quarantined snapshot. Error:" + err.Error())
+			return err
+		}
+		id = q.ID
+		logger.Printf("ALERT %sRates of source %s quarantined as %s: %d anomalies, first: %s %s %s",
+			defaultMessage, source, id, len(flags), flags[0].Kind, flags[0].Code, flags[0].Detail)
+	}
+	return fmt.Errorf("%w: source %s, snapshot %s awaits review", domain.ErrQuarantined, source, id)
+}
+
+// Идентификатор снимка или предложения: префикс, время и случайный суффикс
+func newID(prefix string) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return prefix + "-" + time.Now().Format("20060102150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// Метод реализует запрос '/admin/quarantine'. Возвращает снимки в карантине источника (всех источников при пустом source)
+func (a *API) GetQuarantine(source string) (ans []domain.QuarantinedSnapshot, err error) {
+	defaultMessage := "GetQuarantine: "
+	ans, err = a.QuarantineHandler.Service.GetAllQuarantine(a.mainCtx, source)
+	if err != nil {
+		logger.Printf(defaultMessage+"Check logs for DB. Error:%e", err)
+		return nil, dbReadErr(err)
+	}
+	return ans, nil
+}
+
+// Получение снимка, ожидающего решения
+func (a *API) pendingQuarantine(id string) (q domain.QuarantinedSnapshot, err error) {
+	q, err = a.QuarantineHandler.Service.GetQuarantine(a.mainCtx, id)
+	if err != nil {
+		logger.Printf("pendingQuarantine: Check logs for DB. Error:%e", err)
+		return q, dbReadErr(err)
+	}
+	if q.ID == "" {
+		return q, notFound("no quarantined snapshot " + id)
+	}
+	if q.Status != domain.QuarantinePending {
+		return q, invalidState("snapshot " + id + " is already " + q.Status)
+	}
+	return q, nil
+}
+
+// Метод реализует запрос '/admin/quarantine/approve'. Создает предложение записать курсы снимка в бд
+func (a *API) ProposeQuarantineRelease(id string, reason string, identity string) (ans domain.Proposal, err error) {
+	q, err := a.pendingQuarantine(id)
+	if err != nil {
+		return ans, err
+	}
+	if reason == "" {
+		reason = "release quarantined snapshot " + id
+	}
+	return a.propose(domain.Proposal{Kind: domain.ProposalQuarantineRelease, Source: q.Source, Target: id, Reason: reason}, identity)
+}
+
+// Запись курсов снимка в бд по одобренному предложению и отметка снимка одобренным.
+// Снимок с курсами на дату раньше действующего снимка записывается без активации, чтобы одобрение
+// старого карантина не заменило более новые курсы источника. К нему можно вернуться откатом
+func (a *API) releaseQuarantine(p domain.Proposal) (err error) {
+	q, err := a.pendingQuarantine(p.Target)
+	if err != nil {
+		return err
+	}
+	snaps, err := a.GetSnapshots(q.Source)
+	if err != nil {
+		return err
+	}
+	snap := a.newSnapshot(q.Source, q.ID, domain.SnapshotQuarantine, q.Rates)
+	older := false
+	for _, s := range snaps {
+		if s.Active && snap.Date < s.Date {
+			logger.Printf("Quarantined snapshot %s of source %s dated %s is older than active snapshot %s dated %s, storing without activation",
+				q.ID, q.Source, snap.Date, s.ID, s.Date)
+			older = true
+		}
+	}
+	if older {
+		_, err = a.addSnapshot(q.Source, q.ID, domain.SnapshotQuarantine, q.Rates)
+	} else {
+		_, err = a.storeSnapshot(q.Source, q.ID, domain.SnapshotQuarantine, q.Rates)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = a.resolveQuarantine(q, domain.QuarantineApproved, p.ResolvedBy); err != nil {
+		return err
+	}
+	a.audit(domain.AuditEntry{Actor: p.ProposedBy, ApprovedBy: p.ResolvedBy, Proposal: p.ID, Action: "quarantine_release",
+		Source: q.Source, Reason: p.Reason})
+	return nil
+}
+
+// Метод реализует запрос '/admin/quarantine/reject'. Отмечает снимок отклоненным, курсы в бд не меняются
+func (a *API) RejectQuarantine(id string, identity string) (ans domain.QuarantinedSnapshot, err error) {
+	q, err := a.pendingQuarantine(id)
+	if err != nil {
+		return ans, err
+	}
+	return a.resolveQuarantine(q, domain.QuarantineRejected, identity)
+}
+
+func (a *API) resolveQuarantine(q domain.QuarantinedSnapshot, status string, identity string) (domain.QuarantinedSnapshot, error) {
+	q.Status = status
+	q.ResolvedBy = identity
+	q.ResolvedAt = time.Now().In(a.timeLoc).Format(time.DateTime)
+	if err := a.QuarantineHandler.Service.StoreQuarantine(a.mainCtx, q); err != nil {
+		logger.Println("resolveQuarantine: Cannot store quarantined snapshot. Error:" + err.Error())
+		return q, dbWriteErr(err)
+	}
+	logger.Printf("Quarantined snapshot %s of source %s %s by %s", q.ID, q.Source, status, identity)
+	return q, nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"main/internal/pkg/domain"
+	"testing"
+)
+
+// Снимок в карантин без обновления источника
+func quarantineRates(t *testing.T, a *API, id string, rates []domain.CurrModel) {
+	t.Helper()
+	q := domain.QuarantinedSnapshot{ID: id, Source: SourceRU, Created: "2024-01-01 00:00:00", Status: domain.QuarantinePending,
+		Rates: rates, Hash: domain.RatesHash(rates)}
+	if err := a.QuarantineHandler.Service.StoreQuarantine(a.mainCtx, q); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func releaseQuarantined(t *testing.T, a *API, id string) {
+	t.Helper()
+	p, err := a.ProposeQuarantineRelease(id, "checked", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ApproveProposal(p.ID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReleaseQuarantineOlderThanActive(t *testing.T) {
+	a := newTestAPI(t)
+	quarantineRates(t, a, "Q-1", testRates("2024-01-01", "120", "USD"))
+	if _, err := a.storeSnapshot(SourceRU, "RU-2", domain.SnapshotFetch, testRates("2024-01-02", "91", "USD")); err != nil {
+		t.Fatal(err)
+	}
+	releaseQuarantined(t, a, "Q-1")
+	if active := activeSnapshot(t, a, SourceRU); active.ID != "RU-2" {
+		t.Fatalf("expected newer snapshot RU-2 to stay active, got %+v", active)
+	}
+	curr, err := a.DatabaseHandler.Service.GetBySourceAndKey(a.mainCtx, SourceRU, "USD")
+	if err != nil || curr.RatioBuy != "91" {
+		t.Fatalf("expected rate of RU-2, got %+v %v", curr, err)
+	}
+	snaps, err := a.GetSnapshots(SourceRU)
+	if err != nil || len(snaps) != 2 {
+		t.Fatalf("expected released snapshot kept in history, got %+v %v", snaps, err)
+	}
+	q, err := a.QuarantineHandler.Service.GetQuarantine(a.mainCtx, "Q-1")
+	if err != nil || q.Status != domain.QuarantineApproved {
+		t.Fatalf("expected quarantined snapshot approved, got %+v %v", q, err)
+	}
+}
+
+func TestReleaseQuarantineActivates(t *testing.T) {
+	a := newTestAPI(t)
+	if _, err := a.storeSnapshot(SourceRU, "RU-1", domain.SnapshotFetch, testRates("2024-01-01", "90", "USD")); err != nil {
+		t.Fatal(err)
+	}
+	quarantineRates(t, a, "Q-2", testRates("2024-01-02", "120", "USD"))
+	releaseQuarantined(t, a, "Q-2")
+	if active := activeSnapshot(t, a, SourceRU); active.ID != "Q-2" {
+		t.Fatalf("expected released snapshot Q-2 active, got %+v", active)
+	}
+}
@@ -5,26 +5,35 @@ import (
 	"context"
 	"errors"
 	"log"
+	"main/config"
 	"main/internal/pkg/domain"
 	"main/internal/pkg/services/fetcher"
 	"main/internal/pkg/services/parser"
-	"main/internal/pkg/services/repo/redisdb"
+	"main/internal/pkg/services/repo"
 	"os"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 )
 
 // Стандартный курс для GetAll
 const defaultSource = "RU"
 const SourceRU = "RU"
 const SourceTH = "TH"
+const SourceKZ = "KZ"
+const SourceRUMetals = "RU_METALS"
 const SourceCurrNameRU = "RUB"
 const SourceCurrNameTH = "THB"
+const SourceCurrNameKZ = "KZT"
+
+// Источники с той же базовой валютой, в которых ищутся валюты, отсутствующие в исходном источнике.
+// Позволяет конвертировать металлы RU_METALS в валюты ЦБ РФ
+var linkedSources = map[string]string{SourceRUMetals: SourceRU}
 
 // Логгер для API
 var logger = log.New(os.Stdout, "API ", log.LstdFlags|log.Lshortfile)
@@ -36,6 +45,10 @@ type ParseService interface {
 	Parse(source string, body []byte) (interface{}, error)
 	//ПРиведение к модели, которая воспринимается бд
 	ParseCurrstoDTO(newCurr interface{}, source string) (dom []domain.CurrModel, err error)
+	//Приведение тела ответа с ключевыми ставками к модели бд
+	ParsePolicyRates(source string, body []byte) (res []domain.PolicyRate, err error)
+	//Проверка тела ответа по ожидаемой схеме источника. Возвращает найденные расхождения
+	CheckSchema(source string, body []byte) []domain.DriftIssue
 }
 
 // Хендлер парсеров тел источника
@@ -46,7 +59,9 @@ type ParseHandler struct {
 type FetcherService interface {
 	// GetCurrfromSource отправляет GET-запрос по ссылке для конкретного источника и конкретной валюты (если нужно, добавить ключи доступа).
 	// Возвращает ненулевую ошибку при получении статуса запроса не OK
-	FetchAllfromSource(source string, sourceKeys map[string]string, sourceLinks map[string]string) (body []byte, err error)
+	FetchAllfromSource(source string, sourceAuth map[string]*fetcher.KeyRing, sourceLinks map[string]string) (body []byte, err error)
+	// FetchPolicyFromSource отправляет GET-запрос за историей ключевой ставки источника
+	FetchPolicyFromSource(source string, sourceAuth map[string]*fetcher.KeyRing, policyLinks map[string]string) (body []byte, err error)
 }
 
 // Хендлер запросов по ссылкам источника
@@ -58,29 +73,129 @@ type Fetcher struct {
 // и контекст для graceful shutdown
 
 type API struct {
-	sourceKeys      map[string]string
-	sourceLinks     map[string]string
+	sourceAuth  map[string]*fetcher.KeyRing
+	sourceLinks map[string]string
+	//Ссылки на ключевые ставки источников
+	policyLinks map[string]string
+	//Источники, описанные в конфигурации
+	definitions map[string]domain.SourceDefinition
+	//Базовые валюты источников
+	baseCurrencies  map[string]string
 	timeout         int
 	timeLoc         *time.Location
 	mainCtx         context.Context
 	DatabaseHandler *domain.DatabaseHandler
+	PolicyHandler   *domain.PolicyRateHandler
+	DriftHandler    *domain.DriftHandler
+	//Допустимое изменение курса в процентах, общее и по кодам валют
+	defaultThreshold  float64
+	anomalyThresholds map[string]float64
+	QuarantineHandler *domain.QuarantineHandler
+	OverrideHandler   *domain.OverrideHandler
+	AuditHandler      *domain.AuditHandler
+	//Срок одобрения предложений
+	proposalTTL     time.Duration
+	ProposalHandler *domain.ProposalHandler
+	//Перезапрос источника при поврежденной записи в бд
+	selfHeal bool
+	//Выборы лидера: идентификатор реплики и токен ограждения действующей аренды (0 - реплика не лидер)
+	election     bool
+	holder       string
+	fence        atomic.Int64
+	LeaseHandler *domain.LeaseHandler
+	//Курсы, которые отдаются, пока бд недоступна
+	lastGood *lastGood
+	//Запрос источника по требованию: объединение запросов, ожидание и срок отметки отсутствующих валют
+	onDemand   bool
+	fetches    singleflight.Group
+	fetchWait  time.Duration
+	missing    *missingCache
+	missingTTL time.Duration
+	//Наименьший интервал между запросами источника по требованию
+	fetchInterval time.Duration
+	//Количество хранимых снимков источника
+	snapshotKeep int
 }
 
 // API реализует запросы сервера, содержит данные о источниках, локации времени для сверки обновлений,
 // и контекст для graceful shutdown
 
-func NewAPI(dbLink string, sourceKeys map[string]string, sourceLinks map[string]string, timeout int, timeLoc *time.Location, mainCtx context.Context, DbMaxRetries int) (*API, error) {
+func NewAPI(AppConfig *config.AppConfig, mainCtx context.Context) (*API, error) {
 	//Инициализация бд
-	opt, err := redis.ParseURL(dbLink)
+	storage, err := repo.NewStorage(mainCtx, AppConfig)
 	if err != nil {
-		logger.Printf("Wrong link provided.Check config.env")
+		logger.Printf("Cannot open db. Check config.env and db schema version")
 		logger.Println(err.Error())
 		return &API{}, err
 	}
-	//Клиент базы данных
-	DatabaseHandler := domain.NewDatabaseHandler(redisdb.NewCurrModelRepository(redis.NewClient(opt), DbMaxRetries))
+	//Источники из конфигурации. Неверное описание останавливает запуск
+	definitions := make(map[string]domain.SourceDefinition, len(AppConfig.SourceDefinitions))
+	baseCurrencies := map[string]string{SourceRU: SourceCurrNameRU, SourceTH: SourceCurrNameTH, SourceKZ: SourceCurrNameKZ, SourceRUMetals: SourceCurrNameRU}
+	for _, def := range AppConfig.SourceDefinitions {
+		if err := def.Validate(); err != nil {
+			logger.Printf("Wrong source definition provided.Check sources file")
+			logger.Println(err.Error())
+			return &API{}, err
+		}
+		if _, ok := baseCurrencies[def.Code]; ok {
+			err = errors.New("source " + def.Code + " is already defined")
+			logger.Println(err.Error())
+			return &API{}, err
+		}
+		definitions[def.Code] = def
+		baseCurrencies[def.Code] = def.Base
+	}
+	//Ключи доступа к источникам. Хранятся все время работы, чтобы переключение ключей и токены сохранялись между обновлениями
+	keyRings := make(map[string]*fetcher.KeyRing, len(AppConfig.SourceAuth))
+	for source, auth := range AppConfig.SourceAuth {
+		keyRings[source], err = fetcher.NewKeyRing(source, auth, AppConfig.TimeoutREQ)
+		if err != nil {
+			logger.Printf("Wrong auth settings provided.Check config.env")
+			logger.Println(err.Error())
+			return &API{}, err
+		}
+	}
+	//Репозитории базы данных
+	DatabaseHandler := domain.NewDatabaseHandler(storage.Database)
+	PolicyHandler := domain.NewPolicyRateHandler(storage.Policy)
+	DriftHandler := domain.NewDriftHandler(storage.Drift)
+	QuarantineHandler := domain.NewQuarantineHandler(storage.Quarantine)
+	OverrideHandler := domain.NewOverrideHandler(storage.Override)
+	AuditHandler := domain.NewAuditHandler(storage.Audit)
+	ProposalHandler := domain.NewProposalHandler(storage.Proposal)
+	LeaseHandler := domain.NewLeaseHandler(storage.Lease)
 	//Сервис создания запросов
-	return &API{sourceKeys, sourceLinks, timeout, timeLoc, mainCtx, DatabaseHandler}, nil
+	return &API{
+		sourceAuth:        keyRings,
+		sourceLinks:       AppConfig.SourceLinks,
+		policyLinks:       AppConfig.PolicyLinks,
+		definitions:       definitions,
+		baseCurrencies:    baseCurrencies,
+		timeout:           AppConfig.TimeoutREQ,
+		timeLoc:           AppConfig.Loc,
+		mainCtx:           mainCtx,
+		DatabaseHandler:   DatabaseHandler,
+		PolicyHandler:     PolicyHandler,
+		DriftHandler:      DriftHandler,
+		defaultThreshold:  AppConfig.AnomalyThreshold,
+		anomalyThresholds: AppConfig.AnomalyThresholds,
+		QuarantineHandler: QuarantineHandler,
+		OverrideHandler:   OverrideHandler,
+		AuditHandler:      AuditHandler,
+		proposalTTL:       time.Duration(AppConfig.ProposalTTL) * time.Hour,
+		ProposalHandler:   ProposalHandler,
+		selfHeal:          AppConfig.DbSelfHeal,
+		election:          AppConfig.LeaderElection,
+		holder:            newHolder(),
+		LeaseHandler:      LeaseHandler,
+		lastGood:          newLastGood(),
+		onDemand:          AppConfig.FetchOnDemand,
+		fetchWait:         time.Duration(AppConfig.FetchWait) * time.Second,
+		missing:           newMissingCache(),
+		missingTTL:        time.Duration(AppConfig.FetchMissTTL) * time.Second,
+		fetchInterval:     time.Duration(AppConfig.FetchInterval) * time.Second,
+		snapshotKeep:      AppConfig.SnapshotKeep,
+	}, nil
 }
 
 func (a *API) ExitConnectWithDb(mainCtx context.Context) error {
@@ -94,12 +209,16 @@ func (a *API) initParseHandler(source string) (Parser *ParseHandler, err error)
 	//Для каждого источника свой формат ответа
 	var datatype string
 	switch source {
-	case SourceRU:
+	case SourceRU, SourceKZ, SourceRUMetals:
 		datatype = "XML"
 	case SourceTH:
 		datatype = "JSON"
 	default:
-		return nil, errors.New("wrong source provided")
+		//Источник описан в конфигурации
+		if def, ok := a.definitions[source]; ok {
+			return &ParseHandler{parser.NewGenericParser(def)}, nil
+		}
+		return nil, unknownSource(source)
 	}
 	//Создание парсера через интерфейс
 	Parser = &ParseHandler{parser.NewParser(datatype)}
@@ -116,9 +235,16 @@ func (a *API) UpdateAllInSource(source string, timeLoc *time.Location, timeToUpd
 	err = a.FetchAndUpdateCurrs(source, time.Now().In(timeLoc).AddDate(0, 0, -1))
 	if err != nil {
 		logger.Println(defaultMessage, "FetchAndUpdateCurrs", err.Error())
-		return err
 	}
-	return nil
+	//Ручные курсы с истекшим сроком удаляются с записью в журнал
+	a.expireOverrides(source)
+	//Ключевая ставка обновляется вместе с курсами. Ее ошибка не влияет на результат обновления курсов
+	if link := a.policyLinks[source]; link != "" {
+		if perr := a.FetchAndUpdatePolicyRates(source); perr != nil {
+			logger.Println(defaultMessage, "FetchAndUpdatePolicyRates", perr.Error())
+		}
+	}
+	return err
 }
 
 // Для метода update. Ищет и возращает время самой неактуальной записи в бд по источнику
@@ -159,29 +285,49 @@ func (a *API) FetchAndUpdateCurrs(source string, currencyDate time.Time) (err er
 		return err
 	}
 	//Сервис отправки запросов
-	GetFetcher := &Fetcher{fetcher.NewFetcher(currencyDate, a.timeLoc, a.timeout)}
+	GetFetcher := &Fetcher{fetcher.NewFetcher(currencyDate, a.timeLoc, a.timeout, a.definitions)}
 	//Получение тела ответа
-	body, err := GetFetcher.Service.FetchAllfromSource(source, a.sourceKeys, a.sourceLinks)
+	body, err := GetFetcher.Service.FetchAllfromSource(source, a.sourceAuth, a.sourceLinks)
 	if err != nil {
 		return err
 	}
-	//Парсинг тела ответа
+	//Проверка схемы тела ответа до парсинга, чтобы переименованные поля не превратились в пустые значения в бд
+	if issues := ParseHandler.Service.CheckSchema(source, body); len(issues) != 0 {
+		if err := a.reportDrift(source, body, issues); err != nil {
+			return err
+		}
+	}
+	//Парсинг тела ответа. Нераспознанное тело (например, HTML-страница шлюза со статусом OK)
+	//считается ошибкой источника
 	newCurr, err := ParseHandler.Service.Parse(source, body)
 	if err != nil {
-		return err
+		return &domain.UpstreamError{Source: source, Class: domain.UpstreamMalformed, Err: err}
 	}
 	dto, err := ParseHandler.Service.ParseCurrstoDTO(newCurr, source)
 	if err != nil {
+		return &domain.UpstreamError{Source: source, Class: domain.UpstreamMalformed, Err: err}
+	}
+	//Сверка с сохраненными курсами. Снимок с аномалиями уходит в карантин, в бд остаются прежние курсы
+	prev, err := a.DatabaseHandler.Service.GetAllBySource(a.mainCtx, source)
+	if errors.Is(err, domain.ErrCorruptRecord) {
+		//Поврежденные курсы заменяются новым снимком без сверки
+		logger.Println(defaultMessage + "Stored rates are corrupt, skipping anomaly check. Err:" + err.Error())
+		prev, err = nil, nil
+	}
+	if err != nil {
+		logger.Println(defaultMessage + "Internal db error. Err:" + err.Error())
+		return dbWriteErr(err)
+	}
+	//Устаревший лидер не записывает курсы, их уже обновляет другая реплика
+	if err := a.checkFence(); err != nil {
 		return err
 	}
-	for _, i := range dto {
-		err = a.DatabaseHandler.Service.Store(a.mainCtx, i)
-		if err != nil {
-			logger.Println(defaultMessage + "Error adding data to db. Error:" + err.Error())
-			return errors.New("cannot add data to db now")
-		}
+	if flags := a.detectAnomalies(prev, dto); len(flags) != 0 {
+		return a.quarantine(source, dto, flags)
 	}
-	return nil
+	//Курсы записываются новым снимком, который становится действующим целиком
+	_, err = a.storeSnapshot(source, newID(source), domain.SnapshotFetch, dto)
+	return err
 }
 
 // Проверка правильности ввода запроса для метода `/convert`
@@ -191,18 +337,18 @@ func (a *API) checkQuery(first string, second string, amount string, exchange st
 	var exchangeTypes = []string{"buy", "sell"}
 	// Неверно указан курс валют
 	if !slices.Contains(exchangeTypes, exchange) {
-		return errors.New("exchange type is wrong")
+		return invalid("exchange type is wrong")
 	}
 	//Неверно указана валюта (должна иметь длину 3 и состоять из заглавных букв)
 	if !(len(first) == 3 && regexp.MustCompile(`^[A-Z]+$`).MatchString(first)) {
-		return errors.New("wrong first curr provided" + second)
+		return invalid("wrong first curr provided: " + first)
 	}
 	if !(len(second) == 3 && regexp.MustCompile(`^[A-Z]+$`).MatchString(second)) {
-		return errors.New("wrong second curr provided:" + second)
+		return invalid("wrong second curr provided: " + second)
 	}
 	//Неверно указан номинал (должен иметь вид числа c плавающей точкой)
 	if !(regexp.MustCompile("([0-9]*[.])?[0-9]+").MatchString(amount)) {
-		return errors.New("wrong amount provided")
+		return invalid("wrong amount provided")
 	}
 	return nil
 }
@@ -210,34 +356,34 @@ func (a *API) checkQuery(first string, second string, amount string, exchange st
 // Проверка если курс валюты совпадает с курсом перевода источника или такой валюты нет.
 // Возвращает ошибку метода NewOrUpdateCurr, если произошла ошибка поиска валюты в источнике
 // или базы данных, если нет связи с бд или произошло непреднамеренное отключение
-func (a *API) checkNameFromSource(source string, name string, exchange string) (nameModel domain.CurrModel, nameRatio float64, err error) {
+func (a *API) checkNameFromSource(source string, name string, exchange string) (nameModel domain.CurrModel, nameRatio float64, stale bool, err error) {
 	defaultMessage := "checkNameFromSource :"
 	//Проверка на курс источника
-	if strings.Contains(name, source) {
+	if base, ok := a.baseCurrencies[source]; ok && name == base {
 		date := time.Now().Format(time.DateOnly)
-		currname := ""
-		switch name {
-		case SourceCurrNameRU:
-			currname = SourceCurrNameRU
-		case SourceCurrNameTH:
-			currname = SourceCurrNameTH
-		default:
-			err = errors.New("wrong currency name" + name)
-			return domain.CurrModel{}, 1, err
-		}
-		nameModel = domain.ToCurrModel(date, source, currname, currname, "1.0", "1.0")
-		return nameModel, 1, nil
+		nameModel = domain.ToCurrModel(date, source, base, base, "1.0", "1.0")
+		return nameModel, 1, false, nil
 	}
-	//Поиск записи
-	nameModel, err = a.DatabaseHandler.Service.GetBySourceAndKey(a.mainCtx, source, name)
+	nameModel, stale, err = a.readRate(source, name)
 	if err != nil {
-		logger.Printf("%sCannot get %s model in source %s from DB . Check err: %e", defaultMessage, name, source, err)
-		return domain.CurrModel{}, 1, err
+		return domain.CurrModel{}, 1, false, err
+	}
+	//Валюты нет в бд: источник запрашивается по требованию
+	if len(nameModel.Name) == 0 && !stale && a.fetchOnDemand(source, name) {
+		if nameModel, stale, err = a.readRate(source, name); err != nil {
+			return domain.CurrModel{}, 1, false, err
+		}
+		if len(nameModel.Name) == 0 {
+			a.markMissing(source, name)
+		}
+	}
+	//Если нет, ищем в связанном источнике
+	if linked, ok := linkedSources[source]; ok && len(nameModel.Name) == 0 {
+		return a.checkNameFromSource(linked, name, exchange)
 	}
-	//Если нет
 	if len(nameModel.Name) == 0 {
 		logger.Printf("%sWrong or lost currency %s in source %s ", defaultMessage, name, source)
-		return domain.CurrModel{}, 1, errors.New("this currency " + name + " is unsupported or invalid for source " + source + ".")
+		return domain.CurrModel{}, 1, false, unsupportedCurrency("this currency " + name + " is unsupported or invalid for source " + source + ".")
 	}
 	switch exchange {
 	case "buy":
@@ -245,7 +391,7 @@ func (a *API) checkNameFromSource(source string, name string, exchange string) (
 			nameRatio, err = strconv.ParseFloat(strings.Replace(nameModel.RatioBuy, ",", ".", 1), 64)
 			if err != nil {
 				logger.Printf("%sLost value for currency %s. Check connect with client or integrity of DB. Error : %e ", defaultMessage, name, err)
-				return domain.CurrModel{}, 1, errors.New("lost value for currency " + name + " check again later")
+				return domain.CurrModel{}, 1, false, corruptData("lost value for currency " + name + " check again later")
 			}
 		}
 	case "sell":
@@ -253,11 +399,46 @@ func (a *API) checkNameFromSource(source string, name string, exchange string) (
 			nameRatio, err = strconv.ParseFloat(strings.Replace(nameModel.RatioSell, ",", ".", 1), 64)
 			if err != nil {
 				logger.Printf("%sLost value for currency %s. Check connect with client or integrity of DB. Error: %e", defaultMessage, name, err)
-				return domain.CurrModel{}, 1, errors.New("lost value for currency " + name + "check again later")
+				return domain.CurrModel{}, 1, false, corruptData("lost value for currency " + name + " check again later")
 			}
 		}
 	}
-	return nameModel, nameRatio, nil
+	return nameModel, nameRatio, stale, nil
+}
+
+// Чтение курса валюты из бд с заменой ручным курсом. Пока бд недоступна, возвращается последний прочитанный курс, stale истинно.
+// Если валюты нет, возвращается пустая сущность
+func (a *API) readRate(source string, name string) (nameModel domain.CurrModel, stale bool, err error) {
+	defaultMessage := "readRate :"
+	//Поиск записи и ручного курса, который заменяет сохраненный
+	nameModel, err = a.DatabaseHandler.Service.GetBySourceAndKey(a.mainCtx, source, name)
+	if errors.Is(err, domain.ErrNotFound) {
+		nameModel, err = domain.CurrModel{}, nil
+	}
+	var override domain.RateOverride
+	if err == nil {
+		override, err = a.activeOverride(source, name)
+	}
+	switch {
+	case err == nil:
+		a.lastGood.storeRate(source, name, nameModel, override)
+	case unavailable(err):
+		//Бд недоступна, отдается последний прочитанный курс
+		var ok bool
+		if nameModel, override, ok = a.lastGood.rate(source, name); ok {
+			logger.Printf("%sDB is unavailable, serving last known good %s rate in source %s. Error: %s", defaultMessage, name, source, err.Error())
+			stale, err = true, nil
+		}
+	}
+	if err != nil {
+		logger.Printf("%sCannot get %s model in source %s from DB . Check err: %e", defaultMessage, name, source, err)
+		a.reportCorrupt(source, err)
+		return domain.CurrModel{}, false, dbReadErr(err)
+	}
+	if override.Code != "" {
+		nameModel = applyOverride(nameModel, override)
+	}
+	return nameModel, stale, nil
 }
 
 // Тело ответа метода '/convert'
@@ -269,31 +450,39 @@ type ConvertResponse struct {
 	Exchange        string `json:"exchange,omitempty"`
 	Amount          string `json:"amount,omitempty"`
 	ConvertedAmount string `json:"converted_amount,omitempty"`
+	//Валюты, для которых использован ручной курс
+	Overridden []string `json:"overridden,omitempty"`
+	//Снимки курсов, использованные при конвертации
+	Snapshots []string `json:"snapshots,omitempty"`
 }
 
 // Метод Сonvert реализует запрос '/convert'. Достает из бд данные о валютах источника, и
-// при выбранном курсе перевода ( продажа/покупка), выводит тело ответа с данными о валютах и переведенном номинале
+// при выбранном курсе перевода ( продажа/покупка), выводит тело ответа с данными о валютах и переведенном номинале.
+// stale истинно, если бд недоступна и использованы последние прочитанные курсы
 // Возвращает ошибку если неправильно введены параметры или проблема с бд
-func (a *API) Convert(source string, first string, second string, amount string, exchange string) (data interface{}, err error) {
+func (a *API) Convert(source string, first string, second string, amount string, exchange string) (data interface{}, stale bool, err error) {
 	defaultMessage := "In Convert error occured in method %s. Check logs"
 	//Проверка на правильность ввода
 	err = a.checkQuery(first, second, amount, exchange)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	if _, ok := a.baseCurrencies[source]; !ok {
+		return nil, false, unknownSource(source)
 	}
-	firstDTO, firstRatio, err := a.checkNameFromSource(source, first, exchange)
+	firstDTO, firstRatio, firstStale, err := a.checkNameFromSource(source, first, exchange)
 	if err != nil {
 		logger.Printf(defaultMessage, "checkNameFromSource")
-		return nil, err
+		return nil, false, err
 	}
-	secondDTO, secondRatio, err := a.checkNameFromSource(source, second, exchange)
+	secondDTO, secondRatio, secondStale, err := a.checkNameFromSource(source, second, exchange)
 	if err != nil {
 		logger.Printf(defaultMessage, "checkNameFromSource")
-		return nil, err
+		return nil, false, err
 	}
 	amountParsed, err := strconv.ParseFloat(strings.Replace(amount, ",", ".", 1), 64)
 	if err != nil {
-		return nil, errors.New("wrong amount passed")
+		return nil, false, invalid("wrong amount passed")
 	}
 	//Обработка выбора курса продажи или покупки
 	convertedAmount := amountParsed * firstRatio / secondRatio
@@ -306,23 +495,96 @@ func (a *API) Convert(source string, first string, second string, amount string,
 	res.Exchange = exchange
 	res.Amount = amount
 	res.ConvertedAmount = strconv.FormatFloat(convertedAmount, 'f', 12, 64)
+	for _, dto := range []domain.CurrModel{firstDTO, secondDTO} {
+		if dto.Override != nil {
+			res.Overridden = append(res.Overridden, dto.Code)
+		}
+		if dto.Snapshot != "" && !slices.Contains(res.Snapshots, dto.Snapshot) {
+			res.Snapshots = append(res.Snapshots, dto.Snapshot)
+		}
+	}
 
-	return res, nil
+	return res, firstStale || secondStale, nil
 }
 
-// Метод  реализует запрос '/getAll'. Достает из бд данные о валютах источника. Возвращает ошибку если потеряно соединене с бд после 5 попыток
-func (a *API) GetAll(source string) (ans []domain.CurrModel, err error) {
-	defaultMessage := "GetAll: "
+// Метод  реализует запрос '/getAll'. Достает из бд данные о валютах источника. Возвращает ошибку если потеряно соединене с бд.
+// Пока бд недоступна, отдаются последние прочитанные курсы источника, stale истинно
+func (a *API) GetAll(source string) (ans []domain.CurrModel, stale bool, err error) {
 	if len(source) == 0 {
 		source = defaultSource
 	}
-	sourceDTOs, err := a.DatabaseHandler.Service.GetAllBySource(a.mainCtx, source)
+	if _, ok := a.baseCurrencies[source]; !ok {
+		return nil, false, unknownSource(source)
+	}
+	sourceDTOs, overrides, stale, err := a.readSource(source)
 	if err != nil {
-		logger.Printf(defaultMessage+"Check logs for DB. Error:%e", err)
-		return nil, errors.New("when requesting  data from database error occured. Try again later")
+		return nil, false, err
+	}
+	//Курсов источника нет в бд: источник запрашивается по требованию
+	if len(sourceDTOs) == 0 && !stale && a.fetchOnDemand(source, "") {
+		if sourceDTOs, overrides, stale, err = a.readSource(source); err != nil {
+			return nil, false, err
+		}
+	}
+	//Ручные курсы заменяют сохраненные, валюты только с ручным курсом добавляются в конец,
+	//в том числе когда курсов источника в бд еще нет
+	now := time.Now()
+	for _, o := range overrides {
+		if o.Expired(now) {
+			continue
+		}
+		i := slices.IndexFunc(sourceDTOs, func(c domain.CurrModel) bool { return c.Code == o.Code })
+		if i < 0 {
+			sourceDTOs = append(sourceDTOs, applyOverride(domain.CurrModel{}, o))
+			continue
+		}
+		sourceDTOs[i] = applyOverride(sourceDTOs[i], o)
 	}
-	if (len(sourceDTOs)) == 0 {
-		return nil, errors.New("wrong source provided")
+	if len(sourceDTOs) == 0 {
+		return nil, false, notFound("no rates for source " + source)
+	}
+	return sourceDTOs, stale, nil
+}
+
+// Метод реализует запрос '/v1/sources/{source}/rates/{code}'. Курс одной валюты источника с учетом ручного курса,
+// валюта ищется так же, как в '/convert'. Пока бд недоступна, отдается последний прочитанный курс, stale истинно
+func (a *API) GetRate(source string, code string) (ans domain.CurrModel, stale bool, err error) {
+	if len(source) == 0 {
+		source = defaultSource
+	}
+	if _, ok := a.baseCurrencies[source]; !ok {
+		return ans, false, unknownSource(source)
+	}
+	if !regexp.MustCompile(`^[A-Z]{3}$`).MatchString(code) {
+		return ans, false, invalid("wrong curr provided: " + code)
+	}
+	ans, _, stale, err = a.checkNameFromSource(source, code, "buy")
+	return ans, stale, err
+}
+
+// Чтение курсов и ручных курсов источника из бд. Пока бд недоступна, возвращаются последние прочитанные курсы, stale истинно
+func (a *API) readSource(source string) (rates []domain.CurrModel, overrides []domain.RateOverride, stale bool, err error) {
+	defaultMessage := "GetAll: "
+	rates, err = a.DatabaseHandler.Service.GetAllBySource(a.mainCtx, source)
+	if err != nil {
+		a.reportCorrupt(source, err)
+	} else {
+		overrides, err = a.OverrideHandler.Service.GetOverrides(a.mainCtx, source)
+	}
+	switch {
+	case err == nil:
+		a.lastGood.storeSource(source, rates, overrides)
+	case unavailable(err):
+		//Бд недоступна, отдаются последние прочитанные курсы
+		var ok bool
+		if rates, overrides, ok = a.lastGood.get(source); ok {
+			logger.Printf(defaultMessage+"DB is unavailable, serving last known good rates of source %s. Error: %s", source, err.Error())
+			stale, err = true, nil
+		}
+	}
+	if err != nil {
+		logger.Printf(defaultMessage+"Check logs for DB. Error:%e", err)
+		return nil, nil, false, dbReadErr(err)
 	}
-	return sourceDTOs, nil
+	return rates, overrides, stale, nil
 }
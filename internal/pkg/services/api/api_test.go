@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"main/config"
+	"main/internal/pkg/domain"
+	"testing"
+	"time"
+)
+
+// Сервис с хранилищем в памяти и без запросов к источникам
+func newTestAPI(t *testing.T) *API {
+	t.Helper()
+	ctx := context.Background()
+	a, err := NewAPI(&config.AppConfig{DbBackend: config.DbMemory, Loc: time.UTC, ProposalTTL: 24}, ctx)
+	if err != nil {
+		t.Fatalf("cannot create api: %v", err)
+	}
+	t.Cleanup(func() { a.DatabaseHandler.Service.Close(ctx) })
+	return a
+}
+
+func testRates(date string, buy string, codes ...string) []domain.CurrModel {
+	res := make([]domain.CurrModel, 0, len(codes))
+	for _, code := range codes {
+		res = append(res, domain.ToCurrModel(date, SourceRU, code, "name "+code, buy, buy))
+	}
+	return res
+}
+
+func activeSnapshot(t *testing.T, a *API, source string) domain.Snapshot {
+	t.Helper()
+	snaps, err := a.GetSnapshots(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range snaps {
+		if s.Active {
+			return s
+		}
+	}
+	return domain.Snapshot{}
+}
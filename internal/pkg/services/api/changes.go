@@ -0,0 +1,182 @@
+package api
+
+import (
+	"main/internal/pkg/domain"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Изменение курса валюты между двумя снимками
+type RateChange struct {
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	OldBuy  string `json:"old_buy"`
+	NewBuy  string `json:"new_buy"`
+	OldSell string `json:"old_sell"`
+	NewSell string `json:"new_sell"`
+	//Абсолютное и относительное (в процентах) изменение курсов
+	BuyChange     float64 `json:"buy_change"`
+	BuyChangePct  float64 `json:"buy_change_pct"`
+	SellChange    float64 `json:"sell_change"`
+	SellChangePct float64 `json:"sell_change_pct"`
+}
+
+// Тело ответа метода '/changes'
+type ChangesResponse struct {
+	Source string          `json:"source"`
+	From   domain.Snapshot `json:"from"`
+	To     domain.Snapshot `json:"to"`
+	//Изменения курсов. При top - по убыванию модуля изменения курса покупки, иначе по коду валюты
+	Changes []RateChange `json:"changes"`
+	//Новые и пропавшие валюты
+	Added   []domain.CurrModel `json:"added"`
+	Removed []domain.CurrModel `json:"removed"`
+}
+
+// Поиск снимка по идентификатору или дате курсов yyyy-mm-dd. Для даты берется снимок с последней датой курсов
+// не позже указанной, из равных - записанный позже. Снимки переданы от новых к старым
+func findSnapshot(snaps []domain.Snapshot, ref string) (res domain.Snapshot, err error) {
+	if _, err := time.Parse(time.DateOnly, ref); err != nil {
+		for _, s := range snaps {
+			if s.ID == ref {
+				return s, nil
+			}
+		}
+		return res, notFound("no snapshot " + ref)
+	}
+	for _, s := range snaps {
+		if s.Date <= ref && s.Date > res.Date {
+			res = s
+		}
+	}
+	if res.ID == "" {
+		return res, notFound("no snapshot with rates on or before " + ref)
+	}
+	return res, nil
+}
+
+// Последний снимок, записанный перед to, с курсами на более раннюю дату или с другими курсами (по хэшу).
+// Источники публикуют курсы реже обновлений, поэтому соседние снимки обычно совпадают. Снимки переданы от новых к старым
+func previousSnapshot(snaps []domain.Snapshot, to domain.Snapshot) (res domain.Snapshot) {
+	older := false
+	for _, s := range snaps {
+		if s.ID == to.ID {
+			older = true
+			continue
+		}
+		if !older {
+			continue
+		}
+		if s.Date < to.Date || s.Hash != "" && to.Hash != "" && s.Hash != to.Hash {
+			return s
+		}
+	}
+	return res
+}
+
+func change(oldVal string, newVal string) (abs float64, pct float64) {
+	o, errOld := parseRatio(oldVal)
+	n, errNew := parseRatio(newVal)
+	if errOld != nil || errNew != nil {
+		return 0, 0
+	}
+	abs = n - o
+	if o != 0 {
+		pct = abs / o * 100
+	}
+	return abs, pct
+}
+
+// Метод реализует запрос '/changes'. Сравнивает курсы источника в двух снимках, заданных идентификатором или датой.
+// По умолчанию to - действующий снимок, from - последний записанный перед to снимок с курсами на более раннюю дату
+// или с другими курсами. При top > 0 возвращает top валют
+// с наибольшим изменением курса покупки
+func (a *API) GetChanges(source string, from string, to string, top string) (ans ChangesResponse, err error) {
+	defaultMessage := "GetChanges: "
+	if len(source) == 0 {
+		source = defaultSource
+	}
+	n := 0
+	if top != "" {
+		if n, err = strconv.Atoi(top); err != nil || n <= 0 {
+			return ans, invalid("wrong top " + top + " provided")
+		}
+	}
+	snaps, err := a.DatabaseHandler.Service.GetSnapshots(a.mainCtx, source)
+	if err != nil {
+		logger.Printf(defaultMessage+"Check logs for DB. Error:%e", err)
+		return ans, dbReadErr(err)
+	}
+	if len(snaps) == 0 {
+		return ans, notFound("no snapshots for source " + source)
+	}
+	if to == "" {
+		for _, s := range snaps {
+			if s.Active {
+				ans.To = s
+			}
+		}
+		if ans.To.ID == "" {
+			ans.To = snaps[0]
+		}
+	} else if ans.To, err = findSnapshot(snaps, to); err != nil {
+		return ans, err
+	}
+	if from == "" {
+		if ans.From = previousSnapshot(snaps, ans.To); ans.From.ID == "" {
+			return ans, notFound("no snapshot with other rates before " + ans.To.ID)
+		}
+	} else if ans.From, err = findSnapshot(snaps, from); err != nil {
+		return ans, err
+	}
+	oldRates, err := a.DatabaseHandler.Service.GetSnapshotRates(a.mainCtx, source, ans.From.ID)
+	if err == nil {
+		var newRates []domain.CurrModel
+		newRates, err = a.DatabaseHandler.Service.GetSnapshotRates(a.mainCtx, source, ans.To.ID)
+		ans.Changes, ans.Added, ans.Removed = diffRates(oldRates, newRates)
+	}
+	if err != nil {
+		logger.Printf(defaultMessage+"Check logs for DB. Error:%e", err)
+		return ans, dbReadErr(err)
+	}
+	ans.Source = source
+	if n > 0 {
+		sort.SliceStable(ans.Changes, func(i, j int) bool {
+			return math.Abs(ans.Changes[i].BuyChangePct) > math.Abs(ans.Changes[j].BuyChangePct)
+		})
+		if len(ans.Changes) > n {
+			ans.Changes = ans.Changes[:n]
+		}
+	}
+	return ans, nil
+}
+
+// Сравнение курсов двух снимков. Курсы снимков отсортированы по коду валюты
+func diffRates(oldRates []domain.CurrModel, newRates []domain.CurrModel) (changes []RateChange, added []domain.CurrModel, removed []domain.CurrModel) {
+	changes, added, removed = []RateChange{}, []domain.CurrModel{}, []domain.CurrModel{}
+	oldByCode := make(map[string]domain.CurrModel, len(oldRates))
+	for _, c := range oldRates {
+		oldByCode[c.Code] = c
+	}
+	newCodes := make(map[string]bool, len(newRates))
+	for _, c := range newRates {
+		newCodes[c.Code] = true
+		old, ok := oldByCode[c.Code]
+		if !ok {
+			added = append(added, c)
+			continue
+		}
+		ch := RateChange{Code: c.Code, Name: c.Name, OldBuy: old.RatioBuy, NewBuy: c.RatioBuy, OldSell: old.RatioSell, NewSell: c.RatioSell}
+		ch.BuyChange, ch.BuyChangePct = change(old.RatioBuy, c.RatioBuy)
+		ch.SellChange, ch.SellChangePct = change(old.RatioSell, c.RatioSell)
+		changes = append(changes, ch)
+	}
+	for _, c := range oldRates {
+		if !newCodes[c.Code] {
+			removed = append(removed, c)
+		}
+	}
+	return changes, added, removed
+}
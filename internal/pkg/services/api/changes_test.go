@@ -0,0 +1,135 @@
+package api
+
+import (
+	"main/internal/pkg/domain"
+	"testing"
+)
+
+// Снимки от новых к старым
+var testSnaps = []domain.Snapshot{
+	{ID: "RU-5", Date: "2024-01-03", Hash: "c"},
+	{ID: "RU-4", Date: "2024-01-02", Hash: "b"},
+	{ID: "RU-3", Date: "2024-01-02", Hash: "b"},
+	{ID: "RU-2", Date: "2024-01-02", Hash: "a"},
+	{ID: "RU-1", Date: "2024-01-01", Hash: "a"},
+}
+
+func TestFindSnapshot(t *testing.T) {
+	cases := []struct {
+		ref string
+		id  string
+	}{
+		{"RU-3", "RU-3"},
+		{"RU-1", "RU-1"},
+		{"2024-01-03", "RU-5"},
+		{"2024-12-31", "RU-5"},
+		//Из снимков на одну дату берется записанный позже
+		{"2024-01-02", "RU-4"},
+		{"2024-01-01", "RU-1"},
+		{"2023-12-31", ""},
+		{"RU-9", ""},
+		{"2024-13-01", ""},
+	}
+	for _, c := range cases {
+		s, err := findSnapshot(testSnaps, c.ref)
+		if c.id == "" {
+			if ErrorCode(err) != CodeNotFound {
+				t.Errorf("ref %s: expected NOT_FOUND, got %+v %v", c.ref, s, err)
+			}
+			continue
+		}
+		if err != nil || s.ID != c.id {
+			t.Errorf("ref %s: expected %s, got %+v %v", c.ref, c.id, s, err)
+		}
+	}
+}
+
+func TestPreviousSnapshot(t *testing.T) {
+	cases := []struct {
+		to   domain.Snapshot
+		from string
+	}{
+		{testSnaps[0], "RU-4"},
+		//Снимок с теми же курсами пропускается, берется снимок с другими курсами
+		{testSnaps[1], "RU-2"},
+		{testSnaps[2], "RU-2"},
+		{testSnaps[3], "RU-1"},
+		{testSnaps[4], ""},
+		{domain.Snapshot{ID: "RU-9", Date: "2024-01-05"}, ""},
+		//Без хэша сравнивается только дата
+		{domain.Snapshot{ID: "RU-4", Date: "2024-01-02"}, "RU-1"},
+	}
+	for _, c := range cases {
+		if s := previousSnapshot(testSnaps, c.to); s.ID != c.from {
+			t.Errorf("to %s: expected %q, got %+v", c.to.ID, c.from, s)
+		}
+	}
+}
+
+func TestDiffRates(t *testing.T) {
+	oldRates := []domain.CurrModel{
+		domain.ToCurrModel("2024-01-01", SourceRU, "EUR", "Euro", "100", "102"),
+		domain.ToCurrModel("2024-01-01", SourceRU, "GBP", "Pound", "110", "112"),
+		domain.ToCurrModel("2024-01-01", SourceRU, "USD", "Dollar", "90", "92"),
+	}
+	newRates := []domain.CurrModel{
+		domain.ToCurrModel("2024-01-02", SourceRU, "CNY", "Yuan", "12", "13"),
+		domain.ToCurrModel("2024-01-02", SourceRU, "EUR", "Euro", "95", "102"),
+		domain.ToCurrModel("2024-01-02", SourceRU, "USD", "Dollar", "99", "x"),
+	}
+	changes, added, removed := diffRates(oldRates, newRates)
+	if len(added) != 1 || added[0].Code != "CNY" || len(removed) != 1 || removed[0].Code != "GBP" {
+		t.Fatalf("unexpected added %+v removed %+v", added, removed)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected two changes, got %+v", changes)
+	}
+	eur, usd := changes[0], changes[1]
+	if eur.Code != "EUR" || eur.BuyChange != -5 || eur.BuyChangePct != -5 || eur.SellChange != 0 || eur.OldBuy != "100" || eur.NewBuy != "95" {
+		t.Errorf("unexpected EUR change %+v", eur)
+	}
+	//Курс продажи не читается, изменение не считается
+	if usd.Code != "USD" || usd.BuyChange != 9 || usd.BuyChangePct != 10 || usd.SellChange != 0 || usd.SellChangePct != 0 {
+		t.Errorf("unexpected USD change %+v", usd)
+	}
+	changes, added, removed = diffRates(nil, nil)
+	if changes == nil || added == nil || removed == nil {
+		t.Error("expected empty slices, not nil")
+	}
+}
+
+func TestGetChangesTop(t *testing.T) {
+	a := newTestAPI(t)
+	oldRates := append(testRates("2024-01-01", "100", "EUR", "GBP"), testRates("2024-01-01", "100", "USD")...)
+	newRates := []domain.CurrModel{
+		domain.ToCurrModel("2024-01-02", SourceRU, "EUR", "name EUR", "101", "101"),
+		domain.ToCurrModel("2024-01-02", SourceRU, "GBP", "name GBP", "80", "80"),
+		domain.ToCurrModel("2024-01-02", SourceRU, "USD", "name USD", "110", "110"),
+	}
+	if _, err := a.storeSnapshot(SourceRU, "RU-1", domain.SnapshotFetch, oldRates); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.storeSnapshot(SourceRU, "RU-2", domain.SnapshotFetch, newRates); err != nil {
+		t.Fatal(err)
+	}
+	ans, err := a.GetChanges(SourceRU, "", "", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//По умолчанию to - действующий снимок, from - снимок с курсами на более раннюю дату
+	if ans.To.ID != "RU-2" || ans.From.ID != "RU-1" {
+		t.Fatalf("expected RU-1 -> RU-2, got %s -> %s", ans.From.ID, ans.To.ID)
+	}
+	if len(ans.Changes) != 2 || ans.Changes[0].Code != "GBP" || ans.Changes[1].Code != "USD" {
+		t.Fatalf("expected GBP and USD by buy change, got %+v", ans.Changes)
+	}
+	all, err := a.GetChanges(SourceRU, "RU-1", "2024-01-02", "")
+	if err != nil || len(all.Changes) != 3 || all.Changes[0].Code != "EUR" {
+		t.Fatalf("expected all changes by code, got %+v %v", all.Changes, err)
+	}
+	for _, top := range []string{"0", "-1", "x"} {
+		if _, err := a.GetChanges(SourceRU, "", "", top); ErrorCode(err) != CodeInvalidRequest {
+			t.Errorf("top %s: expected INVALID_REQUEST, got %v", top, err)
+		}
+	}
+}
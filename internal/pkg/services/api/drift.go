@@ -0,0 +1,85 @@
+package api
+
+import (
+	"main/internal/pkg/domain"
+	"strconv"
+	"time"
+)
+
+// Сохранение отчета о расхождении схемы. Если среди расхождений есть блокирующие, тело ответа
+// сохраняется в отчете (карантин) и возвращается ошибка класса malformed, данные в бд не записываются.
+// Отчет с тем же набором расхождений, что и последний отчет источника, не сохраняется повторно,
+// чтобы одно новое поле не вытесняло остальные отчеты на каждом обновлении. ALERT пишется только для блокирующих расхождений
+func (a *API) reportDrift(source string, body []byte, issues []domain.DriftIssue) error {
+	defaultMessage := "reportDrift: "
+	report := domain.DriftReport{
+		Source: source,
+		Time:   time.Now().In(a.timeLoc).Format(time.DateTime),
+		Issues: issues,
+	}
+	for _, i := range issues {
+		if i.Blocking() {
+			report.Quarantined = true
+			report.Payload = string(body)
+			break
+		}
+	}
+	repeated := false
+	last, err := a.DriftHandler.Service.GetDrifts(a.mainCtx, source)
+	if err != nil {
+		logger.Println(defaultMessage + "Cannot read drift reports. Error:" + err.Error())
+	} else if len(last) != 0 {
+		repeated = sameIssues(last[0].Issues, issues)
+	}
+	switch {
+	case report.Quarantined:
+		logger.Printf("ALERT %sSchema drift in source %s: %d issues, first: %s %s. Quarantined: %t",
+			defaultMessage, source, len(issues), issues[0].Kind, issues[0].Path, report.Quarantined)
+	case !repeated:
+		logger.Printf("%sSchema drift in source %s: %d non-blocking issues, first: %s %s",
+			defaultMessage, source, len(issues), issues[0].Kind, issues[0].Path)
+	}
+	if !repeated {
+		if err := a.DriftHandler.Service.StoreDrift(a.mainCtx, report); err != nil {
+			logger.Println(defaultMessage + "Cannot store drift report. Error:" + err.Error())
+		}
+	}
+	if report.Quarantined {
+		return &domain.UpstreamError{Source: source, Class: domain.UpstreamMalformed,
+			Message: "schema drift detected, " + strconv.Itoa(len(issues)) + " issues. payload quarantined"}
+	}
+	return nil
+}
+
+// Совпадают ли наборы расхождений по виду и пути поля независимо от порядка
+func sameIssues(a []domain.DriftIssue, b []domain.DriftIssue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[domain.DriftIssue]int, len(a))
+	for _, i := range a {
+		seen[domain.DriftIssue{Kind: i.Kind, Path: i.Path}]++
+	}
+	for _, i := range b {
+		key := domain.DriftIssue{Kind: i.Kind, Path: i.Path}
+		if seen[key] == 0 {
+			return false
+		}
+		seen[key]--
+	}
+	return true
+}
+
+// Метод реализует запрос '/admin/drift'. Возвращает последние отчеты о расхождении схемы источника
+func (a *API) GetDrifts(source string) (ans []domain.DriftReport, err error) {
+	defaultMessage := "GetDrifts: "
+	if len(source) == 0 {
+		source = defaultSource
+	}
+	ans, err = a.DriftHandler.Service.GetDrifts(a.mainCtx, source)
+	if err != nil {
+		logger.Printf(defaultMessage+"Check logs for DB. Error:%e", err)
+		return nil, dbReadErr(err)
+	}
+	return ans, nil
+}
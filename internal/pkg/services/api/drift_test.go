@@ -0,0 +1,56 @@
+package api
+
+import (
+	"main/internal/pkg/domain"
+	"testing"
+)
+
+func TestReportDriftDeduplicates(t *testing.T) {
+	a := newTestAPI(t)
+	unknown := []domain.DriftIssue{{Kind: domain.DriftUnknownField, Path: "Valute.USD.Extra", Detail: "string"}}
+	for range 3 {
+		if err := a.reportDrift(SourceRU, []byte(`{}`), unknown); err != nil {
+			t.Fatalf("expected non-blocking drift accepted, got %v", err)
+		}
+	}
+	missing := []domain.DriftIssue{
+		{Kind: domain.DriftMissingField, Path: "Valute.USD.Value"},
+		{Kind: domain.DriftUnknownField, Path: "Valute.USD.Extra"},
+	}
+	if err := a.reportDrift(SourceRU, []byte(`{}`), missing); err == nil {
+		t.Fatal("expected blocking drift rejected")
+	}
+	//Тот же набор в другом порядке
+	reordered := []domain.DriftIssue{missing[1], missing[0]}
+	if err := a.reportDrift(SourceRU, []byte(`{}`), reordered); err == nil {
+		t.Fatal("expected repeated blocking drift rejected")
+	}
+	reports, err := a.GetDrifts(SourceRU)
+	if err != nil || len(reports) != 2 {
+		t.Fatalf("expected two distinct reports, got %+v %v", reports, err)
+	}
+	if !reports[0].Quarantined || reports[1].Quarantined {
+		t.Fatalf("unexpected report order %+v", reports)
+	}
+}
+
+func TestSameIssues(t *testing.T) {
+	a := domain.DriftIssue{Kind: domain.DriftUnknownField, Path: "x"}
+	b := domain.DriftIssue{Kind: domain.DriftChangedType, Path: "x"}
+	cases := []struct {
+		l, r []domain.DriftIssue
+		same bool
+	}{
+		{nil, nil, true},
+		{[]domain.DriftIssue{a, b}, []domain.DriftIssue{b, a}, true},
+		{[]domain.DriftIssue{a}, []domain.DriftIssue{{Kind: a.Kind, Path: a.Path, Detail: "other"}}, true},
+		{[]domain.DriftIssue{a}, []domain.DriftIssue{b}, false},
+		{[]domain.DriftIssue{a, a}, []domain.DriftIssue{a, b}, false},
+		{[]domain.DriftIssue{a}, []domain.DriftIssue{a, b}, false},
+	}
+	for n, c := range cases {
+		if got := sameIssues(c.l, c.r); got != c.same {
+			t.Errorf("case %d: expected %t, got %t", n, c.same, got)
+		}
+	}
+}
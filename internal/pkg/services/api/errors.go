@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"main/internal/pkg/domain"
+	"sync"
+	"time"
+)
+
+// Коды ошибок для ответа клиенту. Коды не меняются между версиями, клиент различает ошибки по ним,
+// а сообщение может меняться
+const (
+	CodeInvalidRequest      = "INVALID_REQUEST"
+	CodeUnknownSource       = "UNKNOWN_SOURCE"
+	CodeUnsupportedCurrency = "UNSUPPORTED_CURRENCY"
+	CodeNotFound            = "NOT_FOUND"
+	CodeInvalidState        = "INVALID_STATE"
+	CodeCorruptData         = "CORRUPT_DATA"
+	CodeDBUnavailable       = "DB_UNAVAILABLE"
+	CodeDBTimeout           = "DB_TIMEOUT"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeAdminDisabled       = "ADMIN_DISABLED"
+	CodeMethodNotAllowed    = "METHOD_NOT_ALLOWED"
+	CodeInternal            = "INTERNAL_ERROR"
+	//Не ошибка: бд недоступна, ответ содержит последние прочитанные курсы
+	CodeStaleData = "STALE_DATA"
+)
+
+// Ошибка для ответа клиенту. Сообщение не раскрывает подробностей,
+// вид ошибки хранилища (domain.ErrNotFound, domain.ErrConnLost и др.) доступен через errors.Is
+type apiError struct {
+	code    string
+	message string
+	err     error
+}
+
+func (e *apiError) Error() string { return e.message }
+func (e *apiError) Unwrap() error { return e.err }
+
+// Код ошибки для ответа клиенту. Код ошибки хранилища определяется по ее виду
+func ErrorCode(err error) string {
+	var e *apiError
+	if errors.As(err, &e) && e.code != "" {
+		return e.code
+	}
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return CodeNotFound
+	case errors.Is(err, domain.ErrCorruptRecord):
+		return CodeCorruptData
+	case errors.Is(err, domain.ErrConnLost):
+		return CodeDBUnavailable
+	case errors.Is(err, domain.ErrDBTimeout):
+		return CodeDBTimeout
+	}
+	return CodeInternal
+}
+
+func dbReadErr(err error) error {
+	return &apiError{"", "when requesting  data from database error occured. Try again later", err}
+}
+
+func dbWriteErr(err error) error {
+	return &apiError{"", "cannot add data to db now", err}
+}
+
+func notFound(message string) error {
+	return &apiError{CodeNotFound, message, domain.ErrNotFound}
+}
+
+// Неверные параметры запроса
+func invalid(message string) error {
+	return &apiError{CodeInvalidRequest, message, nil}
+}
+
+func unknownSource(source string) error {
+	return &apiError{CodeUnknownSource, "unknown source " + source, domain.ErrNotFound}
+}
+
+func unsupportedCurrency(message string) error {
+	return &apiError{CodeUnsupportedCurrency, message, domain.ErrNotFound}
+}
+
+// Запрос верен, но не выполним в текущем состоянии (предложение уже решено, снимок уже действует и др.)
+func invalidState(message string) error {
+	return &apiError{CodeInvalidState, message, nil}
+}
+
+// Сохраненные данные не читаются
+func corruptData(message string) error {
+	return &apiError{CodeCorruptData, message, nil}
+}
+
+// Источники, которые перезапрашиваются после обнаружения поврежденной записи
+var healing sync.Map
+
+// Сообщение о поврежденной записи в бд. При включенном DB_SELF_HEAL источник перезапрашивается в фоне:
+// новый снимок заменяет поврежденный
+func (a *API) reportCorrupt(source string, err error) {
+	var repoErr *domain.RepoError
+	if !errors.As(err, &repoErr) || repoErr.Kind != domain.ErrCorruptRecord {
+		return
+	}
+	logger.Printf("ALERT reportCorrupt: Corrupt record %s in source %s. Self-heal: %t. Error: %s", repoErr.Key, source, a.selfHeal, err.Error())
+	//Источник перезапрашивает только лидер, чтобы реплики не расходовали квоту источника
+	if !a.selfHeal || !a.isLeader() {
+		return
+	}
+	if _, busy := healing.LoadOrStore(source, true); busy {
+		return
+	}
+	go func() {
+		defer healing.Delete(source)
+		if err := a.FetchAndUpdateCurrs(source, time.Now().In(a.timeLoc).AddDate(0, 0, -1)); err != nil {
+			logger.Printf("reportCorrupt: Cannot re-fetch source %s. Error: %s", source, err.Error())
+			return
+		}
+		logger.Printf("reportCorrupt: Source %s re-fetched after corrupt record %s", source, repoErr.Key)
+	}()
+}
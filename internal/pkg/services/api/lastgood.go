@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"main/internal/pkg/domain"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Последние успешно прочитанные или записанные курсы источников в памяти процесса.
+// Пока бд недоступна, '/convert' и '/getAll' отвечают ими с отметкой stale
+type lastGood struct {
+	mu      sync.RWMutex
+	sources map[string]*lastGoodSource
+}
+
+// Курсы действующего снимка и ручные курсы источника
+type lastGoodSource struct {
+	rates     map[string]domain.CurrModel
+	overrides map[string]domain.RateOverride
+}
+
+func newLastGood() *lastGood {
+	return &lastGood{sources: make(map[string]*lastGoodSource)}
+}
+
+// Бд недоступна или не ответила вовремя. Только в этих случаях отдаются сохраненные курсы
+func unavailable(err error) bool {
+	return errors.Is(err, domain.ErrConnLost) || errors.Is(err, domain.ErrDBTimeout)
+}
+
+func (g *lastGood) source(source string) *lastGoodSource {
+	s, ok := g.sources[source]
+	if !ok {
+		s = &lastGoodSource{rates: make(map[string]domain.CurrModel), overrides: make(map[string]domain.RateOverride)}
+		g.sources[source] = s
+	}
+	return s
+}
+
+// Замена курсов источника после записи снимка. Ручные курсы сохраняются
+func (g *lastGood) storeRates(source string, rates []domain.CurrModel) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := g.source(source)
+	clear(s.rates)
+	for _, c := range rates {
+		s.rates[c.Code] = c
+	}
+}
+
+// Удаление курсов источника, когда неизвестно, какие курсы действуют. Ручные курсы сохраняются
+func (g *lastGood) clearRates(source string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	clear(g.source(source).rates)
+}
+
+// Замена всех курсов и ручных курсов источника после чтения '/getAll'
+func (g *lastGood) storeSource(source string, rates []domain.CurrModel, overrides []domain.RateOverride) {
+	g.storeRates(source, rates)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := g.source(source)
+	clear(s.overrides)
+	for _, o := range overrides {
+		s.overrides[o.Code] = o
+	}
+}
+
+// Замена курса и ручного курса валюты после чтения '/convert'. Пустые значения удаляют валюту
+func (g *lastGood) storeRate(source string, code string, curr domain.CurrModel, override domain.RateOverride) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := g.source(source)
+	if curr.Name != "" {
+		s.rates[code] = curr
+	} else {
+		delete(s.rates, code)
+	}
+	if override.Code != "" {
+		s.overrides[code] = override
+	} else {
+		delete(s.overrides, code)
+	}
+}
+
+// Сохраненные курсы источника по коду валюты и действующие ручные курсы. ok ложно, если курсов источника нет
+func (g *lastGood) get(source string) (rates []domain.CurrModel, overrides []domain.RateOverride, ok bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	s, ok := g.sources[source]
+	if !ok || len(s.rates)+len(s.overrides) == 0 {
+		return nil, nil, false
+	}
+	rates = slices.SortedFunc(maps.Values(s.rates), func(a, b domain.CurrModel) int { return strings.Compare(a.Code, b.Code) })
+	return rates, slices.Collect(maps.Values(s.overrides)), true
+}
+
+// Сохраненный курс валюты и ее ручной курс
+func (g *lastGood) rate(source string, code string) (curr domain.CurrModel, override domain.RateOverride, ok bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	s, ok := g.sources[source]
+	if !ok {
+		return curr, override, false
+	}
+	curr, found := s.rates[code]
+	override, overridden := s.overrides[code]
+	if override.Expired(time.Now()) {
+		override = domain.RateOverride{}
+	}
+	return curr, override, found || overridden
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"main/internal/pkg/domain"
+	"os"
+	"time"
+)
+
+// Время на освобождение аренды при остановке сервиса
+const releaseTimeout = 5 * time.Second
+
+// Идентификатор реплики в выборах лидера: имя хоста и случайный суффикс, чтобы перезапущенный процесс
+// не продлевал аренду прежнего
+func newHolder() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "replica"
+	}
+	return newID(host)
+}
+
+// Получение или продление аренды лидерства. Возвращает true, если реплика - лидер.
+// Токен аренды сохраняется для проверки перед записью обновлений
+func (a *API) AcquireLeadership(ttl time.Duration) (leader bool, err error) {
+	token, err := a.LeaseHandler.Service.AcquireLease(a.mainCtx, a.holder, ttl)
+	if err != nil {
+		return false, err
+	}
+	if prev := a.fence.Swap(token); token != 0 && prev != token {
+		logger.Printf("Replica %s holds leader lease with fencing token %d", a.holder, token)
+	}
+	return token != 0, nil
+}
+
+// Отказ от лидерства. Аренда освобождается, чтобы другая реплика продолжила обновление без ожидания истечения
+func (a *API) ReleaseLeadership() error {
+	if a.fence.Swap(0) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	return a.LeaseHandler.Service.ReleaseLease(ctx, a.holder)
+}
+
+// Проверка токена ограждения перед записью обновления источника. Запись отклоняется, если реплика
+// не получала аренду или аренда уже перешла к другой реплике, например после паузы процесса дольше срока аренды.
+// Снимок курсов дополнительно несет токен, который бд сверяет в транзакции записи, см. domain.Snapshot.Fence.
+// Без выборов лидера проверка не выполняется
+func (a *API) checkFence() error {
+	if !a.election {
+		return nil
+	}
+	token := a.fence.Load()
+	if token == 0 {
+		return domain.ErrNotLeader
+	}
+	valid, err := a.LeaseHandler.Service.CheckLease(a.mainCtx, token)
+	if err != nil {
+		return dbWriteErr(err)
+	}
+	if !valid {
+		a.fence.CompareAndSwap(token, 0)
+		return domain.ErrNotLeader
+	}
+	return nil
+}
+
+// Реплика обновляет источники: выборы лидера выключены или реплика держит аренду
+func (a *API) isLeader() bool {
+	return !a.election || a.fence.Load() != 0
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// Пауза перед повторным запросом источника по требованию после ошибки источника
+const fetchRetryDelay = time.Minute
+
+// Наибольшее количество отметок. Коды валют приходят из запросов, поэтому отметки не должны расти без предела
+const missingLimit = 10000
+
+// Валюты, которых нет в источнике, и источники, запрос к которым не удался.
+// Пока запись не истекла, источник не запрашивается по требованию повторно
+type missingCache struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func newMissingCache() *missingCache {
+	return &missingCache{until: make(map[string]time.Time)}
+}
+
+// Отметка на срок ttl. При переполнении удаляются истекшие отметки, а если их нет - истекающая раньше всех
+func (m *missingCache) add(key string, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if _, ok := m.until[key]; !ok && len(m.until) >= missingLimit {
+		oldest := ""
+		for k, until := range m.until {
+			if now.After(until) {
+				delete(m.until, k)
+			} else if oldest == "" || until.Before(m.until[oldest]) {
+				oldest = k
+			}
+		}
+		if len(m.until) >= missingLimit {
+			delete(m.until, oldest)
+		}
+	}
+	m.until[key] = now.Add(ttl)
+}
+
+func (m *missingCache) has(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	until, ok := m.until[key]
+	if ok && time.Now().After(until) {
+		delete(m.until, key)
+		return false
+	}
+	return ok
+}
+
+// Запрос источника по требованию, когда в бд нет запрошенной валюты (code) или курсов источника (пустой code).
+// Одновременные запросы к источнику объединяются в один и ждут его не дольше fetchWait, запрос продолжается в фоне.
+// Источник запрашивает только лидер, чтобы реплики не расходовали квоту источника, и не чаще fetchInterval.
+// Возвращает true, если курсы источника обновлены и валюту нужно искать снова
+func (a *API) fetchOnDemand(source string, code string) bool {
+	defaultMessage := "fetchOnDemand: "
+	if !a.onDemand || a.sourceLinks[source] == "" || !a.isLeader() {
+		return false
+	}
+	if a.missing.has(source) || a.missing.has(source+":"+code) {
+		return false
+	}
+	ch := a.fetches.DoChan(source, func() (interface{}, error) {
+		logger.Printf("%sRates of source %s are missing in db (currency %q), fetching source", defaultMessage, source, code)
+		err := a.FetchAndUpdateCurrs(source, time.Now().In(a.timeLoc).AddDate(0, 0, -1))
+		if err != nil {
+			logger.Printf("%sCannot fetch source %s. Retry in %s. Error: %s", defaultMessage, source, fetchRetryDelay, err.Error())
+			a.missing.add(source, fetchRetryDelay)
+			return nil, err
+		}
+		//Курсы только что обновлены, следующий запрос по требованию не раньше fetchInterval
+		a.missing.add(source, a.fetchInterval)
+		return nil, nil
+	})
+	select {
+	case res := <-ch:
+		return res.Err == nil
+	case <-time.After(a.fetchWait):
+		logger.Printf("%sSource %s is not fetched in %s, answering without it", defaultMessage, source, a.fetchWait)
+		return false
+	}
+}
+
+// Отметка валюты, которой нет в источнике и после запроса по требованию
+func (a *API) markMissing(source string, code string) {
+	logger.Printf("fetchOnDemand: Source %s does not publish %s, not fetching it for %s", source, code, a.missingTTL)
+	a.missing.add(source+":"+code, a.missingTTL)
+}
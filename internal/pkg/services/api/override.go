@@ -0,0 +1,215 @@
+package api
+
+import (
+	"main/internal/pkg/domain"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Количество записей журнала по умолчанию
+const defaultAuditLimit = 100
+
+// Тело запроса установки ручного курса
+type OverrideRequest struct {
+	Source    string `json:"source"`
+	Code      string `json:"code"`
+	RatioBuy  string `json:"ratio_buy"`
+	RatioSell string `json:"ratio_sell,omitempty"`
+	Reason    string `json:"reason"`
+	//Время окончания действия в RFC 3339, например 2024-01-10T00:00:00+07:00
+	Expires string `json:"expires,omitempty"`
+}
+
+// Проверка запроса ручного курса. Курс продажи по умолчанию равен курсу покупки
+func (a *API) checkOverride(req OverrideRequest) (o domain.RateOverride, err error) {
+	base, ok := a.baseCurrencies[req.Source]
+	if !ok {
+		return o, unknownSource(req.Source)
+	}
+	if !regexp.MustCompile(`^[A-Z]{3}$`).MatchString(req.Code) || req.Code == base {
+		return o, invalid("wrong curr provided: " + req.Code)
+	}
+	if req.Reason == "" {
+		return o, invalid("reason required")
+	}
+	if req.RatioSell == "" {
+		req.RatioSell = req.RatioBuy
+	}
+	for _, v := range []string{req.RatioBuy, req.RatioSell} {
+		if r, err := parseRatio(v); err != nil || r <= 0 {
+			return o, invalid("wrong ratio " + v + " provided")
+		}
+	}
+	now := time.Now().In(a.timeLoc)
+	if req.Expires != "" {
+		exp, err := time.Parse(time.RFC3339, req.Expires)
+		if err != nil {
+			return o, invalid("wrong expires " + req.Expires + " provided. use RFC 3339")
+		}
+		if !exp.After(now) {
+			return o, invalid("expires " + req.Expires + " is in the past")
+		}
+	}
+	return domain.RateOverride{
+		Source:    req.Source,
+		Code:      req.Code,
+		RatioBuy:  req.RatioBuy,
+		RatioSell: req.RatioSell,
+		Reason:    req.Reason,
+		Created:   now.Format(time.RFC3339),
+		Expires:   req.Expires,
+	}, nil
+}
+
+// Запись в журнал изменений. Ошибка журнала не отменяет изменение, но попадает в лог
+func (a *API) audit(e domain.AuditEntry) {
+	e.Time = time.Now().In(a.timeLoc).Format(time.RFC3339)
+	if err := a.AuditHandler.Service.AppendAudit(a.mainCtx, e); err != nil {
+		logger.Printf("ALERT audit: Cannot write audit entry %s %s:%s by %s. Error: %s", e.Action, e.Source, e.Code, e.Actor, err.Error())
+	}
+}
+
+// Получение действующего ручного курса. Если курса нет или срок истек, возвращается курс с пустым Code
+func (a *API) activeOverride(source string, code string) (o domain.RateOverride, err error) {
+	o, err = a.OverrideHandler.Service.GetOverride(a.mainCtx, source, code)
+	if err != nil || o.Code == "" || o.Expired(time.Now()) {
+		return domain.RateOverride{}, err
+	}
+	return o, nil
+}
+
+// Замена курсов валюты ручным курсом. Если валюты нет в бд, она создается из ручного курса
+// с датой его создания, а если время создания не разобрать (например, в загруженной копии), - с текущей датой
+func applyOverride(curr domain.CurrModel, o domain.RateOverride) domain.CurrModel {
+	if curr.Name == "" {
+		created, err := time.Parse(time.RFC3339, o.Created)
+		if err != nil {
+			created = time.Now()
+		}
+		curr = domain.ToCurrModel(created.Format(time.DateOnly), o.Source, o.Code, o.Code, "", "")
+	}
+	curr.RatioBuy = o.RatioBuy
+	curr.RatioSell = o.RatioSell
+	curr.Override = &o
+	return curr
+}
+
+// Метод реализует запрос POST '/admin/overrides'. Создает предложение установить или заменить ручной курс
+func (a *API) ProposeOverride(req OverrideRequest, identity string) (ans domain.Proposal, err error) {
+	o, err := a.checkOverride(req)
+	if err != nil {
+		return ans, err
+	}
+	o.Author = identity
+	return a.propose(domain.Proposal{Kind: domain.ProposalOverrideSet, Source: o.Source, Code: o.Code,
+		Override: &o, Reason: o.Reason}, identity)
+}
+
+// Метод реализует запрос DELETE '/admin/overrides'. Создает предложение удалить ручной курс
+func (a *API) ProposeOverrideDelete(source string, code string, reason string, identity string) (ans domain.Proposal, err error) {
+	if reason == "" {
+		return ans, invalid("reason required")
+	}
+	before, err := a.OverrideHandler.Service.GetOverride(a.mainCtx, source, code)
+	if err != nil {
+		logger.Println("ProposeOverrideDelete: Internal db error. Err:" + err.Error())
+		return ans, dbReadErr(err)
+	}
+	if before.Code == "" {
+		return ans, notFound("no override for " + source + ":" + code)
+	}
+	return a.propose(domain.Proposal{Kind: domain.ProposalOverrideDelete, Source: source, Code: code, Reason: reason}, identity)
+}
+
+// Установка ручного курса по одобренному предложению
+func (a *API) setOverride(p domain.Proposal) (err error) {
+	o := *p.Override
+	before, err := a.OverrideHandler.Service.GetOverride(a.mainCtx, o.Source, o.Code)
+	if err == nil {
+		err = a.OverrideHandler.Service.StoreOverride(a.mainCtx, o)
+	}
+	if err != nil {
+		logger.Println("setOverride: Error adding data to db. Error:" + err.Error())
+		return dbWriteErr(err)
+	}
+	e := domain.AuditEntry{Actor: p.ProposedBy, ApprovedBy: p.ResolvedBy, Proposal: p.ID, Action: "override_set",
+		Source: o.Source, Code: o.Code, Reason: o.Reason, After: &o}
+	if before.Code != "" {
+		e.Before = &before
+	}
+	a.audit(e)
+	logger.Printf("Override %s:%s set to %s/%s by %s, approved by %s. Reason: %s", o.Source, o.Code, o.RatioBuy, o.RatioSell, p.ProposedBy, p.ResolvedBy, o.Reason)
+	return nil
+}
+
+// Удаление ручного курса по одобренному предложению. Снова отдается сохраненный курс
+func (a *API) deleteOverride(p domain.Proposal) (err error) {
+	defaultMessage := "deleteOverride: "
+	before, err := a.OverrideHandler.Service.GetOverride(a.mainCtx, p.Source, p.Code)
+	if err != nil {
+		logger.Println(defaultMessage + "Internal db error. Err:" + err.Error())
+		return dbReadErr(err)
+	}
+	if before.Code == "" {
+		return notFound("no override for " + p.Source + ":" + p.Code)
+	}
+	if err := a.OverrideHandler.Service.DeleteOverride(a.mainCtx, p.Source, p.Code); err != nil {
+		logger.Println(defaultMessage + "Error deleting data from db. Error:" + err.Error())
+		return &apiError{"", "cannot delete data from db now", err}
+	}
+	a.audit(domain.AuditEntry{Actor: p.ProposedBy, ApprovedBy: p.ResolvedBy, Proposal: p.ID, Action: "override_delete",
+		Source: p.Source, Code: p.Code, Reason: p.Reason, Before: &before})
+	logger.Printf("Override %s:%s deleted by %s, approved by %s. Reason: %s", p.Source, p.Code, p.ProposedBy, p.ResolvedBy, p.Reason)
+	return nil
+}
+
+// Удаление ручных курсов источника с истекшим сроком. Вызывается при обновлении источника
+func (a *API) expireOverrides(source string) {
+	defaultMessage := "expireOverrides: "
+	overrides, err := a.OverrideHandler.Service.GetOverrides(a.mainCtx, source)
+	if err != nil {
+		logger.Println(defaultMessage + "Internal db error. Err:" + err.Error())
+		return
+	}
+	for i, o := range overrides {
+		if !o.Expired(time.Now()) {
+			continue
+		}
+		if err := a.OverrideHandler.Service.DeleteOverride(a.mainCtx, source, o.Code); err != nil {
+			logger.Println(defaultMessage + "Error deleting data from db. Error:" + err.Error())
+			return
+		}
+		a.audit(domain.AuditEntry{Actor: "system", Action: "override_expire", Source: source, Code: o.Code,
+			Reason: "expired at " + o.Expires, Before: &overrides[i]})
+	}
+}
+
+// Метод реализует запрос GET '/admin/overrides'. Возвращает ручные курсы источника, включая истекшие, но еще не удаленные
+func (a *API) GetOverrides(source string) (ans []domain.RateOverride, err error) {
+	if len(source) == 0 {
+		source = defaultSource
+	}
+	ans, err = a.OverrideHandler.Service.GetOverrides(a.mainCtx, source)
+	if err != nil {
+		logger.Printf("GetOverrides: Check logs for DB. Error:%e", err)
+		return nil, dbReadErr(err)
+	}
+	return ans, nil
+}
+
+// Метод реализует запрос '/admin/audit'. Возвращает последние записи журнала изменений
+func (a *API) GetAudit(limit string) (ans []domain.AuditEntry, err error) {
+	n := defaultAuditLimit
+	if limit != "" {
+		if n, err = strconv.Atoi(limit); err != nil || n <= 0 {
+			return nil, invalid("wrong limit " + limit + " provided")
+		}
+	}
+	ans, err = a.AuditHandler.Service.GetAudit(a.mainCtx, n)
+	if err != nil {
+		logger.Printf("GetAudit: Check logs for DB. Error:%e", err)
+		return nil, dbReadErr(err)
+	}
+	return ans, nil
+}
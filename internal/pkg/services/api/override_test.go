@@ -0,0 +1,44 @@
+package api
+
+import (
+	"main/internal/pkg/domain"
+	"testing"
+	"time"
+)
+
+func TestGetAllOverrideOnly(t *testing.T) {
+	a := newTestAPI(t)
+	o := domain.RateOverride{Source: SourceRU, Code: "USD", RatioBuy: "100", RatioSell: "101", Reason: "market closed",
+		Author: "alice", Created: "2024-01-02T10:00:00Z"}
+	if err := a.OverrideHandler.Service.StoreOverride(a.mainCtx, o); err != nil {
+		t.Fatal(err)
+	}
+	all, _, err := a.GetAll(SourceRU)
+	if err != nil || len(all) != 1 {
+		t.Fatalf("expected override-only currency, got %+v %v", all, err)
+	}
+	if c := all[0]; c.Code != "USD" || c.RatioBuy != "100" || c.Date != "2024-01-02" || c.Override == nil {
+		t.Fatalf("unexpected currency %+v", c)
+	}
+}
+
+func TestGetAllEmptySource(t *testing.T) {
+	a := newTestAPI(t)
+	if _, _, err := a.GetAll(SourceRU); ErrorCode(err) != CodeNotFound {
+		t.Fatalf("expected NOT_FOUND without rates and overrides, got %v", err)
+	}
+}
+
+func TestApplyOverrideCreated(t *testing.T) {
+	today := time.Now().Format(time.DateOnly)
+	for created, date := range map[string]string{
+		"2024-01-02T23:30:00+07:00": "2024-01-02",
+		"2024-01":                   today,
+		"":                          today,
+	} {
+		c := applyOverride(domain.CurrModel{}, domain.RateOverride{Source: SourceRU, Code: "USD", RatioBuy: "1", Created: created})
+		if c.Date != date || c.Name != "USD" {
+			t.Errorf("created %q: expected date %s, got %+v", created, date, c)
+		}
+	}
+}
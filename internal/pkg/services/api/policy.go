@@ -0,0 +1,116 @@
+package api
+
+import (
+	"main/internal/pkg/domain"
+	"main/internal/pkg/services/fetcher"
+	"main/internal/pkg/services/parser"
+	"sort"
+	"time"
+)
+
+// Глубина первой загрузки истории ключевой ставки в днях
+const policyHistoryDays = 365
+
+// Тело ответа метода '/rates/policy'
+type PolicyRatesResponse struct {
+	Source string `json:"source"`
+	//Ставка, действующая на текущую дату
+	Current *domain.PolicyRate `json:"current,omitempty"`
+	//История изменений ставки по датам вступления в силу
+	History []domain.PolicyRate `json:"history"`
+}
+
+// Получение истории ключевой ставки источника с даты последнего изменения и запись в бд.
+// В бд хранятся только даты изменения ставки
+func (a *API) FetchAndUpdatePolicyRates(source string) (err error) {
+	defaultMessage := "FetchAndUpdatePolicyRates: "
+	stored, err := a.PolicyHandler.Service.GetPolicyRates(a.mainCtx, source)
+	if err != nil {
+		logger.Println(defaultMessage + "Internal db error. Err:" + err.Error())
+		return err
+	}
+	from := time.Now().In(a.timeLoc).AddDate(0, 0, -policyHistoryDays)
+	if len(stored) != 0 {
+		if last, err := time.Parse(time.DateOnly, stored[len(stored)-1].Date); err == nil {
+			from = last
+		}
+	}
+	GetFetcher := &Fetcher{fetcher.NewFetcher(from, a.timeLoc, a.timeout, a.definitions)}
+	body, err := GetFetcher.Service.FetchPolicyFromSource(source, a.sourceAuth, a.policyLinks)
+	if err != nil {
+		return err
+	}
+	ParseHandler := &ParseHandler{parser.NewParser("")}
+	fetched, err := ParseHandler.Service.ParsePolicyRates(source, body)
+	if err != nil {
+		return &domain.UpstreamError{Source: source, Class: domain.UpstreamMalformed, Err: err}
+	}
+	if err := a.checkFence(); err != nil {
+		return err
+	}
+	err = a.PolicyHandler.Service.StorePolicyRates(a.mainCtx, source, mergePolicyRates(stored, fetched))
+	if err != nil {
+		logger.Println(defaultMessage + "Error adding data to db. Error:" + err.Error())
+		return dbWriteErr(err)
+	}
+	return nil
+}
+
+// Объединение сохраненной и полученной истории. Источники публикуют ставку за каждый день,
+// поэтому остаются только даты, в которые ставка изменилась
+func mergePolicyRates(stored []domain.PolicyRate, fetched []domain.PolicyRate) []domain.PolicyRate {
+	byDate := make(map[string]domain.PolicyRate, len(stored)+len(fetched))
+	for _, r := range stored {
+		byDate[r.Date] = r
+	}
+	for _, r := range fetched {
+		byDate[r.Date] = r
+	}
+	all := make([]domain.PolicyRate, 0, len(byDate))
+	for _, r := range byDate {
+		all = append(all, r)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Date < all[j].Date })
+	res := make([]domain.PolicyRate, 0, len(all))
+	for _, r := range all {
+		if len(res) != 0 && res[len(res)-1].Rate == r.Rate {
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// Метод реализует запрос '/rates/policy'. Возвращает действующую ставку и историю изменений,
+// при необходимости ограниченную датами from и to (yyyy-mm-dd)
+func (a *API) GetPolicyRates(source string, from string, to string) (ans PolicyRatesResponse, err error) {
+	defaultMessage := "GetPolicyRates: "
+	if len(source) == 0 {
+		source = defaultSource
+	}
+	if a.policyLinks[source] == "" {
+		return ans, notFound("no policy rates for source " + source)
+	}
+	for _, d := range []string{from, to} {
+		if _, err := time.Parse(time.DateOnly, d); d != "" && err != nil {
+			return ans, invalid("wrong date " + d + " provided. use yyyy-mm-dd")
+		}
+	}
+	rates, err := a.PolicyHandler.Service.GetPolicyRates(a.mainCtx, source)
+	if err != nil {
+		logger.Printf(defaultMessage+"Check logs for DB. Error:%e", err)
+		return ans, dbReadErr(err)
+	}
+	ans.Source = source
+	ans.History = make([]domain.PolicyRate, 0, len(rates))
+	today := time.Now().In(a.timeLoc).Format(time.DateOnly)
+	for i, r := range rates {
+		if r.Date <= today {
+			ans.Current = &rates[i]
+		}
+		if (from == "" || r.Date >= from) && (to == "" || r.Date <= to) {
+			ans.History = append(ans.History, r)
+		}
+	}
+	return ans, nil
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"main/internal/pkg/domain"
+	"time"
+)
+
+// Создание предложения изменить курсы. Изменение применяется после одобрения другим администратором
+func (a *API) propose(p domain.Proposal, identity string) (domain.Proposal, error) {
+	now := time.Now().In(a.timeLoc)
+	p.ID = newID("P")
+	p.ProposedBy = identity
+	p.Created = now.Format(time.RFC3339)
+	p.Expires = now.Add(a.proposalTTL).Format(time.RFC3339)
+	p.Status = domain.ProposalPending
+	if err := a.ProposalHandler.Service.StoreProposal(a.mainCtx, p); err != nil {
+		logger.Println("propose: Cannot store proposal. Error:" + err.Error())
+		return p, dbWriteErr(err)
+	}
+	logger.Printf("Proposal %s (%s %s %s) created by %s, awaits approval until %s", p.ID, p.Kind, p.Source, p.Code, identity, p.Expires)
+	return p, nil
+}
+
+// Отметка предложений с истекшим сроком. Возвращает предложение с актуальным статусом
+func (a *API) expireProposal(p domain.Proposal, now time.Time) domain.Proposal {
+	exp, err := time.Parse(time.RFC3339, p.Expires)
+	if p.Status != domain.ProposalPending || err != nil || now.Before(exp) {
+		return p
+	}
+	expired := p
+	expired.Status = domain.ProposalExpired
+	expired.ResolvedAt = exp.Format(time.RFC3339)
+	resolved, err := a.ProposalHandler.Service.ResolveProposal(a.mainCtx, expired)
+	if err != nil {
+		logger.Println("expireProposal: Cannot store proposal. Error:" + err.Error())
+	}
+	if !resolved && err == nil {
+		//Решение принято другим запросом, актуальный статус читается из бд
+		if stored, err := a.ProposalHandler.Service.GetProposal(a.mainCtx, p.ID); err == nil && stored.ID != "" {
+			return stored
+		}
+	}
+	return expired
+}
+
+// Метод реализует запрос '/admin/proposals'. Возвращает предложения со статусом status (все при пустом status).
+// Предложения с истекшим сроком отмечаются expired
+func (a *API) GetProposals(status string) (ans []domain.Proposal, err error) {
+	all, err := a.ProposalHandler.Service.GetProposals(a.mainCtx)
+	if err != nil {
+		logger.Printf("GetProposals: Check logs for DB. Error:%e", err)
+		return nil, dbReadErr(err)
+	}
+	now := time.Now()
+	ans = make([]domain.Proposal, 0, len(all))
+	for _, p := range all {
+		p = a.expireProposal(p, now)
+		if status == "" || p.Status == status {
+			ans = append(ans, p)
+		}
+	}
+	return ans, nil
+}
+
+// Получение предложения, ожидающего решения
+func (a *API) pendingProposal(id string) (p domain.Proposal, err error) {
+	p, err = a.ProposalHandler.Service.GetProposal(a.mainCtx, id)
+	if err != nil {
+		logger.Printf("pendingProposal: Check logs for DB. Error:%e", err)
+		return p, dbReadErr(err)
+	}
+	if p.ID == "" {
+		return p, notFound("no proposal " + id)
+	}
+	if p = a.expireProposal(p, time.Now()); p.Status != domain.ProposalPending {
+		return p, invalidState("proposal " + id + " is already " + p.Status)
+	}
+	return p, nil
+}
+
+// Метод реализует запрос '/admin/proposals/approve'. Одобрить предложение может только другой администратор.
+// Статус меняется на approved до применения изменения, поэтому два одновременных одобрения не применят его дважды.
+// Если изменение не применилось, предложение снова ожидает решения
+func (a *API) ApproveProposal(id string, identity string) (ans domain.Proposal, err error) {
+	pending, err := a.pendingProposal(id)
+	if err != nil {
+		return ans, err
+	}
+	if pending.ProposedBy == identity {
+		return ans, invalidState("proposal " + id + " must be approved by another admin")
+	}
+	p, err := a.resolveProposal(pending, domain.ProposalApproved, identity)
+	if err != nil {
+		return ans, err
+	}
+	switch p.Kind {
+	case domain.ProposalOverrideSet:
+		err = a.setOverride(p)
+	case domain.ProposalOverrideDelete:
+		err = a.deleteOverride(p)
+	case domain.ProposalQuarantineRelease:
+		err = a.releaseQuarantine(p)
+	case domain.ProposalRollback:
+		err = a.rollbackSnapshot(p)
+	default:
+		err = corruptData("unknown proposal kind " + string(p.Kind))
+	}
+	if err != nil {
+		if serr := a.ProposalHandler.Service.StoreProposal(a.mainCtx, pending); serr != nil {
+			logger.Println("ApproveProposal: Cannot return proposal to pending. Error:" + serr.Error())
+		}
+		return ans, err
+	}
+	return p, nil
+}
+
+// Метод реализует запрос '/admin/proposals/reject'. Отклонить предложение может любой администратор, включая автора
+func (a *API) RejectProposal(id string, identity string) (ans domain.Proposal, err error) {
+	p, err := a.pendingProposal(id)
+	if err != nil {
+		return ans, err
+	}
+	return a.resolveProposal(p, domain.ProposalRejected, identity)
+}
+
+// Решение по предложению. Статус меняется, только если предложение еще ожидает решения:
+// из одновременных запросов одобрения и отклонения выполняется один
+func (a *API) resolveProposal(p domain.Proposal, status string, identity string) (domain.Proposal, error) {
+	p.Status = status
+	p.ResolvedBy = identity
+	p.ResolvedAt = time.Now().In(a.timeLoc).Format(time.RFC3339)
+	resolved, err := a.ProposalHandler.Service.ResolveProposal(a.mainCtx, p)
+	if err != nil {
+		logger.Println("resolveProposal: Cannot store proposal. Error:" + err.Error())
+		return p, dbWriteErr(err)
+	}
+	if !resolved {
+		return p, invalidState("proposal " + p.ID + " is already resolved")
+	}
+	logger.Printf("Proposal %s (%s %s %s) by %s %s by %s", p.ID, p.Kind, p.Source, p.Code, p.ProposedBy, status, identity)
+	return p, nil
+}
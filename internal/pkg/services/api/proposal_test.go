@@ -0,0 +1,101 @@
+package api
+
+import (
+	"main/internal/pkg/domain"
+	"sync"
+	"testing"
+	"time"
+)
+
+func proposeOverride(t *testing.T, a *API) domain.Proposal {
+	t.Helper()
+	p, err := a.ProposeOverride(OverrideRequest{Source: SourceRU, Code: "USD", RatioBuy: "100", Reason: "market closed"}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func proposalStatus(t *testing.T, a *API, id string) string {
+	t.Helper()
+	p, err := a.ProposalHandler.Service.GetProposal(a.mainCtx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Status
+}
+
+func TestApproveOwnProposal(t *testing.T) {
+	a := newTestAPI(t)
+	p := proposeOverride(t, a)
+	if _, err := a.ApproveProposal(p.ID, "alice"); ErrorCode(err) != CodeInvalidState {
+		t.Fatalf("expected author unable to approve, got %v", err)
+	}
+	if status := proposalStatus(t, a, p.ID); status != domain.ProposalPending {
+		t.Fatalf("expected proposal still pending, got %s", status)
+	}
+	if o, _ := a.OverrideHandler.Service.GetOverride(a.mainCtx, SourceRU, "USD"); o.Code != "" {
+		t.Fatalf("expected no override, got %+v", o)
+	}
+}
+
+func TestApproveExpiredProposal(t *testing.T) {
+	a := newTestAPI(t)
+	p := proposeOverride(t, a)
+	p.Expires = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	if err := a.ProposalHandler.Service.StoreProposal(a.mainCtx, p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ApproveProposal(p.ID, "bob"); ErrorCode(err) != CodeInvalidState {
+		t.Fatalf("expected expired proposal rejected, got %v", err)
+	}
+	if status := proposalStatus(t, a, p.ID); status != domain.ProposalExpired {
+		t.Fatalf("expected proposal expired, got %s", status)
+	}
+}
+
+func TestApproveFailedApplyStaysPending(t *testing.T) {
+	a := newTestAPI(t)
+	quarantineRates(t, a, "Q-1", testRates("2024-01-01", "120", "USD"))
+	p, err := a.ProposeQuarantineRelease("Q-1", "checked", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Снимок отклонен до одобрения предложения, записать его нельзя
+	if _, err := a.RejectQuarantine("Q-1", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ApproveProposal(p.ID, "bob"); err == nil {
+		t.Fatal("expected release of rejected snapshot to fail")
+	}
+	if status := proposalStatus(t, a, p.ID); status != domain.ProposalPending {
+		t.Fatalf("expected proposal back to pending, got %s", status)
+	}
+}
+
+func TestApproveConcurrently(t *testing.T) {
+	a := newTestAPI(t)
+	p := proposeOverride(t, a)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	approved := 0
+	for _, admin := range []string{"bob", "carol", "dave", "eve"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := a.ApproveProposal(p.ID, admin); err == nil {
+				mu.Lock()
+				approved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if approved != 1 {
+		t.Fatalf("expected exactly one approval, got %d", approved)
+	}
+	entries, err := a.AuditHandler.Service.GetAudit(a.mainCtx, 10)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected override applied once, got %+v %v", entries, err)
+	}
+}
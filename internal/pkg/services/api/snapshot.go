@@ -0,0 +1,146 @@
+package api
+
+import (
+	"errors"
+	"main/internal/pkg/domain"
+	"time"
+)
+
+// Запись курсов новым снимком источника и его активация. Если курсы совпадают с действующим снимком,
+// снимок не записывается и возвращается действующий. После записи удаляются снимки сверх snapshotKeep
+func (a *API) storeSnapshot(source string, id string, origin string, rates []domain.CurrModel) (snap domain.Snapshot, err error) {
+	//HSET без полей не выполняется, а пустой снимок оставил бы источник без курсов
+	if len(rates) == 0 {
+		return snap, invalidState("no rates to store for source " + source)
+	}
+	snap = a.newSnapshot(source, id, origin, rates)
+	//Бд сверяет токен в транзакции записи, поэтому устаревший лидер не перезапишет снимок нового
+	if a.election {
+		snap.Fence = a.fence.Load()
+	}
+	snaps, err := a.DatabaseHandler.Service.GetSnapshots(a.mainCtx, source)
+	if err != nil {
+		logger.Println("storeSnapshot: Cannot read snapshots. Error:" + err.Error())
+		return snap, dbWriteErr(err)
+	}
+	for _, s := range snaps {
+		if s.Active && s.Hash == snap.Hash {
+			a.lastGood.storeRates(source, rates)
+			logger.Printf("Rates of source %s did not change, snapshot %s stays active", source, s.ID)
+			return s, nil
+		}
+	}
+	err = a.DatabaseHandler.Service.StoreSnapshot(a.mainCtx, snap, rates)
+	if errors.Is(err, domain.ErrNotLeader) {
+		a.fence.CompareAndSwap(snap.Fence, 0)
+		logger.Printf("Snapshot %s of source %s rejected: fencing token %d is stale", id, source, snap.Fence)
+		return snap, domain.ErrNotLeader
+	}
+	if err != nil {
+		logger.Println("storeSnapshot: Error adding data to db. Error:" + err.Error())
+		return snap, dbWriteErr(err)
+	}
+	a.lastGood.storeRates(source, rates)
+	logger.Printf("Snapshot %s of source %s with %d rates activated", id, source, len(rates))
+	a.pruneSnapshots(source)
+	return snap, nil
+}
+
+// Запись курсов снимком источника без активации. Действующий снимок и сохраненные курсы не меняются
+func (a *API) addSnapshot(source string, id string, origin string, rates []domain.CurrModel) (snap domain.Snapshot, err error) {
+	if len(rates) == 0 {
+		return snap, invalidState("no rates to store for source " + source)
+	}
+	snap = a.newSnapshot(source, id, origin, rates)
+	if err = a.DatabaseHandler.Service.AddSnapshot(a.mainCtx, snap, rates); err != nil {
+		logger.Println("addSnapshot: Error adding data to db. Error:" + err.Error())
+		return snap, dbWriteErr(err)
+	}
+	logger.Printf("Snapshot %s of source %s with %d rates stored without activation", id, source, len(rates))
+	return snap, nil
+}
+
+// Описание нового снимка курсов. Дата снимка - последняя дата курсов
+func (a *API) newSnapshot(source string, id string, origin string, rates []domain.CurrModel) domain.Snapshot {
+	snap := domain.Snapshot{
+		ID:      id,
+		Source:  source,
+		Created: time.Now().In(a.timeLoc).Format(time.RFC3339),
+		Origin:  origin,
+		Hash:    domain.RatesHash(rates),
+	}
+	for _, c := range rates {
+		if c.Date > snap.Date {
+			snap.Date = c.Date
+		}
+	}
+	return snap
+}
+
+// Удаление снимков источника сверх snapshotKeep. Ошибка не мешает обновлению и только пишется в лог
+func (a *API) pruneSnapshots(source string) {
+	if a.snapshotKeep <= 0 {
+		return
+	}
+	removed, err := a.DatabaseHandler.Service.PruneSnapshots(a.mainCtx, source, a.snapshotKeep)
+	if err != nil {
+		logger.Println("pruneSnapshots: Cannot remove old snapshots. Error:" + err.Error())
+		return
+	}
+	if len(removed) != 0 {
+		logger.Printf("Removed %d old snapshots of source %s", len(removed), source)
+	}
+}
+
+// Метод реализует запрос '/admin/snapshots'. Возвращает снимки источника от новых к старым, действующий отмечен active
+func (a *API) GetSnapshots(source string) (ans []domain.Snapshot, err error) {
+	if len(source) == 0 {
+		source = defaultSource
+	}
+	ans, err = a.DatabaseHandler.Service.GetSnapshots(a.mainCtx, source)
+	if err != nil {
+		logger.Printf("GetSnapshots: Check logs for DB. Error:%e", err)
+		return nil, dbReadErr(err)
+	}
+	return ans, nil
+}
+
+// Метод реализует запрос '/admin/snapshots/rollback'. Создает предложение сделать действующим прежний снимок
+func (a *API) ProposeRollback(source string, id string, reason string, identity string) (ans domain.Proposal, err error) {
+	if reason == "" {
+		return ans, invalid("reason required")
+	}
+	snaps, err := a.GetSnapshots(source)
+	if err != nil {
+		return ans, err
+	}
+	for _, s := range snaps {
+		if s.ID != id {
+			continue
+		}
+		if s.Active {
+			return ans, invalidState("snapshot " + id + " is already active")
+		}
+		return a.propose(domain.Proposal{Kind: domain.ProposalRollback, Source: s.Source, Target: id, Reason: reason}, identity)
+	}
+	return ans, notFound("no snapshot " + id + " in source " + source)
+}
+
+// Возврат к прежнему снимку по одобренному предложению
+func (a *API) rollbackSnapshot(p domain.Proposal) (err error) {
+	if err = a.DatabaseHandler.Service.ActivateSnapshot(a.mainCtx, p.Source, p.Target); err != nil {
+		logger.Println("rollbackSnapshot: Cannot activate snapshot. Error:" + err.Error())
+		return err
+	}
+	//Сохраненные курсы должны совпадать с действующим снимком, иначе при недоступной бд отдавались бы курсы до отката
+	rates, err := a.DatabaseHandler.Service.GetSnapshotRates(a.mainCtx, p.Source, p.Target)
+	if err != nil || len(rates) == 0 {
+		a.lastGood.clearRates(p.Source)
+	} else {
+		a.lastGood.storeRates(p.Source, rates)
+	}
+	a.audit(domain.AuditEntry{Actor: p.ProposedBy, ApprovedBy: p.ResolvedBy, Proposal: p.ID, Action: "snapshot_rollback",
+		Source: p.Source, Reason: p.Reason + ". snapshot " + p.Target})
+	logger.Printf("Source %s rolled back to snapshot %s by %s, approved by %s", p.Source, p.Target, p.ProposedBy, p.ResolvedBy)
+	return nil
+}
@@ -0,0 +1,361 @@
+// Пакет backup выгружает снимки курсов, историю ключевых ставок и ручные курсы из хранилища в файл JSON Lines
+// и загружает их обратно. Работает через сервисы domain, поэтому переносит данные между любыми хранилищами
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"main/internal/pkg/domain"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+var logger = log.New(os.Stderr, "backup ", log.LstdFlags)
+
+// Версия формата файла. Файлы версии 1 содержат только снимки и тоже загружаются
+const FormatVersion = 2
+
+// Виды строк файла
+const (
+	RecordHeader   = "header"
+	RecordSnapshot = "snapshot"
+	RecordPolicy   = "policy"
+	RecordOverride = "override"
+)
+
+// Хранилища, данные которых переносит выгрузка
+type Stores struct {
+	Database domain.DatabaseService
+	Policy   domain.PolicyRateService
+	Override domain.OverrideService
+}
+
+// Строка файла. Первая строка - заголовок с версией формата, далее по каждому источнику снимки от старых к новым,
+// история ключевых ставок и ручные курсы
+type Record struct {
+	Type string `json:"type"`
+	//Заголовок: версия формата, время выгрузки и источники
+	Version int      `json:"version,omitempty"`
+	Created string   `json:"created,omitempty"`
+	Sources []string `json:"sources,omitempty"`
+	//Снимок и его курсы. Active отмечает действующий снимок источника
+	Snapshot *domain.Snapshot   `json:"snapshot,omitempty"`
+	Rates    []domain.CurrModel `json:"rates,omitempty"`
+	//История ключевых ставок источника
+	Source      string              `json:"source,omitempty"`
+	PolicyRates []domain.PolicyRate `json:"policy_rates,omitempty"`
+	//Ручной курс
+	Override *domain.RateOverride `json:"override,omitempty"`
+}
+
+// Выгрузка всех снимков, истории ключевых ставок и ручных курсов источников. Снимки неизменяемы, поэтому выгрузка
+// согласована на момент получения списка снимков источника: записанные позже снимки не попадают в файл,
+// действующий снимок - тот, что был при получении списка. Возвращает количество выгруженных снимков
+func Export(ctx context.Context, st Stores, sources []string, w io.Writer) (count int, err error) {
+	sources = slices.Clone(sources)
+	sort.Strings(sources)
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(Record{Type: RecordHeader, Version: FormatVersion, Created: time.Now().Format(time.RFC3339), Sources: sources}); err != nil {
+		return count, err
+	}
+	for _, source := range sources {
+		snaps, err := st.Database.GetSnapshots(ctx, source)
+		if err != nil {
+			return count, fmt.Errorf("cannot list snapshots of %s: %w", source, err)
+		}
+		for i := len(snaps) - 1; i >= 0; i-- {
+			rates, err := st.Database.GetSnapshotRates(ctx, source, snaps[i].ID)
+			if err != nil {
+				return count, fmt.Errorf("cannot read snapshot %s: %w", snaps[i].ID, err)
+			}
+			if err = enc.Encode(Record{Type: RecordSnapshot, Snapshot: &snaps[i], Rates: rates}); err != nil {
+				return count, err
+			}
+			count++
+		}
+		policy, err := st.Policy.GetPolicyRates(ctx, source)
+		if err != nil {
+			return count, fmt.Errorf("cannot read policy rates of %s: %w", source, err)
+		}
+		if len(policy) != 0 {
+			if err = enc.Encode(Record{Type: RecordPolicy, Source: source, PolicyRates: policy}); err != nil {
+				return count, err
+			}
+		}
+		overrides, err := st.Override.GetOverrides(ctx, source)
+		if err != nil {
+			return count, fmt.Errorf("cannot read overrides of %s: %w", source, err)
+		}
+		for i := range overrides {
+			if err = enc.Encode(Record{Type: RecordOverride, Override: &overrides[i]}); err != nil {
+				return count, err
+			}
+		}
+		logger.Printf("Exported %d snapshots, %d policy rates and %d overrides of %s", len(snaps), len(policy), len(overrides), source)
+	}
+	return count, nil
+}
+
+// Открытие файла для чтения. Сжатый gzip файл распаковывается
+func NewReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// Чтение и проверка файла целиком. Ошибка в любой строке отменяет загрузку
+func Read(r io.Reader) (recs []Record, err error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	seen := make(map[string]bool)
+	active := make(map[string]string)
+	for line := 1; ; line++ {
+		var rec Record
+		if err = dec.Decode(&rec); errors.Is(err, io.EOF) && line > 1 {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if line == 1 {
+			if rec.Type != RecordHeader || rec.Version < 1 || rec.Version > FormatVersion {
+				return nil, fmt.Errorf("line 1: expected header of format version 1 to %d", FormatVersion)
+			}
+			continue
+		}
+		switch rec.Type {
+		case RecordPolicy:
+			err = validatePolicy(rec)
+		case RecordOverride:
+			err = validateOverride(rec)
+		default:
+			err = validate(rec)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.Type != RecordSnapshot {
+			recs = append(recs, rec)
+			continue
+		}
+		s := rec.Snapshot
+		if seen[s.Source+" "+s.ID] {
+			return nil, fmt.Errorf("line %d: duplicate snapshot %s", line, s.ID)
+		}
+		seen[s.Source+" "+s.ID] = true
+		if s.Active {
+			if active[s.Source] != "" {
+				return nil, fmt.Errorf("line %d: source %s has two active snapshots %s and %s", line, s.Source, active[s.Source], s.ID)
+			}
+			active[s.Source] = s.ID
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// Проверка строки снимка
+func validate(rec Record) error {
+	s := rec.Snapshot
+	switch {
+	case rec.Type != RecordSnapshot || s == nil:
+		return errors.New("expected snapshot record")
+	case s.ID == "" || s.Source == "":
+		return errors.New("snapshot without id or source")
+	case len(rec.Rates) == 0:
+		return fmt.Errorf("snapshot %s has no rates", s.ID)
+	case s.Count != len(rec.Rates):
+		return fmt.Errorf("snapshot %s has %d rates, expected %d", s.ID, len(rec.Rates), s.Count)
+	}
+	if _, err := time.Parse(time.RFC3339, s.Created); err != nil {
+		return fmt.Errorf("snapshot %s: wrong created %q", s.ID, s.Created)
+	}
+	codes := make(map[string]bool, len(rec.Rates))
+	for _, c := range rec.Rates {
+		if !validCode(c.Code) || codes[c.Code] {
+			return fmt.Errorf("snapshot %s: wrong or duplicate currency code %q", s.ID, c.Code)
+		}
+		codes[c.Code] = true
+		if c.RatioBuy == "" || c.RatioSell == "" {
+			return fmt.Errorf("snapshot %s: currency %s without rates", s.ID, c.Code)
+		}
+	}
+	return nil
+}
+
+// Код валюты, который мог записать парсер источника
+func validCode(code string) bool {
+	return code != "" && domain.NormalizeCurrCode(code) == code
+}
+
+// Проверка строки истории ключевых ставок
+func validatePolicy(rec Record) error {
+	if rec.Source == "" {
+		return errors.New("policy rates without source")
+	}
+	dates := make(map[string]bool, len(rec.PolicyRates))
+	for _, p := range rec.PolicyRates {
+		if _, err := time.Parse(time.DateOnly, p.Date); err != nil || dates[p.Date] {
+			return fmt.Errorf("policy rates of %s: wrong or duplicate date %q", rec.Source, p.Date)
+		}
+		dates[p.Date] = true
+		if p.Rate == "" {
+			return fmt.Errorf("policy rates of %s: no rate on %s", rec.Source, p.Date)
+		}
+	}
+	return nil
+}
+
+// Проверка строки ручного курса
+func validateOverride(rec Record) error {
+	o := rec.Override
+	switch {
+	case o == nil:
+		return errors.New("expected override record")
+	case o.Source == "" || !validCode(o.Code):
+		return fmt.Errorf("override without source or with wrong currency code %q", o.Code)
+	case o.RatioBuy == "" || o.RatioSell == "":
+		return fmt.Errorf("override %s %s without rates", o.Source, o.Code)
+	}
+	if _, err := time.Parse(time.RFC3339, o.Created); err != nil {
+		return fmt.Errorf("override %s %s: wrong created %q", o.Source, o.Code, o.Created)
+	}
+	if o.Expires != "" {
+		if _, err := time.Parse(time.RFC3339, o.Expires); err != nil {
+			return fmt.Errorf("override %s %s: wrong expires %q", o.Source, o.Code, o.Expires)
+		}
+	}
+	return nil
+}
+
+// Загрузка проверенных строк файла. Снимки записываются без активации, снимки, которые уже есть в хранилище,
+// пропускаются, поэтому повторная загрузка ничего не меняет. Действующим один раз в конце становится снимок,
+// отмеченный в файле. Ставки дополняют историю датами, которых в ней нет, ручной курс записывается,
+// если у валюты нет своего и срок курса не истек
+func Import(ctx context.Context, st Stores, recs []Record) (stored int, skipped int, err error) {
+	bySource := make(map[string][]Record)
+	sources := make([]string, 0)
+	for _, rec := range recs {
+		source := rec.Source
+		switch rec.Type {
+		case RecordSnapshot:
+			source = rec.Snapshot.Source
+		case RecordOverride:
+			source = rec.Override.Source
+		}
+		if _, ok := bySource[source]; !ok {
+			sources = append(sources, source)
+		}
+		bySource[source] = append(bySource[source], rec)
+	}
+	for _, source := range sources {
+		existing, err := st.Database.GetSnapshots(ctx, source)
+		if err != nil {
+			return stored, skipped, fmt.Errorf("cannot list snapshots of %s: %w", source, err)
+		}
+		present := make(map[string]bool, len(existing))
+		current := ""
+		for _, s := range existing {
+			present[s.ID] = true
+			if s.Active {
+				current = s.ID
+			}
+		}
+		active := current
+		for _, rec := range bySource[source] {
+			switch rec.Type {
+			case RecordPolicy:
+				err = importPolicy(ctx, st.Policy, source, rec.PolicyRates)
+			case RecordOverride:
+				err = importOverride(ctx, st.Override, *rec.Override)
+			}
+			if err != nil {
+				return stored, skipped, err
+			}
+			if rec.Type != RecordSnapshot {
+				continue
+			}
+			s := *rec.Snapshot
+			if s.Active {
+				active = s.ID
+			}
+			if present[s.ID] {
+				skipped++
+				continue
+			}
+			for i := range rec.Rates {
+				rec.Rates[i].Source = source
+			}
+			if err := st.Database.AddSnapshot(ctx, s, rec.Rates); err != nil {
+				return stored, skipped, fmt.Errorf("cannot store snapshot %s: %w", s.ID, err)
+			}
+			stored++
+		}
+		if active != "" && active != current {
+			if err := st.Database.ActivateSnapshot(ctx, source, active); err != nil {
+				return stored, skipped, fmt.Errorf("cannot activate snapshot %s: %w", active, err)
+			}
+		}
+		logger.Printf("Imported data of %s, active snapshot %s", source, active)
+	}
+	return stored, skipped, nil
+}
+
+// Дополнение истории ключевых ставок датами из файла. Сохраненные ставки не заменяются
+func importPolicy(ctx context.Context, svc domain.PolicyRateService, source string, rates []domain.PolicyRate) error {
+	stored, err := svc.GetPolicyRates(ctx, source)
+	if err != nil {
+		return fmt.Errorf("cannot read policy rates of %s: %w", source, err)
+	}
+	dates := make(map[string]bool, len(stored))
+	for _, p := range stored {
+		dates[p.Date] = true
+	}
+	merged := slices.Clone(stored)
+	for _, p := range rates {
+		if !dates[p.Date] {
+			p.Source = source
+			merged = append(merged, p)
+		}
+	}
+	if len(merged) == len(stored) {
+		return nil
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Date < merged[j].Date })
+	if err := svc.StorePolicyRates(ctx, source, merged); err != nil {
+		return fmt.Errorf("cannot store policy rates of %s: %w", source, err)
+	}
+	logger.Printf("Imported %d policy rates of %s", len(merged)-len(stored), source)
+	return nil
+}
+
+// Запись ручного курса, если у валюты нет своего ручного курса и срок курса из файла не истек
+func importOverride(ctx context.Context, svc domain.OverrideService, o domain.RateOverride) error {
+	if o.Expired(time.Now()) {
+		return nil
+	}
+	cur, err := svc.GetOverride(ctx, o.Source, o.Code)
+	if err != nil {
+		return fmt.Errorf("cannot read override %s %s: %w", o.Source, o.Code, err)
+	}
+	if cur.Code != "" {
+		return nil
+	}
+	if err := svc.StoreOverride(ctx, o); err != nil {
+		return fmt.Errorf("cannot store override %s %s: %w", o.Source, o.Code, err)
+	}
+	logger.Printf("Imported override %s %s", o.Source, o.Code)
+	return nil
+}
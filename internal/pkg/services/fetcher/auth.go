@@ -0,0 +1,299 @@
+package fetcher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"main/config"
+	"main/internal/pkg/domain"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Способы аутентификации в источнике
+const (
+	AuthNone   = "none"
+	AuthHeader = "header"
+	AuthQuery  = "query"
+	AuthBasic  = "basic"
+	AuthOAuth2 = "oauth2"
+)
+
+// Время, на которое отключается ключ с исчерпанной квотой
+const quotaCooldown = time.Hour
+
+// Запас времени до истечения токена oauth2, после которого токен запрашивается заново
+const tokenExpiryLeeway = 30 * time.Second
+
+// Аутентификатор добавляет к запросу данные доступа по одному ключу
+type Authenticator interface {
+	Apply(ctx context.Context, req *http.Request) error
+}
+
+// Ключ в заголовке запроса
+type headerKey struct {
+	name string
+	key  string
+}
+
+func (a *headerKey) Apply(_ context.Context, req *http.Request) error {
+	req.Header.Set(a.name, a.key)
+	return nil
+}
+
+// Ключ в параметре запроса
+type queryKey struct {
+	name string
+	key  string
+}
+
+func (a *queryKey) Apply(_ context.Context, req *http.Request) error {
+	q := req.URL.Query()
+	q.Set(a.name, a.key)
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+// Basic-аутентификация
+type basicAuth struct {
+	user     string
+	password string
+}
+
+func (a *basicAuth) Apply(_ context.Context, req *http.Request) error {
+	req.SetBasicAuth(a.user, a.password)
+	return nil
+}
+
+// OAuth2 client credentials. Токен кэшируется до истечения срока действия
+type oauth2Client struct {
+	tokenURL string
+	clientID string
+	secret   string
+	scope    string
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	token  string
+	issued time.Time
+	expiry time.Time
+}
+
+func (a *oauth2Client) Apply(ctx context.Context, req *http.Request) error {
+	token, err := a.getToken(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Сброс кэшированного токена. Возвращает true, если токен был взят из кэша,
+// и запрос имеет смысл повторить со свежим токеном
+func (a *oauth2Client) invalidate() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cached := a.token != "" && time.Since(a.issued) > tokenExpiryLeeway
+	a.token = ""
+	return cached
+}
+
+func (a *oauth2Client) getToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expiry) {
+		return a.token, nil
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if a.scope != "" {
+		form.Set("scope", a.scope)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", a.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(a.clientID), url.QueryEscape(a.secret))
+	res, err := (&http.Client{Timeout: a.timeout}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tok); err != nil {
+		return "", errors.New("cannot decode token response: " + err.Error())
+	}
+	if res.StatusCode > 299 || tok.AccessToken == "" {
+		return "", &domain.UpstreamError{Class: domain.UpstreamAuth, Status: res.StatusCode, Message: "token request failed: " + tok.Error}
+	}
+	a.token = tok.AccessToken
+	a.issued = time.Now()
+	a.expiry = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - tokenExpiryLeeway)
+	return a.token, nil
+}
+
+// KeyRing хранит ключи доступа источника и переключается на следующий ключ,
+// если текущий отозван или исчерпал квоту. Безопасен для конкурентного использования
+type KeyRing struct {
+	source string
+	cfg    config.AuthConfig
+	//Время ожидания ответа при запросе токена
+	timeout time.Duration
+
+	mu   sync.Mutex
+	keys []Authenticator
+	//Отключенные ключи и время их возврата. Нулевое время - ключ отозван
+	disabled map[int]time.Time
+	//Время изменения файла ключей при последнем чтении
+	fileMod time.Time
+}
+
+// Создание KeyRing по настройкам аутентификации источника. Возвращает ошибку при неизвестном способе аутентификации
+func NewKeyRing(source string, cfg config.AuthConfig, timeout int) (*KeyRing, error) {
+	switch cfg.Type {
+	case "", AuthNone, AuthHeader, AuthQuery, AuthBasic:
+	case AuthOAuth2:
+		if cfg.TokenURL == "" {
+			return nil, errors.New("no token url provided for source " + source)
+		}
+	default:
+		return nil, errors.New("unknown auth type " + cfg.Type + " for source " + source)
+	}
+	kr := &KeyRing{source: source, cfg: cfg, timeout: time.Duration(timeout) * time.Second}
+	kr.setKeys(cfg.Keys)
+	return kr, nil
+}
+
+// Нужна ли источнику аутентификация
+func (kr *KeyRing) enabled() bool {
+	return kr.cfg.Type != "" && kr.cfg.Type != AuthNone
+}
+
+// Замена набора ключей. Отключения ключей сбрасываются
+func (kr *KeyRing) setKeys(keys []string) {
+	kr.keys = make([]Authenticator, 0, len(keys))
+	for _, k := range keys {
+		kr.keys = append(kr.keys, kr.newAuthenticator(k))
+	}
+	kr.disabled = make(map[int]time.Time)
+}
+
+func (kr *KeyRing) newAuthenticator(key string) Authenticator {
+	user, pass, _ := strings.Cut(key, ":")
+	switch kr.cfg.Type {
+	case AuthQuery:
+		return &queryKey{kr.cfg.Param, key}
+	case AuthBasic:
+		return &basicAuth{user, pass}
+	case AuthOAuth2:
+		return &oauth2Client{tokenURL: kr.cfg.TokenURL, clientID: user, secret: pass, scope: kr.cfg.Scope, timeout: kr.timeout}
+	}
+	return &headerKey{kr.cfg.Param, key}
+}
+
+// Перечитывание файла ключей, если он изменился с последнего чтения
+func (kr *KeyRing) reloadKeyFile() {
+	if kr.cfg.KeyFile == "" {
+		return
+	}
+	info, err := os.Stat(kr.cfg.KeyFile)
+	if err != nil {
+		logger.Printf("Cannot read key file for source %s: %s", kr.source, err.Error())
+		return
+	}
+	if !info.ModTime().After(kr.fileMod) {
+		return
+	}
+	f, err := os.Open(kr.cfg.KeyFile)
+	if err != nil {
+		logger.Printf("Cannot read key file for source %s: %s", kr.source, err.Error())
+		return
+	}
+	defer f.Close()
+	keys := make([]string, 0)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if k := strings.TrimSpace(sc.Text()); k != "" && !strings.HasPrefix(k, "#") {
+			keys = append(keys, k)
+		}
+	}
+	kr.fileMod = info.ModTime()
+	kr.setKeys(append(keys, kr.cfg.Keys...))
+	logger.Printf("Loaded %d keys for source %s from key file", len(keys), kr.source)
+}
+
+// Добавление данных доступа первого рабочего ключа к запросу. Возвращает номер примененного ключа
+// или ошибку класса auth, если рабочих ключей не осталось
+func (kr *KeyRing) Apply(ctx context.Context, req *http.Request) (int, error) {
+	if !kr.enabled() {
+		return -1, nil
+	}
+	kr.mu.Lock()
+	kr.reloadKeyFile()
+	idx := -1
+	now := time.Now()
+	for i := range kr.keys {
+		until, off := kr.disabled[i]
+		if off && !until.IsZero() && now.After(until) {
+			delete(kr.disabled, i)
+			off = false
+		}
+		if !off {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		kr.mu.Unlock()
+		return -1, &domain.UpstreamError{Source: kr.source, Class: domain.UpstreamAuth, Message: "no usable access keys for source " + kr.source}
+	}
+	auth := kr.keys[idx]
+	kr.mu.Unlock()
+	if err := auth.Apply(ctx, req); err != nil {
+		var upErr *domain.UpstreamError
+		if errors.As(err, &upErr) {
+			upErr.Source = kr.source
+			return idx, upErr
+		}
+		return idx, transportErr(kr.source, err)
+	}
+	return idx, nil
+}
+
+// Отметка ключа как нерабочего после ошибки источника. Возвращает true, если запрос стоит повторить
+// (есть другой ключ или у ключа был сброшен устаревший токен)
+func (kr *KeyRing) Fail(idx int, upErr *domain.UpstreamError) bool {
+	if idx < 0 {
+		return false
+	}
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if idx >= len(kr.keys) {
+		return false
+	}
+	switch upErr.Class {
+	case domain.UpstreamAuth:
+		//Токен мог истечь раньше срока, сначала пробуем получить новый
+		if oa, ok := kr.keys[idx].(*oauth2Client); ok && oa.invalidate() {
+			return true
+		}
+		kr.disabled[idx] = time.Time{}
+		logger.Printf("Access key #%d for source %s was rejected, switching to next key", idx+1, kr.source)
+	case domain.UpstreamQuota:
+		kr.disabled[idx] = time.Now().Add(quotaCooldown)
+		logger.Printf("Access key #%d for source %s exceeded quota, switching to next key", idx+1, kr.source)
+	default:
+		return false
+	}
+	return len(kr.disabled) < len(kr.keys)
+}
@@ -0,0 +1,117 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"errors"
+	"main/internal/pkg/domain"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Максимальная длина сообщения источника, попадающего в лог и ответ
+const maxErrMessageLen = 256
+
+// Декодер тела ошибки источника. Не должен паниковать на любом теле ответа
+type errDecoder func(body []byte) string
+
+// Декодеры тела ошибки по источникам
+var errDecoders = map[string]errDecoder{
+	SourceRU:       decodeErrHTML,
+	SourceTH:       decodeErrTH,
+	SourceKZ:       decodeErrHTML,
+	SourceRUMetals: decodeErrHTML,
+}
+
+// Приведение ответа источника со статусом не OK к типизированной ошибке
+func decodeErrBySource(source string, status int, body []byte) *domain.UpstreamError {
+	decode, ok := errDecoders[source]
+	if !ok {
+		decode = decodeErrHTML
+	}
+	msg := decode(body)
+	return &domain.UpstreamError{
+		Source:  source,
+		Class:   classify(status, msg),
+		Status:  status,
+		Message: msg,
+	}
+}
+
+// Приведение ошибки транспорта к типизированной ошибке
+func transportErr(source string, err error) *domain.UpstreamError {
+	class := domain.UpstreamMaintenance
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		class = domain.UpstreamTimeout
+	}
+	return &domain.UpstreamError{Source: source, Class: class, Err: err}
+}
+
+// Определение класса ошибки по статусу и сообщению.
+// Часть шлюзов отвечает на превышение квоты статусом 403, поэтому сообщение проверяется раньше статуса
+func classify(status int, msg string) domain.UpstreamErrClass {
+	lower := strings.ToLower(msg)
+	if strings.Contains(lower, "quota") || strings.Contains(lower, "rate limit") {
+		return domain.UpstreamQuota
+	}
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return domain.UpstreamAuth
+	case status == http.StatusTooManyRequests:
+		return domain.UpstreamQuota
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return domain.UpstreamTimeout
+	case status >= 500:
+		return domain.UpstreamMaintenance
+	}
+	return domain.UpstreamBadRequest
+}
+
+// Тело ошибки шлюза ЦБ Тайланда. Встречаются варианты
+// {"moreInformation":[{"message":"..."}]}, {"moreInformation":"..."} и {"httpMessage":"..."}
+func decodeErrTH(body []byte) string {
+	var respErr map[string]interface{}
+	if err := json.Unmarshal(body, &respErr); err != nil {
+		return decodeErrHTML(body)
+	}
+	switch info := respErr["moreInformation"].(type) {
+	case string:
+		return truncate(info)
+	case []interface{}:
+		for _, v := range info {
+			if m, ok := v.(map[string]interface{}); ok {
+				if s, ok := m["message"].(string); ok {
+					return truncate(s)
+				}
+			}
+		}
+	}
+	if s, ok := respErr["httpMessage"].(string); ok {
+		return truncate(s)
+	}
+	return truncate(string(body))
+}
+
+var (
+	htmlTitle = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlTag   = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaces    = regexp.MustCompile(`\s+`)
+)
+
+// Тело ошибки в виде HTML-страницы (ЦБ РФ, страницы шлюзов). Берется заголовок страницы или текст без тегов
+func decodeErrHTML(body []byte) string {
+	if m := htmlTitle.FindSubmatch(body); m != nil {
+		return truncate(strings.TrimSpace(spaces.ReplaceAllString(string(m[1]), " ")))
+	}
+	text := htmlTag.ReplaceAllString(string(body), " ")
+	return truncate(strings.TrimSpace(spaces.ReplaceAllString(text, " ")))
+}
+
+func truncate(s string) string {
+	if r := []rune(s); len(r) > maxErrMessageLen {
+		return string(r[:maxErrMessageLen]) + "..."
+	}
+	return s
+}
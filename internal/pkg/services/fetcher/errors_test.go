@@ -0,0 +1,94 @@
+package fetcher
+
+import (
+	"main/internal/pkg/domain"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDecodeErrBySource(t *testing.T) {
+	long := strings.Repeat("я", maxErrMessageLen+10)
+	cases := []struct {
+		name   string
+		source string
+		body   string
+		msg    string
+	}{
+		{"th message list", SourceTH, `{"moreInformation":[{"message":"Quota exceeded"}]}`, "Quota exceeded"},
+		{"th message string", SourceTH, `{"moreInformation":"Invalid date"}`, "Invalid date"},
+		{"th http message", SourceTH, `{"httpCode":"401","httpMessage":"Unauthorized"}`, "Unauthorized"},
+		{"th list without message", SourceTH, `{"moreInformation":[1,"x",{"code":5}]}`, `{"moreInformation":[1,"x",{"code":5}]}`},
+		{"th wrong types", SourceTH, `{"moreInformation":5,"httpMessage":false}`, `{"moreInformation":5,"httpMessage":false}`},
+		{"th not an object", SourceTH, `["a"]`, `["a"]`},
+		{"th truncated json", SourceTH, `{"moreInformation":[{"mess`, `{"moreInformation":[{"mess`},
+		{"th html page", SourceTH, `<html><title>Bad Gateway</title></html>`, "Bad Gateway"},
+		{"ru title", SourceRU, "<html><head><TITLE>\n Service \t Unavailable </TITLE></head></html>", "Service Unavailable"},
+		{"ru text without title", SourceRU, "<html><body><h1>Error</h1><p>try later</p></body></html>", "Error try later"},
+		{"ru unclosed title", SourceRU, "<html><title>Maintenance", "Maintenance"},
+		{"kz truncated tag", SourceKZ, "<html><bo", "<bo"},
+		{"metals plain text", SourceRUMetals, "rate limit", "rate limit"},
+		{"unknown source", "XX", "<title>Not Found</title>", "Not Found"},
+		{"empty body", SourceTH, "", ""},
+		{"garbage", SourceRU, "\x00\xff\xfe<<>>", "\x00\xff\xfe >"},
+		{"long message", SourceTH, `{"httpMessage":"` + long + `"}`, string([]rune(long)[:maxErrMessageLen]) + "..."},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			e := decodeErrBySource(c.source, http.StatusBadGateway, []byte(c.body))
+			if e.Message != c.msg {
+				t.Fatalf("expected message %q, got %q", c.msg, e.Message)
+			}
+			if e.Source != c.source || e.Status != http.StatusBadGateway {
+				t.Fatalf("unexpected error %+v", e)
+			}
+		})
+	}
+}
+
+// Декодеры не паникуют на обрезанных ответах и не выходят за ограничение длины
+func TestErrDecodersTruncatedInput(t *testing.T) {
+	bodies := []string{
+		`{"moreInformation":[{"message":"` + strings.Repeat("x", 2*maxErrMessageLen) + `"}]}`,
+		`<html><head><title>` + strings.Repeat("ы", maxErrMessageLen) + `</title></head></html>`,
+		"\xd1\x8f\xd1",
+	}
+	for source, decode := range errDecoders {
+		for _, body := range bodies {
+			for i := 0; i <= len(body); i++ {
+				msg := decode([]byte(body[:i]))
+				if n := utf8.RuneCountInString(msg); n > maxErrMessageLen+3 {
+					t.Fatalf("source %s: message of %d runes for body %q", source, n, body[:i])
+				}
+			}
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		status int
+		msg    string
+		class  domain.UpstreamErrClass
+	}{
+		{http.StatusForbidden, "Quota exceeded", domain.UpstreamQuota},
+		{http.StatusBadRequest, "API RATE LIMIT reached", domain.UpstreamQuota},
+		{http.StatusServiceUnavailable, "quota", domain.UpstreamQuota},
+		{http.StatusUnauthorized, "Unauthorized", domain.UpstreamAuth},
+		{http.StatusForbidden, "", domain.UpstreamAuth},
+		{http.StatusTooManyRequests, "", domain.UpstreamQuota},
+		{http.StatusRequestTimeout, "", domain.UpstreamTimeout},
+		{http.StatusGatewayTimeout, "Gateway Timeout", domain.UpstreamTimeout},
+		{http.StatusInternalServerError, "", domain.UpstreamMaintenance},
+		{http.StatusServiceUnavailable, "Service Unavailable", domain.UpstreamMaintenance},
+		{http.StatusBadRequest, "Invalid date", domain.UpstreamBadRequest},
+		{http.StatusNotFound, "", domain.UpstreamBadRequest},
+		{0, "\x00\xff", domain.UpstreamBadRequest},
+	}
+	for _, c := range cases {
+		if class := classify(c.status, c.msg); class != c.class {
+			t.Errorf("status %d message %q: expected %s, got %s", c.status, c.msg, c.class, class)
+		}
+	}
+}
@@ -3,20 +3,25 @@
 package fetcher
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"io"
 	"log"
+	"main/internal/pkg/domain"
 	"net/http"
 	"os"
+	"regexp"
 	"sync"
 	"time"
 )
 
 const SourceRU = "RU"
 const SourceTH = "TH"
+const SourceKZ = "KZ"
+const SourceRUMetals = "RU_METALS"
+
+// Глубина запроса цен на металлы в днях. Цены не публикуются в выходные и праздники
+const metalsPeriodDays = 7
 
 // Реализует Fetcher
 type Fetcher struct {
@@ -28,29 +33,44 @@ type Fetcher struct {
 	timeout int
 	//Защита от перезаписи времени lastUpdate
 	mu sync.Mutex
+	//Источники, описанные в конфигурации
+	definitions map[string]domain.SourceDefinition
 }
 
 // Логгер для Fetcher
 var logger = log.New(os.Stdout, "Fetcher", log.LstdFlags|log.Lshortfile)
 
 // Cоздание Fetcher. Предоставляет доступ к внешним источникам данных
-// обрабатывает запросы по ссылкам. Требуется последнее время обновления, локация времени, и timeout
-func NewFetcher(lastUpdate time.Time, timeLoc *time.Location, timeout int) *Fetcher {
-	return &Fetcher{lastUpdate, timeLoc, timeout, sync.Mutex{}}
+// обрабатывает запросы по ссылкам. Требуется последнее время обновления, локация времени, timeout
+// и описания источников из конфигурации (может быть nil)
+func NewFetcher(lastUpdate time.Time, timeLoc *time.Location, timeout int, definitions map[string]domain.SourceDefinition) *Fetcher {
+	return &Fetcher{lastUpdate, timeLoc, timeout, sync.Mutex{}, definitions}
 }
 
 const userAgent = `Mozilla/5.0 (Macintosh; Intel Mac OS X 10_7_5) AppleWebKit/537.11 (KHTML, like Gecko) Chrome/23.0.1271.64 Safari/537.11`
 
-// Добавление нужных заголовков к запросу в зависимости от источника
-func (f *Fetcher) reqBySource(source string, sourceKeys map[string]string, sourceLinks map[string]string) (*http.Request, error) {
+// Добавление нужных заголовков к запросу в зависимости от источника. Данные доступа добавляет KeyRing источника
+func (f *Fetcher) reqBySource(source string, sourceLinks map[string]string) (*http.Request, error) {
 	t := time.Now().In(f.timeLoc)
 	var ctx = context.Background()
-	req, err := http.NewRequestWithContext(ctx, "GET", sourceLinks[source], nil)
+	link := sourceLinks[source]
+	def, generic := f.definitions[source]
+	if generic {
+		link = expandURL(link, f.lastUpdate, t)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
 	if err != nil {
 		return nil, err
 	}
+	if generic {
+		req.Header.Add("User-Agent", userAgent)
+		for k, v := range def.Headers {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	}
 	switch source {
-	case SourceRU:
+	case SourceRU, SourceKZ:
 		{
 			req.Header.Add("Accept", `application/xml`)
 			req.Header.Add("User-Agent", userAgent)
@@ -58,11 +78,6 @@ func (f *Fetcher) reqBySource(source string, sourceKeys map[string]string, sourc
 	case SourceTH:
 		{
 			req.Header.Add("Accept", `application/json`)
-			if sourceKeys["TH"] == "" {
-				logger.Print("Cannot fetch source TH. No key provided")
-				return nil, errors.New("no key provided for source th")
-			}
-			req.Header.Add("X-IBM-Client-Id", sourceKeys["TH"])
 			lastup := f.lastUpdate
 			startPeriod := lastup.Format(time.DateOnly)
 			endPeriod := t.Format(time.DateOnly)
@@ -70,62 +85,137 @@ func (f *Fetcher) reqBySource(source string, sourceKeys map[string]string, sourc
 			queryEndPeriod := "&end_period=" + endPeriod
 			req.URL.RawQuery = queryStartPeriod + queryEndPeriod
 		}
+	case SourceRUMetals:
+		{
+			req.Header.Add("Accept", `application/xml`)
+			req.Header.Add("User-Agent", userAgent)
+			startPeriod := f.lastUpdate.AddDate(0, 0, -metalsPeriodDays).Format("02/01/2006")
+			endPeriod := t.Format("02/01/2006")
+			req.URL.RawQuery = "date_req1=" + startPeriod + "&date_req2=" + endPeriod
+		}
 	}
 	return req, nil
 }
 
-// Вывод тела ошибки в ответ АПИ
-func (f *Fetcher) errBodyBySource(source string, body []byte) string {
-	var ErrBody string
+// Подстановки дат в шаблон ссылки: {date} и {end} - текущая дата, {start} - дата последнего обновления
+var urlPlaceholder = regexp.MustCompile(`\{(date|start|end)(?::([^}]+))?\}`)
+
+// Подстановка дат в шаблон ссылки описанного источника. Формат по умолчанию 2006-01-02
+func expandURL(tmpl string, start time.Time, end time.Time) string {
+	return urlPlaceholder.ReplaceAllStringFunc(tmpl, func(m string) string {
+		sub := urlPlaceholder.FindStringSubmatch(m)
+		layout := sub[2]
+		if layout == "" {
+			layout = time.DateOnly
+		}
+		if sub[1] == "start" {
+			return start.Format(layout)
+		}
+		return end.Format(layout)
+	})
+}
+
+// GetCurrfromSource отправляет GET-запрос по ссылке для конкретного источника и конкретной валюты (если нужно, добавить ключи доступа).
+// При отказе в доступе или исчерпании квоты запрос повторяется со следующим ключом источника.
+// Возвращает ненулевую ошибку *domain.UpstreamError при получении статуса запроса не OK или недоступности источника
+func (f *Fetcher) FetchAllfromSource(source string, sourceAuth map[string]*KeyRing, sourceLinks map[string]string) (body []byte, err error) {
+	// Проверка на время обновления данных
+	t := time.Now().In(f.timeLoc)
+	body, err = f.fetchWithKeys(source, sourceAuth[source], func() (*http.Request, error) {
+		return f.reqBySource(source, sourceLinks)
+	})
+	if err != nil {
+		return body, err
+	}
+	f.mu.Lock()
+	f.lastUpdate = t
+	defer f.mu.Unlock()
+	return body, nil
+}
+
+// FetchPolicyFromSource отправляет GET-запрос за историей ключевой ставки источника с даты последнего обновления.
+// Ключи доступа те же, что и для курсов валют. Возвращает ненулевую ошибку *domain.UpstreamError так же, как FetchAllfromSource
+func (f *Fetcher) FetchPolicyFromSource(source string, sourceAuth map[string]*KeyRing, policyLinks map[string]string) (body []byte, err error) {
+	return f.fetchWithKeys(source, sourceAuth[source], func() (*http.Request, error) {
+		return f.policyReqBySource(source, policyLinks)
+	})
+}
+
+// Запрос ключевой ставки в зависимости от источника
+func (f *Fetcher) policyReqBySource(source string, policyLinks map[string]string) (*http.Request, error) {
+	t := time.Now().In(f.timeLoc)
+	link, ok := policyLinks[source]
+	if !ok || link == "" {
+		return nil, errors.New("no policy rate link for source " + source)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), "GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
 	switch source {
-	// Для источника ЦБ Тайланд
-	case SourceTH:
+	case SourceRU:
 		{
-			var RespErr map[string][]interface{}
-			err := json.NewDecoder(bytes.NewReader(body)).Decode(&RespErr)
-			if err != nil {
-				return "Error while json-decoding from source TH"
-			}
-			ErrBody = RespErr["moreInformation"][0].(map[string]interface{})["message"].(string)
+			req.Header.Add("Accept", `application/xml`)
+			req.Header.Add("User-Agent", userAgent)
+			req.URL.RawQuery = "fromDate=" + f.lastUpdate.Format(time.DateOnly) + "&ToDate=" + t.Format(time.DateOnly)
 		}
-	default:
+	case SourceTH:
 		{
-			ErrBody = string(body)
+			req.Header.Add("Accept", `application/json`)
+			req.URL.RawQuery = "start_period=" + f.lastUpdate.Format(time.DateOnly) + "&end_period=" + t.Format(time.DateOnly)
 		}
 	}
-	return ErrBody
+	return req, nil
 }
 
-// GetCurrfromSource отправляет GET-запрос по ссылке для конкретного источника и конкретной валюты (если нужно, добавить ключи доступа).
-// Возвращает ненулевую ошибку при получении статуса запроса не OK
-func (f *Fetcher) FetchAllfromSource(source string, sourceKeys map[string]string, sourceLinks map[string]string) (body []byte, err error) {
-	// Проверка на время обновления данных
-	t := time.Now().In(f.timeLoc)
+// Запрос с переключением ключей: при отказе в доступе или исчерпании квоты запрос повторяется со следующим ключом
+func (f *Fetcher) fetchWithKeys(source string, keys *KeyRing, build func() (*http.Request, error)) (body []byte, err error) {
+	for {
+		var keyIdx int
+		body, keyIdx, err = f.fetchOnce(source, keys, build)
+		var upErr *domain.UpstreamError
+		if err == nil {
+			return body, nil
+		}
+		if !errors.As(err, &upErr) || keys == nil || !keys.Fail(keyIdx, upErr) {
+			return body, err
+		}
+	}
+}
+
+// Один запрос к источнику с текущим ключом. Возвращает тело ответа и номер примененного ключа
+func (f *Fetcher) fetchOnce(source string, keys *KeyRing, build func() (*http.Request, error)) (body []byte, keyIdx int, err error) {
 	timeout := time.Duration(f.timeout) * time.Second
 	httpClient := &http.Client{Timeout: timeout}
-	req, err := f.reqBySource(source, sourceKeys, sourceLinks)
+	req, err := build()
 	if err != nil {
-		return body, err
+		return body, -1, err
+	}
+	keyIdx = -1
+	if keys != nil {
+		keyIdx, err = keys.Apply(req.Context(), req)
+		if err != nil {
+			logger.Printf("Cannot authorize request to source %s: %s", source, err.Error())
+			return body, keyIdx, err
+		}
 	}
 	res, err := httpClient.Do(req)
 	if err != nil {
 		// Сервис недоступен или не прошел таймаут
-		logger.Printf("Source %s currently unavailable due to timeout", source)
-		return body, err
+		upErr := transportErr(source, err)
+		logger.Printf("Source %s currently unavailable: %s", source, upErr.Error())
+		return body, keyIdx, upErr
 	}
+	defer res.Body.Close()
 	body, err = io.ReadAll(res.Body)
 	if err != nil {
-		return body, err
+		return body, keyIdx, transportErr(source, err)
 	}
 	if res.StatusCode > 299 {
 		// Обработка статус кода
-		ErrBody := f.errBodyBySource(source, body)
-		logger.Printf("Request to source %s failed, returned this error message: %s", source, ErrBody)
-		return body, errors.New(ErrBody)
+		upErr := decodeErrBySource(source, res.StatusCode, body)
+		logger.Printf("Request to source %s failed: %s", source, upErr.Error())
+		return body, keyIdx, upErr
 	}
-	f.mu.Lock()
-	f.lastUpdate = t
-	defer f.mu.Unlock()
-	defer res.Body.Close()
-	return body, nil
+	return body, keyIdx, nil
 }
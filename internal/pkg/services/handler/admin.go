@@ -0,0 +1,381 @@
+package handler
+
+import (
+	"encoding/json"
+	"main/internal/pkg/domain"
+	"main/internal/pkg/services/api"
+	"net/http"
+	"strings"
+)
+
+// Обработчик запроса администратора. identity - имя администратора по токену
+type adminHandlerFunc func(w http.ResponseWriter, r *http.Request, identity string)
+
+// Проверка токена администратора в заголовке "Authorization: Bearer <токен>" или "X-Admin-Token".
+// Если токены не заданы, методы администратора отключены
+func (ah *APIHandler) admin(next adminHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", `application/json`)
+		if len(ah.adminTokens) == 0 {
+			ah.writeProblem(w, r, api.CodeAdminDisabled, "Admin API is disabled. Set ADMIN_TOKENS")
+			return
+		}
+		token := r.Header.Get("X-Admin-Token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		identity, ok := ah.adminTokens[token]
+		if token == "" || !ok {
+			ah.writeProblem(w, r, api.CodeUnauthorized, "Admin token required")
+			return
+		}
+		next(w, r, identity)
+	}
+}
+
+// Quarantine godoc
+// @Summary		 Снимки курсов в карантине
+// @Description	 Снимки курсов, в которых найдены аномалии. Пока снимок ожидает решения, отдаются прежние курсы. Если источник не указан, выводятся снимки всех источников
+// @Tags 	 	 Admin
+// @ID 			 quarantine
+// @Produce  	 json
+// @Security 	 AdminToken
+// @Param 		 source 	query 		string 		false 	"source"
+// @Success 	 200 	  {object} 		handler.Response{data=[]domain.QuarantinedSnapshot}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 401 	  {object}  handler.Problem
+// @Router 		 /v1/admin/quarantine		 		[get]
+// @Examples      /v1/admin/quarantine?source=TH
+func (ah *APIHandler) quarantine(w http.ResponseWriter, r *http.Request, identity string) {
+	var resp Response
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	data, err := ah.Service.GetQuarantine(params.Get("source"))
+	if err != nil {
+		ah.writeError(w, r, err)
+		logger.Printf("%s", "Quarantine: "+err.Error())
+		return
+	}
+	resp.SetAnswer(http.StatusOK, "Getting quarantined snapshots successful", []interface{}{data})
+	ah.writeResp(w, resp)
+}
+
+// Проверка метода POST для запросов, меняющих данные
+func (ah *APIHandler) requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodPost {
+		return true
+	}
+	w.Header().Set("Allow", http.MethodPost)
+	ah.writeProblem(w, r, api.CodeMethodNotAllowed, "Use POST")
+	return false
+}
+
+// ReleaseQuarantine godoc
+// @Summary		 Предложить записать снимок из карантина
+// @Description	 Создает предложение записать курсы снимка в бд. Снимок записывается после одобрения предложения другим администратором в '/v1/admin/proposals/{id}/approve'
+// @Tags 	 	 Admin
+// @ID 			 releaseQuarantine
+// @Produce  	 json
+// @Security 	 AdminToken
+// @Param 		 id 		path 		string 		true 	"snapshot id"
+// @Param 		 reason 	query 		string 		false 	"reason"
+// @Success 	 200 	  {object} 		handler.Response{data=[]domain.Proposal}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 401 	  {object}  handler.Problem
+// @Failure 	 422 	  {object}  handler.Problem
+// @Router 		 /v1/admin/quarantine/{id}/approve		 		[post]
+// @Examples      /v1/admin/quarantine/TH-20240105100000-1a2b3c4d/approve
+func (ah *APIHandler) releaseQuarantine(w http.ResponseWriter, r *http.Request, identity string) {
+	if !ah.requirePost(w, r) {
+		return
+	}
+	var resp Response
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	if params.Get("id") == "" {
+		ah.writeProblem(w, r, api.CodeInvalidRequest, "Wrong query passed. Snapshot id required")
+		return
+	}
+	data, err := ah.Service.ProposeQuarantineRelease(params.Get("id"), params.Get("reason"), identity)
+	if err != nil {
+		ah.writeError(w, r, err)
+		logger.Printf("%s", "ReleaseQuarantine: "+err.Error())
+		return
+	}
+	resp.SetAnswer(http.StatusOK, "Proposal "+data.ID+" created, awaits approval by another admin", []interface{}{data})
+	ah.writeResp(w, resp)
+}
+
+// RejectQuarantine godoc
+// @Summary		 Отклонить снимок в карантине
+// @Description	 Отмечает снимок отклоненным, курсы в бд не меняются
+// @Tags 	 	 Admin
+// @ID 			 rejectQuarantine
+// @Produce  	 json
+// @Security 	 AdminToken
+// @Param 		 id 		path 		string 		true 	"snapshot id"
+// @Success 	 200 	  {object} 		handler.Response{data=[]domain.QuarantinedSnapshot}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 401 	  {object}  handler.Problem
+// @Failure 	 422 	  {object}  handler.Problem
+// @Router 		 /v1/admin/quarantine/{id}/reject		 		[post]
+// @Examples      /v1/admin/quarantine/TH-20240105100000-1a2b3c4d/reject
+func (ah *APIHandler) rejectQuarantine(w http.ResponseWriter, r *http.Request, identity string) {
+	if !ah.requirePost(w, r) {
+		return
+	}
+	var resp Response
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	id := params.Get("id")
+	if id == "" {
+		ah.writeProblem(w, r, api.CodeInvalidRequest, "Wrong query passed. Snapshot id required")
+		return
+	}
+	data, err := ah.Service.RejectQuarantine(id, identity)
+	if err != nil {
+		ah.writeError(w, r, err)
+		logger.Printf("%s", "RejectQuarantine: "+err.Error())
+		return
+	}
+	resp.SetAnswer(http.StatusOK, "Snapshot "+id+" "+data.Status, []interface{}{data})
+	ah.writeResp(w, resp)
+}
+
+// Overrides godoc
+// @Summary		 Ручные курсы
+// @Description	 GET выводит ручные курсы источника, POST предлагает установить ручной курс (тело api.OverrideRequest), DELETE предлагает удалить ручной курс валюты. Предложение применяется после одобрения другим администратором в '/v1/admin/proposals/{id}/approve'. Ручной курс отдается вместо сохраненного в конвертации и курсах источника до удаления или истечения срока. Все изменения попадают в журнал '/v1/admin/audit'
+// @Tags 	 	 Admin
+// @ID 			 overrides
+// @Accept 		 json
+// @Produce  	 json
+// @Security 	 AdminToken
+// @Param 		 source 	path 		string 		false 	"source (GET, DELETE)"
+// @Param 		 code 		path 		string 		false 	"code (DELETE)"
+// @Param 		 reason 	query 		string 		false 	"reason (DELETE)"
+// @Param 		 override 	body 		api.OverrideRequest 	false 	"override (POST)"
+// @Success 	 200 	  {object} 		handler.Response{data=[]domain.RateOverride}
+// @Success 	 201 	  {object} 		handler.Response{data=[]domain.Proposal}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 401 	  {object}  handler.Problem
+// @Router 		 /v1/admin/sources/{source}/overrides		 		[get]
+// @Router 		 /v1/admin/overrides		 		[post]
+// @Router 		 /v1/admin/sources/{source}/overrides/{code}		 		[delete]
+func (ah *APIHandler) overrides(w http.ResponseWriter, r *http.Request, identity string) {
+	var resp Response
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		data, err := ah.Service.GetOverrides(params.Get("source"))
+		if err != nil {
+			ah.writeError(w, r, err)
+			logger.Printf("%s", "Overrides: "+err.Error())
+			return
+		}
+		resp.SetAnswer(http.StatusOK, "Getting overrides successful", []interface{}{data})
+	case http.MethodPost:
+		var req api.OverrideRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			ah.writeProblem(w, r, api.CodeInvalidRequest, "Wrong body passed")
+			return
+		}
+		data, err := ah.Service.ProposeOverride(req, identity)
+		if err != nil {
+			ah.writeError(w, r, err)
+			logger.Printf("%s", "Overrides: "+err.Error())
+			return
+		}
+		resp.SetAnswer(http.StatusCreated, "Proposal "+data.ID+" created, awaits approval by another admin", []interface{}{data})
+	case http.MethodDelete:
+		data, err := ah.Service.ProposeOverrideDelete(params.Get("source"), params.Get("code"), params.Get("reason"), identity)
+		if err != nil {
+			ah.writeError(w, r, err)
+			logger.Printf("%s", "Overrides: "+err.Error())
+			return
+		}
+		resp.SetAnswer(http.StatusCreated, "Proposal "+data.ID+" created, awaits approval by another admin", []interface{}{data})
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		ah.writeProblem(w, r, api.CodeMethodNotAllowed, "Use GET, POST or DELETE")
+		return
+	}
+	ah.writeResp(w, resp)
+}
+
+// Audit godoc
+// @Summary		 Журнал изменений
+// @Description	 Последние изменения ручных курсов: кто, когда, причина, состояние до и после
+// @Tags 	 	 Admin
+// @ID 			 audit
+// @Produce  	 json
+// @Security 	 AdminToken
+// @Param 		 limit 	query 		int 		false 	"limit (100 by default)"
+// @Success 	 200 	  {object} 		handler.Response{data=[]domain.AuditEntry}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 401 	  {object}  handler.Problem
+// @Router 		 /v1/admin/audit		 		[get]
+// @Examples      /v1/admin/audit?limit=20
+func (ah *APIHandler) auditLog(w http.ResponseWriter, r *http.Request, identity string) {
+	var resp Response
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	data, err := ah.Service.GetAudit(params.Get("limit"))
+	if err != nil {
+		ah.writeError(w, r, err)
+		logger.Printf("%s", "Audit: "+err.Error())
+		return
+	}
+	resp.SetAnswer(http.StatusOK, "Getting audit log successful", []interface{}{data})
+	ah.writeResp(w, resp)
+}
+
+// Proposals godoc
+// @Summary		 Предложения изменить курсы
+// @Description	 Предложения установить или удалить ручной курс и записать снимок из карантина. Предложение применяется после одобрения администратором, отличным от автора, до истечения срока PROPOSAL_TTL
+// @Tags 	 	 Admin
+// @ID 			 proposals
+// @Produce  	 json
+// @Security 	 AdminToken
+// @Param 		 status 	query 		string 		false 	"pending, approved, rejected, expired"
+// @Success 	 200 	  {object} 		handler.Response{data=[]domain.Proposal}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 401 	  {object}  handler.Problem
+// @Router 		 /v1/admin/proposals		 		[get]
+// @Examples      /v1/admin/proposals?status=pending
+func (ah *APIHandler) proposals(w http.ResponseWriter, r *http.Request, identity string) {
+	var resp Response
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	data, err := ah.Service.GetProposals(params.Get("status"))
+	if err != nil {
+		ah.writeError(w, r, err)
+		logger.Printf("%s", "Proposals: "+err.Error())
+		return
+	}
+	resp.SetAnswer(http.StatusOK, "Getting proposals successful", []interface{}{data})
+	ah.writeResp(w, resp)
+}
+
+// ResolveProposal godoc
+// @Summary		 Решение по предложению
+// @Description	 approve применяет предложение, одобрить может только администратор, отличный от автора. reject отклоняет предложение, в том числе автором
+// @Tags 	 	 Admin
+// @ID 			 resolveProposal
+// @Produce  	 json
+// @Security 	 AdminToken
+// @Param 		 action 	path 		string 		true 	"approve or reject"
+// @Param 		 id 		path 		string 		true 	"proposal id"
+// @Success 	 200 	  {object} 		handler.Response{data=[]domain.Proposal}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 401 	  {object}  handler.Problem
+// @Failure 	 422 	  {object}  handler.Problem
+// @Router 		 /v1/admin/proposals/{id}/{action}		 		[post]
+// @Examples      /v1/admin/proposals/P-20240105100000-1a2b3c4d/approve
+func (ah *APIHandler) resolveProposal(approve bool) adminHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, identity string) {
+		if !ah.requirePost(w, r) {
+			return
+		}
+		var resp Response
+		params, ok := ah.params(w, r)
+		if !ok {
+			return
+		}
+		id := params.Get("id")
+		if id == "" {
+			ah.writeProblem(w, r, api.CodeInvalidRequest, "Wrong query passed. Proposal id required")
+			return
+		}
+		var data domain.Proposal
+		var err error
+		if approve {
+			data, err = ah.Service.ApproveProposal(id, identity)
+		} else {
+			data, err = ah.Service.RejectProposal(id, identity)
+		}
+		if err != nil {
+			ah.writeError(w, r, err)
+			logger.Printf("%s", "ResolveProposal: "+err.Error())
+			return
+		}
+		resp.SetAnswer(http.StatusOK, "Proposal "+id+" "+data.Status, []interface{}{data})
+		ah.writeResp(w, resp)
+	}
+}
+
+// Snapshots godoc
+// @Summary		 Снимки курсов
+// @Description	 Снимки курсов источника от новых к старым. Каждое обновление записывается новым снимком, действующий снимок отмечен active
+// @Tags 	 	 Admin
+// @ID 			 snapshots
+// @Produce  	 json
+// @Security 	 AdminToken
+// @Param 		 source 	path 		string 		true 	"source"
+// @Success 	 200 	  {object} 		handler.Response{data=[]domain.Snapshot}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 401 	  {object}  handler.Problem
+// @Router 		 /v1/admin/sources/{source}/snapshots		 		[get]
+// @Examples      /v1/admin/sources/RU/snapshots
+func (ah *APIHandler) snapshots(w http.ResponseWriter, r *http.Request, identity string) {
+	var resp Response
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	data, err := ah.Service.GetSnapshots(params.Get("source"))
+	if err != nil {
+		ah.writeError(w, r, err)
+		logger.Printf("%s", "Snapshots: "+err.Error())
+		return
+	}
+	resp.SetAnswer(http.StatusOK, "Getting snapshots successful", []interface{}{data})
+	ah.writeResp(w, resp)
+}
+
+// Rollback godoc
+// @Summary		 Предложить возврат к снимку
+// @Description	 Создает предложение сделать действующим прежний снимок курсов. Снимок становится действующим после одобрения другим администратором в '/v1/admin/proposals/{id}/approve'
+// @Tags 	 	 Admin
+// @ID 			 rollback
+// @Produce  	 json
+// @Security 	 AdminToken
+// @Param 		 source 	path 		string 		true 	"source"
+// @Param 		 id 		path 		string 		true 	"snapshot id"
+// @Param 		 reason 	query 		string 		true 	"reason"
+// @Success 	 200 	  {object} 		handler.Response{data=[]domain.Proposal}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 401 	  {object}  handler.Problem
+// @Failure 	 422 	  {object}  handler.Problem
+// @Router 		 /v1/admin/sources/{source}/snapshots/{id}/rollback		 		[post]
+// @Examples      /v1/admin/sources/RU/snapshots/RU-20240105100000-1a2b3c4d/rollback?reason=wrong%20rates
+func (ah *APIHandler) rollback(w http.ResponseWriter, r *http.Request, identity string) {
+	if !ah.requirePost(w, r) {
+		return
+	}
+	var resp Response
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	data, err := ah.Service.ProposeRollback(params.Get("source"), params.Get("id"), params.Get("reason"), identity)
+	if err != nil {
+		ah.writeError(w, r, err)
+		logger.Printf("%s", "Rollback: "+err.Error())
+		return
+	}
+	resp.SetAnswer(http.StatusCreated, "Proposal "+data.ID+" created, awaits approval by another admin", []interface{}{data})
+	ah.writeResp(w, resp)
+}
@@ -11,7 +11,6 @@ import (
 	"main/internal/pkg/domain"
 	"main/internal/pkg/services/api"
 	"net/http"
-	"net/url"
 	"os"
 	"strconv"
 	"time"
@@ -22,11 +21,14 @@ var logger = log.New(os.Stdout, "Handler ", log.LstdFlags|log.Lshortfile)
 
 // Сервис API
 type APIservice interface {
-	//Реализация запроса '/convert'
-	Convert(source string, first string, second string, amount string, course string) (data interface{}, err error)
+	//Реализация запроса '/convert'. stale истинно, если бд недоступна и использованы последние прочитанные курсы
+	Convert(source string, first string, second string, amount string, course string) (data interface{}, stale bool, err error)
 
 	//Реализация запроса '/getAll'
-	GetAll(source string) (ans []domain.CurrModel, err error)
+	GetAll(source string) (ans []domain.CurrModel, stale bool, err error)
+
+	//Реализация запроса '/v1/sources/{source}/rates/{code}'
+	GetRate(source string, code string) (ans domain.CurrModel, stale bool, err error)
 
 	//Реализация горутины для периодического обновления данных
 	UpdateAllInSource(source string, timeLoc *time.Location, timeToUpdate time.Time) (err error)
@@ -36,16 +38,65 @@ type APIservice interface {
 
 	//Получение неактуальной записи
 	GetDateFromSource(source string) (init_date time.Time, err error)
+
+	//Реализация запроса '/rates/policy'
+	GetPolicyRates(source string, from string, to string) (ans api.PolicyRatesResponse, err error)
+
+	//Реализация запроса '/changes'
+	GetChanges(source string, from string, to string, top string) (ans api.ChangesResponse, err error)
+
+	//Реализация запроса '/admin/drift'
+	GetDrifts(source string) (ans []domain.DriftReport, err error)
+
+	//Реализация запроса '/admin/quarantine'
+	GetQuarantine(source string) (ans []domain.QuarantinedSnapshot, err error)
+
+	//Реализация запросов '/admin/quarantine/approve' и '/admin/quarantine/reject'
+	ProposeQuarantineRelease(id string, reason string, identity string) (ans domain.Proposal, err error)
+	RejectQuarantine(id string, identity string) (ans domain.QuarantinedSnapshot, err error)
+
+	//Реализация запросов '/admin/overrides'
+	GetOverrides(source string) (ans []domain.RateOverride, err error)
+	ProposeOverride(req api.OverrideRequest, identity string) (ans domain.Proposal, err error)
+	ProposeOverrideDelete(source string, code string, reason string, identity string) (ans domain.Proposal, err error)
+
+	//Реализация запросов '/admin/snapshots'
+	GetSnapshots(source string) (ans []domain.Snapshot, err error)
+	ProposeRollback(source string, id string, reason string, identity string) (ans domain.Proposal, err error)
+
+	//Реализация запросов '/admin/proposals'
+	GetProposals(status string) (ans []domain.Proposal, err error)
+	ApproveProposal(id string, identity string) (ans domain.Proposal, err error)
+	RejectProposal(id string, identity string) (ans domain.Proposal, err error)
+
+	//Реализация запроса '/admin/audit'
+	GetAudit(limit string) (ans []domain.AuditEntry, err error)
+
+	//Выборы реплики, которая обновляет источники
+	AcquireLeadership(ttl time.Duration) (leader bool, err error)
+	ReleaseLeadership() (err error)
 }
 
+// Задержка повторной попытки обновления источника после отказа в доступе
+const authRetryDelay = time.Hour
+
 // Хендлер API
 type APIHandler struct {
 	Service APIservice
+	//Источники, обновление которых приостановлено после ошибки источника, и время возобновления.
+	//Нулевое время означает остановку до перезапуска сервиса
+	suspended map[string]time.Time
+	//Токены администраторов и их имена
+	adminTokens map[string]string
+	//Ответ на ошибки прежним форматом Response с кодом 200
+	legacyEnvelope bool
+	//Роутер запросов клиента, передается серверу
+	Router *http.ServeMux
 }
 
 // Handler реализует запросы клиента и посылает запрос в бизнес-логику и получает ответ
 func NewAPIHandler(svc APIservice, err error) (*APIHandler, error) {
-	return &APIHandler{svc}, err
+	return &APIHandler{Service: svc, suspended: make(map[string]time.Time)}, err
 }
 
 // Стурктура ответа
@@ -56,6 +107,12 @@ type Response struct {
 	Message string `json:"message,omitempty"`
 	//Данные
 	Data []interface{} `json:"data,omitempty"`
+	//Бд недоступна, данные - последние прочитанные курсы
+	Stale bool `json:"stale,omitempty"`
+	//Код предупреждения из каталога ошибок, например STALE_DATA
+	Warning string `json:"warning,omitempty"`
+	//Код ошибки из каталога в режиме LEGACY_ENVELOPE, например INVALID_STATE
+	ErrorCode string `json:"error_code,omitempty"`
 }
 
 // Вывод ответа в клиент
@@ -77,15 +134,25 @@ func (r *Response) SetAnswer(code int, message string, data []interface{}) {
 	}
 }
 
+// Отметка ответа последними прочитанными курсами: поля stale, warning и заголовок Warning
+func (r *Response) setStale(w http.ResponseWriter, stale bool) {
+	if !stale {
+		return
+	}
+	r.Stale = true
+	r.Warning = api.CodeStaleData
+	w.Header().Set("Warning", `110 - "Response is Stale"`)
+}
+
 // Инициализация роутов для хендлера
 func InitHandler(AppConfig *config.AppConfig, mainCtx context.Context) (ah *APIHandler, err error) {
-	ah, err = NewAPIHandler(api.NewAPI(AppConfig.DbUrl, AppConfig.SourceKeys, AppConfig.SourceLinks, AppConfig.TimeoutREQ, AppConfig.Loc, mainCtx, AppConfig.DbAttempts))
+	ah, err = NewAPIHandler(api.NewAPI(AppConfig, mainCtx))
 	if err != nil {
 		return ah, err
 	}
-	http.HandleFunc("/", ah.greet)
-	http.HandleFunc("/getall", ah.getAll)
-	http.HandleFunc("/convert", ah.convert)
+	ah.adminTokens = AppConfig.AdminTokens
+	ah.legacyEnvelope = AppConfig.LegacyEnvelope
+	ah.Router = ah.routes()
 	return ah, nil
 }
 
@@ -101,7 +168,13 @@ func (ah *APIHandler) StartUpdate(AppConfig *config.AppConfig, mainCtx context.C
 		}
 	}
 
-	return ah.UpdatingSources(AppConfig.TimeoutUP, AppConfig.Loc, timeUpd, AppConfig.Sources, mainCtx)
+	if !AppConfig.LeaderElection {
+		return ah.UpdatingSources(AppConfig.TimeoutUP, AppConfig.Loc, timeUpd, AppConfig.Sources, mainCtx)
+	}
+	//При нескольких репликах источники обновляет только лидер
+	return ah.lead(time.Duration(AppConfig.LeaderTTL)*time.Second, func(ctx context.Context) error {
+		return ah.UpdatingSources(AppConfig.TimeoutUP, AppConfig.Loc, timeUpd, AppConfig.Sources, ctx)
+	}, mainCtx)
 }
 
 // Горутина для отслеживания соединения с бд
@@ -115,75 +188,197 @@ func (ah *APIHandler) ExitConnectWithDb(mainCtx context.Context) error {
 // @Tags 		handlerConvert
 // @ID 			Convert
 // @Param 		source 		path 	string 		true 	"source"
-// @Param 		first 		path 	string 		true 	"first"
-// @Param 		second 		path 	string 		true 	"second"
-// @Param 		amount 		path 	string 		true 	"amount"
-// @Param 		exchange 	path 	string 		true 	"exchange"
+// @Param 		first 		query 	string 		true 	"first"
+// @Param 		second 		query 	string 		true 	"second"
+// @Param 		amount 		query 	string 		true 	"amount"
+// @Param 		exchange 	query 	string 		true 	"buy or sell"
 // @Success 	200 	  {object} 	handler.Response{data=api.ConvertResponse}
-// @Failure 	400 	  {object}  handler.Response
-// @Failure 	404 	  {object}  handler.Response
-// @Failure		500 	  {object} 	handler.Response
-// @Router 		/convert   [get]
-// @Examples     /convert?source=TH&first=RUB&second=USD&amount=1000&exchange=buy
+// @Failure 	400 	  {object}  handler.Problem
+// @Failure 	404 	  {object}  handler.Problem
+// @Failure		500 	  {object} 	handler.Problem
+// @Failure		503 	  {object} 	handler.Problem
+// @Failure		405 	  {object} 	handler.Problem
+// @Router 		/v1/sources/{source}/convert   [get]
+// @Examples     /v1/sources/TH/convert?first=RUB&second=USD&amount=1000&exchange=buy
 func (ah *APIHandler) convert(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", `application/json`)
 	var resp Response
-	params, err := url.ParseQuery(r.URL.RawQuery)
-	/*Проверка на правильность ввода параметров */
-	if err != nil || len(params) == 0 {
-		resp.SetAnswer(http.StatusBadRequest, "Wrong query passed", nil)
-		resp.WriteResp(w)
+	params, ok := ah.params(w, r)
+	if !ok {
 		return
 	}
-	data, err := ah.Service.Convert(params.Get("source"), params.Get("first"),
+	data, stale, err := ah.Service.Convert(params.Get("source"), params.Get("first"),
 		params.Get("second"), params.Get("amount"), params.Get("exchange"))
 	if err != nil {
-		resp.SetAnswer(http.StatusBadRequest, err.Error(), nil)
-		resp.WriteResp(w)
+		ah.writeError(w, r, err)
 		return
 	}
 	resp.SetAnswer(http.StatusOK, "Conversion successful", []interface{}{data})
-	resp.WriteResp(w)
+	resp.setStale(w, stale)
+	ah.writeResp(w, resp)
 
 }
 
 // GetAll godoc
 // @Summary		 Получить все валюты
-// @Description	 Получить все валюты из источника. Если источник не указан, берутся данные из источника по умолчанию (ЦБ РФ)
+// @Description	 Получить все валюты из источника. В прежнем пути '/getall' без источника берутся данные из источника по умолчанию (ЦБ РФ)
 // @Tags 	 	 GetAll
 // @ID 			 getAll
 // @Accept 		 json
 // @Produce  	 json
 // @Param 		 source 	path 		string 		true 	"source"
 // @Success 	 200 	  {object} 		handler.Response{data=[]domain.CurrModel}
-// @Failure 	 400 	  {object}  handler.Response
-// @Failure 	 404 	  {object}  handler.Response
-// @Failure		 500 	  {object} 	handler.Response
-// @Router 		 /getAll		 		[get]
-// @Examples      /getAll?source=RU
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 404 	  {object}  handler.Problem
+// @Failure		 500 	  {object} 	handler.Problem
+// @Failure		 503 	  {object} 	handler.Problem
+// @Failure		 405 	  {object} 	handler.Problem
+// @Router 		 /v1/sources/{source}/rates		 		[get]
+// @Examples      /v1/sources/RU/rates
 func (ah *APIHandler) getAll(w http.ResponseWriter, r *http.Request) {
 	var resp Response
 	w.Header().Set("Content-Type", `application/json`)
-	params, err := url.ParseQuery(r.URL.RawQuery)
-	//Проверка на правильность ввода параметров
-	if err != nil || len(params) == 0 {
-		resp.SetAnswer(http.StatusBadRequest, "Wrong query passed", []interface{}{})
-		resp.WriteResp(w)
+	params, ok := ah.params(w, r)
+	if !ok {
 		return
 	}
-	data, err := ah.Service.GetAll(params.Get("source"))
+	data, stale, err := ah.Service.GetAll(params.Get("source"))
 	if err != nil {
-		resp.SetAnswer(http.StatusBadRequest, err.Error(), []interface{}{})
-		resp.WriteResp(w)
+		ah.writeError(w, r, err)
 		logger.Printf("%s", "GetAll: "+err.Error())
 		return
 	}
 	resp.SetAnswer(http.StatusOK, "Getting all queries from source "+params.Get("source")+" successful", []interface{}{data})
-	resp.WriteResp(w)
+	resp.setStale(w, stale)
+	ah.writeResp(w, resp)
+
+}
+
+// Rate godoc
+// @Summary		 Курс валюты
+// @Description	 Курс одной валюты источника с учетом ручного курса. Валюта ищется так же, как в конвертации, в том числе в связанном источнике
+// @Tags 	 	 GetAll
+// @ID 			 rate
+// @Produce  	 json
+// @Param 		 source 	path 		string 		true 	"source"
+// @Param 		 code 		path 		string 		true 	"currency code"
+// @Success 	 200 	  {object} 		handler.Response{data=[]domain.CurrModel}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 404 	  {object}  handler.Problem
+// @Failure		 500 	  {object} 	handler.Problem
+// @Failure		 503 	  {object} 	handler.Problem
+// @Router 		 /v1/sources/{source}/rates/{code}		 		[get]
+// @Examples      /v1/sources/TH/rates/USD
+func (ah *APIHandler) rate(w http.ResponseWriter, r *http.Request) {
+	var resp Response
+	w.Header().Set("Content-Type", `application/json`)
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	data, stale, err := ah.Service.GetRate(params.Get("source"), params.Get("code"))
+	if err != nil {
+		ah.writeError(w, r, err)
+		logger.Printf("%s", "Rate: "+err.Error())
+		return
+	}
+	resp.SetAnswer(http.StatusOK, "Getting rate "+data.Code+" from source "+data.Source+" successful", []interface{}{data})
+	resp.setStale(w, stale)
+	ah.writeResp(w, resp)
+}
+
+// PolicyRates godoc
+// @Summary		 Ключевая ставка
+// @Description	 Действующая ключевая ставка центрального банка и история ее изменений. Если источник не указан, берутся данные ЦБ РФ
+// @Tags 	 	 PolicyRates
+// @ID 			 policyRates
+// @Produce  	 json
+// @Param 		 source 	path 		string 		true 	"source"
+// @Param 		 from 		query 		string 		false 	"from (yyyy-mm-dd)"
+// @Param 		 to 		query 		string 		false 	"to (yyyy-mm-dd)"
+// @Success 	 200 	  {object} 		handler.Response{data=[]api.PolicyRatesResponse}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Router 		 /v1/sources/{source}/policy-rates		 		[get]
+// @Examples      /v1/sources/RU/policy-rates?from=2024-01-01
+func (ah *APIHandler) policyRates(w http.ResponseWriter, r *http.Request) {
+	var resp Response
+	w.Header().Set("Content-Type", `application/json`)
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	data, err := ah.Service.GetPolicyRates(params.Get("source"), params.Get("from"), params.Get("to"))
+	if err != nil {
+		ah.writeError(w, r, err)
+		logger.Printf("%s", "PolicyRates: "+err.Error())
+		return
+	}
+	resp.SetAnswer(http.StatusOK, "Getting policy rates from source "+data.Source+" successful", []interface{}{data})
+	ah.writeResp(w, resp)
+}
 
+// Changes godoc
+// @Summary		 Изменения курсов
+// @Description	 Изменения курсов источника между двумя снимками, заданными идентификатором или датой курсов (yyyy-mm-dd). По умолчанию действующий снимок сравнивается с последним предыдущим снимком с курсами на более раннюю дату или с другими курсами. top=N возвращает N валют с наибольшим изменением курса покупки
+// @Tags 	 	 Changes
+// @ID 			 changes
+// @Produce  	 json
+// @Param 		 source 	path 		string 		true 	"source"
+// @Param 		 from 		query 		string 		false 	"from (snapshot id or yyyy-mm-dd)"
+// @Param 		 to 		query 		string 		false 	"to (snapshot id or yyyy-mm-dd)"
+// @Param 		 top 		query 		int 		false 	"top"
+// @Success 	 200 	  {object} 		handler.Response{data=[]api.ChangesResponse}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Router 		 /v1/sources/{source}/changes		 		[get]
+// @Examples      /v1/sources/RU/changes?from=2024-01-09&to=2024-01-10&top=5
+func (ah *APIHandler) changes(w http.ResponseWriter, r *http.Request) {
+	var resp Response
+	w.Header().Set("Content-Type", `application/json`)
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	data, err := ah.Service.GetChanges(params.Get("source"), params.Get("from"), params.Get("to"), params.Get("top"))
+	if err != nil {
+		ah.writeError(w, r, err)
+		logger.Printf("%s", "Changes: "+err.Error())
+		return
+	}
+	resp.SetAnswer(http.StatusOK, "Getting changes from source "+data.Source+" successful", []interface{}{data})
+	ah.writeResp(w, resp)
 }
+
+// Drifts godoc
+// @Summary		 Расхождения схемы источника
+// @Description	 Последние отчеты о расхождении тела ответа источника с ожидаемой схемой. Тела ответа в карантине приводятся в отчете
+// @Tags 	 	 Admin
+// @ID 			 drifts
+// @Produce  	 json
+// @Security 	 AdminToken
+// @Param 		 source 	query 		string 		false 	"source"
+// @Success 	 200 	  {object} 		handler.Response{data=[]domain.DriftReport}
+// @Failure 	 400 	  {object}  handler.Problem
+// @Failure 	 401 	  {object}  handler.Problem
+// @Router 		 /v1/admin/drift		 		[get]
+// @Examples      /v1/admin/drift?source=RU
+func (ah *APIHandler) drifts(w http.ResponseWriter, r *http.Request, identity string) {
+	var resp Response
+	params, ok := ah.params(w, r)
+	if !ok {
+		return
+	}
+	data, err := ah.Service.GetDrifts(params.Get("source"))
+	if err != nil {
+		ah.writeError(w, r, err)
+		logger.Printf("%s", "Drifts: "+err.Error())
+		return
+	}
+	resp.SetAnswer(http.StatusOK, "Getting drift reports successful", []interface{}{data})
+	ah.writeResp(w, resp)
+}
+
 func (ah *APIHandler) greet(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Convertation service. Use `/convert`. %s", time.Now())
+	fmt.Fprintf(w, "Convertation service. Use `/v1/sources/{source}/convert`. %s", time.Now())
 }
 
 // Периодическое обновление данных
@@ -198,6 +393,10 @@ func (ah *APIHandler) update(locTime *time.Location, timeInDay map[string]time.T
 		updatedSources := make([]bool, len(timeInDay))
 		for k, i := range sources {
 			t := time.Now().In(locTime)
+			if ah.isSuspended(i, t) {
+				logger.Printf("%s", defaultMessage+"Updates for source "+i+" are suspended")
+				continue
+			}
 			//Поиск последней даты
 			init_date, err := ah.Service.GetDateFromSource(i)
 			logger.Printf("last date %s", init_date.Format(time.DateOnly))
@@ -222,7 +421,7 @@ func (ah *APIHandler) update(locTime *time.Location, timeInDay map[string]time.T
 				logger.Printf("%s", defaultMessage+"Starting to update data for source "+i)
 				err := ah.Service.UpdateAllInSource(i, locTime, timeForUpdate)
 				if err != nil {
-					logger.Printf("%s", defaultMessage+"Cannot update in source "+i+". Will try again later Error:"+err.Error())
+					ah.handleUpdateErr(i, t, err)
 					updatedSources[k] = false
 				} else {
 					logger.Printf("%s", defaultMessage+"Succsessfully updated data for source "+i)
@@ -263,3 +462,51 @@ func (ah *APIHandler) UpdatingSources(timeWait int, locTime *time.Location, time
 		}
 	}
 }
+
+// Проверка приостановки обновления источника. По истечении срока источник снова обновляется
+func (ah *APIHandler) isSuspended(source string, t time.Time) bool {
+	until, ok := ah.suspended[source]
+	if !ok {
+		return false
+	}
+	if !until.IsZero() && t.After(until) {
+		delete(ah.suspended, source)
+		return false
+	}
+	return true
+}
+
+// Реакция планировщика на ошибку обновления в зависимости от класса ошибки источника.
+// После отказа в доступе источник ждет час, при превышении квоты - следующих суток,
+// остальные ошибки повторяются на следующем цикле
+func (ah *APIHandler) handleUpdateErr(source string, t time.Time, err error) {
+	defaultMessage := "Update: "
+	if errors.Is(err, domain.ErrQuarantined) {
+		//Снимок уже ожидает решения администратора, повтор на следующем цикле не создает новый снимок
+		logger.Printf("%s", defaultMessage+"Rates of source "+source+" are quarantined, serving last good data. "+err.Error())
+		return
+	}
+	if errors.Is(err, domain.ErrNotLeader) {
+		logger.Printf("%s", defaultMessage+"Replica lost leader lease, rates of source "+source+" are not stored")
+		return
+	}
+	var upErr *domain.UpstreamError
+	if !errors.As(err, &upErr) {
+		logger.Printf("%s", defaultMessage+"Cannot update in source "+source+". Will try again later Error:"+err.Error())
+		return
+	}
+	switch upErr.Class {
+	case domain.UpstreamAuth:
+		//Все ключи источника отклонены. Новые ключи могут появиться в файле ключей, поэтому источник проверяется снова через час
+		ah.suspended[source] = t.Add(authRetryDelay)
+		logger.Printf("ALERT %sAuthorization to source %s failed with all keys, updates suspended until %s. Check access keys. Error: %s", defaultMessage, source, ah.suspended[source].Format(time.DateTime), upErr.Error())
+	case domain.UpstreamQuota:
+		y, m, d := t.Date()
+		ah.suspended[source] = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		logger.Printf("ALERT %sQuota for source %s exceeded, updates suspended until %s. Error: %s", defaultMessage, source, ah.suspended[source].Format(time.DateTime), upErr.Error())
+	case domain.UpstreamBadRequest, domain.UpstreamMalformed:
+		logger.Printf("ALERT %sSource %s rejected request or returned unexpected data. Will try again later. Error: %s", defaultMessage, source, upErr.Error())
+	default:
+		logger.Printf("%s", defaultMessage+"Source "+source+" is unavailable. Will try again later Error:"+upErr.Error())
+	}
+}
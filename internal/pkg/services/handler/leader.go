@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Обновление источников только в реплике-лидере. Реплики пытаются получить аренду каждую треть срока ttl,
+// лидер тем же запросом продлевает ее. Получив аренду, реплика запускает update, потеряв - останавливает.
+// Если бд не отвечает, лидер останавливает обновление, когда с последнего продления прошел срок аренды:
+// к этому времени аренду может получить другая реплика. После падения лидера обновление продолжает
+// другая реплика не позже чем через 4/3 ttl. Запросы клиентов обслуживают все реплики
+func (ah *APIHandler) lead(ttl time.Duration, update func(ctx context.Context) error, ctx context.Context) error {
+	defaultMessage := "Leader election: "
+	var (
+		stop    context.CancelFunc
+		done    chan struct{}
+		updErr  error
+		renewed time.Time
+	)
+	//Остановка обновления и ожидание его завершения
+	stepDown := func() {
+		if stop == nil {
+			return
+		}
+		stop()
+		<-done
+		stop, done = nil, nil
+	}
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		leader, err := ah.Service.AcquireLeadership(ttl)
+		switch {
+		case err != nil:
+			logger.Printf("%s", defaultMessage+"Cannot acquire leader lease. Error:"+err.Error())
+			if stop != nil && time.Since(renewed) >= ttl {
+				logger.Printf("%s", defaultMessage+"ALERT Leader lease expired without renewal, stopping update")
+				stepDown()
+				//Аренда уже истекла, освобождение только сбрасывает токен реплики
+				_ = ah.Service.ReleaseLeadership()
+			}
+		case leader && stop == nil:
+			renewed = start
+			logger.Printf("%s", defaultMessage+"Became leader, starting update")
+			leaderCtx, cancel := context.WithCancel(ctx)
+			finished := make(chan struct{})
+			stop, done = cancel, finished
+			go func() {
+				defer close(finished)
+				updErr = update(leaderCtx)
+			}()
+		case leader:
+			renewed = start
+		case stop != nil:
+			logger.Printf("%s", defaultMessage+"Leader lease taken by another replica, stopping update")
+			stepDown()
+		}
+		select {
+		case <-ctx.Done():
+			stepDown()
+			if err := ah.Service.ReleaseLeadership(); err != nil {
+				logger.Printf("%s", defaultMessage+"Cannot release leader lease. Error:"+err.Error())
+			}
+			return errors.New("update stopped")
+		case <-done:
+			//Обновление завершилось с ошибкой, аренда освобождается для другой реплики
+			stop()
+			stop, done = nil, nil
+			if err := ah.Service.ReleaseLeadership(); err != nil {
+				logger.Printf("%s", defaultMessage+"Cannot release leader lease. Error:"+err.Error())
+			}
+			return updErr
+		case <-ticker.C:
+		}
+	}
+}
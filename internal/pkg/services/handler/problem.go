@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"main/internal/pkg/services/api"
+	"net/http"
+	"strings"
+)
+
+// Описание ошибки по RFC 7807 (application/problem+json). Code - стабильный код ошибки из каталога api.Code*
+type Problem struct {
+	//Идентификатор вида ошибки, например /problems/unknown-source
+	Type string `json:"type"`
+	//Краткое описание вида ошибки, не зависит от запроса
+	Title string `json:"title"`
+	//Код ответа HTTP
+	Status int `json:"status"`
+	//Описание ошибки для этого запроса
+	Detail string `json:"detail,omitempty"`
+	//Путь запроса
+	Instance string `json:"instance,omitempty"`
+	//Код ошибки
+	Code string `json:"code"`
+}
+
+// Код ответа HTTP и описание для кода ошибки
+type problemKind struct {
+	status int
+	title  string
+}
+
+// Каталог ошибок. Ошибки, которых нет в каталоге, отдаются как INTERNAL_ERROR
+var problems = map[string]problemKind{
+	api.CodeInvalidRequest:      {http.StatusBadRequest, "Invalid request parameters"},
+	api.CodeUnauthorized:        {http.StatusUnauthorized, "Admin token required"},
+	api.CodeAdminDisabled:       {http.StatusForbidden, "Admin API is disabled"},
+	api.CodeUnknownSource:       {http.StatusNotFound, "Unknown source"},
+	api.CodeUnsupportedCurrency: {http.StatusNotFound, "Currency is not supported by source"},
+	api.CodeNotFound:            {http.StatusNotFound, "Resource not found"},
+	api.CodeMethodNotAllowed:    {http.StatusMethodNotAllowed, "Method not allowed"},
+	api.CodeInvalidState:        {http.StatusUnprocessableEntity, "Request conflicts with current state"},
+	api.CodeCorruptData:         {http.StatusInternalServerError, "Stored data is corrupt"},
+	api.CodeInternal:            {http.StatusInternalServerError, "Internal error"},
+	api.CodeDBUnavailable:       {http.StatusServiceUnavailable, "Database is unavailable"},
+	api.CodeDBTimeout:           {http.StatusGatewayTimeout, "Database did not respond in time"},
+}
+
+// Ошибки хранилища, которые и в прежнем формате отдавались со своим кодом. Остальные ошибки
+// в режиме LEGACY_ENVELOPE отдаются с кодом 400, как до появления каталога
+var legacyCodes = map[string]bool{
+	api.CodeNotFound:      true,
+	api.CodeCorruptData:   true,
+	api.CodeDBUnavailable: true,
+	api.CodeDBTimeout:     true,
+}
+
+// Ответ на ошибку бизнес-логики
+func (ah *APIHandler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	ah.writeProblem(w, r, api.ErrorCode(err), err.Error())
+}
+
+// Ответ с ошибкой. В режиме LEGACY_ENVELOPE ответ пишется прежним форматом Response с кодом 200,
+// кроме ошибок доступа и метода, которые и раньше возвращали свой код. Код из каталога передается в поле error_code
+func (ah *APIHandler) writeProblem(w http.ResponseWriter, r *http.Request, code string, detail string) {
+	kind, ok := problems[code]
+	if !ok {
+		code, kind = api.CodeInternal, problems[api.CodeInternal]
+	}
+	if ah.legacyEnvelope {
+		switch kind.status {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusMethodNotAllowed:
+			w.WriteHeader(kind.status)
+		}
+		status := kind.status
+		switch {
+		case status == http.StatusUnauthorized, status == http.StatusForbidden, status == http.StatusMethodNotAllowed:
+		case !legacyCodes[code]:
+			status = http.StatusBadRequest
+		}
+		var resp Response
+		resp.SetAnswer(status, detail, nil)
+		resp.ErrorCode = code
+		resp.WriteResp(w)
+		return
+	}
+	p := Problem{
+		Type:     "/problems/" + strings.ToLower(strings.ReplaceAll(code, "_", "-")),
+		Title:    kind.title,
+		Status:   kind.status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		logger.Printf("Cannot write problem %s with detail %s. Error: %s", code, detail, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(kind.status)
+	w.Write(body)
+}
+
+// Успешный ответ. Код ответа HTTP совпадает с полем code, в режиме LEGACY_ENVELOPE всегда 200
+func (ah *APIHandler) writeResp(w http.ResponseWriter, resp Response) {
+	if !ah.legacyEnvelope && resp.Code != 0 {
+		w.WriteHeader(resp.Code)
+	}
+	resp.WriteResp(w)
+}
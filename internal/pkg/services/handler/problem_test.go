@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"main/config"
+	"main/internal/pkg/domain"
+	"main/internal/pkg/services/api"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Ошибки каталога. Ошибки бизнес-логики получаются запросами к сервису с пустым хранилищем в памяти,
+// ошибки доступа и метода пишутся хендлером без ошибки сервиса (err == nil)
+var errorCases = []struct {
+	code string
+	err  func(t *testing.T, a *api.API) error
+	//Код ответа HTTP и код ответа в режиме LEGACY_ENVELOPE
+	status, legacyStatus int
+}{
+	{api.CodeInvalidRequest, func(t *testing.T, a *api.API) error {
+		_, _, err := a.Convert(api.SourceRU, "USD", "EUR", "abc", "buy")
+		return err
+	}, http.StatusBadRequest, http.StatusBadRequest},
+	{api.CodeUnknownSource, func(t *testing.T, a *api.API) error {
+		_, _, err := a.GetAll("XX")
+		return err
+	}, http.StatusNotFound, http.StatusBadRequest},
+	{api.CodeUnsupportedCurrency, func(t *testing.T, a *api.API) error {
+		_, _, err := a.Convert(api.SourceRU, "USD", "EUR", "1", "buy")
+		return err
+	}, http.StatusNotFound, http.StatusBadRequest},
+	{api.CodeNotFound, func(t *testing.T, a *api.API) error {
+		_, _, err := a.GetAll(api.SourceRU)
+		return err
+	}, http.StatusNotFound, http.StatusNotFound},
+	{api.CodeInvalidState, func(t *testing.T, a *api.API) error {
+		p, err := a.ProposeOverride(api.OverrideRequest{Source: api.SourceRU, Code: "USD", RatioBuy: "100", Reason: "market closed"}, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = a.ApproveProposal(p.ID, "alice")
+		return err
+	}, http.StatusUnprocessableEntity, http.StatusBadRequest},
+	{api.CodeCorruptData, func(t *testing.T, a *api.API) error {
+		return &domain.RepoError{Kind: domain.ErrCorruptRecord, Key: "currency:RU:USD"}
+	}, http.StatusInternalServerError, http.StatusInternalServerError},
+	{api.CodeDBUnavailable, func(t *testing.T, a *api.API) error {
+		return &domain.RepoError{Kind: domain.ErrConnLost, Err: errors.New("connection refused")}
+	}, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	{api.CodeDBTimeout, func(t *testing.T, a *api.API) error {
+		return &domain.RepoError{Kind: domain.ErrDBTimeout}
+	}, http.StatusGatewayTimeout, http.StatusGatewayTimeout},
+	{api.CodeInternal, func(t *testing.T, a *api.API) error {
+		return errors.New("unexpected")
+	}, http.StatusInternalServerError, http.StatusBadRequest},
+	{api.CodeUnauthorized, nil, http.StatusUnauthorized, http.StatusUnauthorized},
+	{api.CodeAdminDisabled, nil, http.StatusForbidden, http.StatusForbidden},
+	{api.CodeMethodNotAllowed, nil, http.StatusMethodNotAllowed, http.StatusMethodNotAllowed},
+}
+
+func newTestAPI(t *testing.T) *api.API {
+	t.Helper()
+	ctx := context.Background()
+	a, err := api.NewAPI(&config.AppConfig{DbBackend: config.DbMemory, Loc: time.UTC, ProposalTTL: 24}, ctx)
+	if err != nil {
+		t.Fatalf("cannot create api: %v", err)
+	}
+	t.Cleanup(func() { a.ExitConnectWithDb(ctx) })
+	return a
+}
+
+// Запись ошибки случая в ответ
+func writeCase(t *testing.T, ah *APIHandler, a *api.API, code string, errFn func(t *testing.T, a *api.API) error) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/sources/RU/rates", nil)
+	if errFn == nil {
+		ah.writeProblem(w, r, code, "detail")
+		return w
+	}
+	err := errFn(t, a)
+	if got := api.ErrorCode(err); got != code {
+		t.Fatalf("expected error with code %s, got %s (%v)", code, got, err)
+	}
+	ah.writeError(w, r, err)
+	return w
+}
+
+func TestWriteErrorProblem(t *testing.T) {
+	a := newTestAPI(t)
+	ah := &APIHandler{Service: a}
+	for _, c := range errorCases {
+		t.Run(c.code, func(t *testing.T) {
+			w := writeCase(t, ah, a, c.code, c.err)
+			if w.Code != c.status {
+				t.Fatalf("expected status %d, got %d", c.status, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Fatalf("expected problem content type, got %q", ct)
+			}
+			var p Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Code != c.code || p.Status != c.status || p.Title != problems[c.code].title ||
+				p.Instance != "/v1/sources/RU/rates" || p.Detail == "" {
+				t.Fatalf("unexpected problem %+v", p)
+			}
+		})
+	}
+}
+
+func TestWriteErrorLegacy(t *testing.T) {
+	a := newTestAPI(t)
+	ah := &APIHandler{Service: a, legacyEnvelope: true}
+	for _, c := range errorCases {
+		t.Run(c.code, func(t *testing.T) {
+			w := writeCase(t, ah, a, c.code, c.err)
+			//Прежний формат отдает код 200, кроме ошибок доступа и метода
+			status := http.StatusOK
+			switch c.status {
+			case http.StatusUnauthorized, http.StatusForbidden, http.StatusMethodNotAllowed:
+				status = c.status
+			}
+			if w.Code != status {
+				t.Fatalf("expected status %d, got %d", status, w.Code)
+			}
+			var resp Response
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != c.legacyStatus || resp.ErrorCode != c.code || resp.Message == "" {
+				t.Fatalf("unexpected response %+v", resp)
+			}
+		})
+	}
+}
+
+// Каждый код каталога покрыт случаем
+func TestErrorCasesCoverCatalogue(t *testing.T) {
+	covered := make(map[string]bool, len(errorCases))
+	for _, c := range errorCases {
+		covered[c.code] = true
+	}
+	for code := range problems {
+		if !covered[code] {
+			t.Errorf("code %s has no case", code)
+		}
+	}
+}
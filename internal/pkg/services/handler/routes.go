@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"expvar"
+	"main/internal/pkg/services/api"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Параметры пути запросов /v1. Заменяют одноименные параметры строки запроса
+var pathParams = []string{"source", "code", "id"}
+
+// Роутер сервиса. Пути /v1 различают методы и принимают источник, валюту и идентификаторы в пути.
+// Прежние пути оставлены для старых клиентов и отвечают с заголовками Deprecation и Link на новый путь
+func (ah *APIHandler) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	get := func(h http.HandlerFunc) map[string]http.HandlerFunc {
+		return map[string]http.HandlerFunc{http.MethodGet: h}
+	}
+	post := func(h http.HandlerFunc) map[string]http.HandlerFunc {
+		return map[string]http.HandlerFunc{http.MethodPost: h}
+	}
+
+	ah.route(mux, "/v1/sources/{source}/rates", get(ah.getAll))
+	ah.route(mux, "/v1/sources/{source}/rates/{code}", get(ah.rate))
+	ah.route(mux, "/v1/sources/{source}/convert", get(ah.convert))
+	ah.route(mux, "/v1/sources/{source}/policy-rates", get(ah.policyRates))
+	ah.route(mux, "/v1/sources/{source}/changes", get(ah.changes))
+
+	ah.route(mux, "/v1/admin/drift", get(ah.admin(ah.drifts)))
+	ah.route(mux, "/v1/admin/quarantine", get(ah.admin(ah.quarantine)))
+	ah.route(mux, "/v1/admin/quarantine/{id}/approve", post(ah.admin(ah.releaseQuarantine)))
+	ah.route(mux, "/v1/admin/quarantine/{id}/reject", post(ah.admin(ah.rejectQuarantine)))
+	ah.route(mux, "/v1/admin/overrides", post(ah.admin(ah.overrides)))
+	ah.route(mux, "/v1/admin/sources/{source}/overrides", get(ah.admin(ah.overrides)))
+	ah.route(mux, "/v1/admin/sources/{source}/overrides/{code}", map[string]http.HandlerFunc{http.MethodDelete: ah.admin(ah.overrides)})
+	ah.route(mux, "/v1/admin/sources/{source}/snapshots", get(ah.admin(ah.snapshots)))
+	ah.route(mux, "/v1/admin/sources/{source}/snapshots/{id}/rollback", post(ah.admin(ah.rollback)))
+	ah.route(mux, "/v1/admin/audit", get(ah.admin(ah.auditLog)))
+	ah.route(mux, "/v1/admin/proposals", get(ah.admin(ah.proposals)))
+	ah.route(mux, "/v1/admin/proposals/{id}/approve", post(ah.admin(ah.resolveProposal(true))))
+	ah.route(mux, "/v1/admin/proposals/{id}/reject", post(ah.admin(ah.resolveProposal(false))))
+
+	//Прежние пути. Методы проверяются, как и раньше, в самих обработчиках
+	mux.HandleFunc("/getall", deprecated("/v1/sources/{source}/rates", ah.getAll))
+	mux.HandleFunc("/getAll", deprecated("/v1/sources/{source}/rates", ah.getAll))
+	mux.HandleFunc("/convert", deprecated("/v1/sources/{source}/convert", ah.convert))
+	mux.HandleFunc("/rates/policy", deprecated("/v1/sources/{source}/policy-rates", ah.policyRates))
+	mux.HandleFunc("/changes", deprecated("/v1/sources/{source}/changes", ah.changes))
+	mux.HandleFunc("/admin/drift", deprecated("/v1/admin/drift", ah.admin(ah.drifts)))
+	mux.HandleFunc("/admin/quarantine", deprecated("/v1/admin/quarantine", ah.admin(ah.quarantine)))
+	mux.HandleFunc("/admin/quarantine/approve", deprecated("/v1/admin/quarantine/{id}/approve", ah.admin(ah.releaseQuarantine)))
+	mux.HandleFunc("/admin/quarantine/reject", deprecated("/v1/admin/quarantine/{id}/reject", ah.admin(ah.rejectQuarantine)))
+	mux.HandleFunc("/admin/overrides", deprecated("/v1/admin/sources/{source}/overrides", ah.admin(ah.overrides)))
+	mux.HandleFunc("/admin/audit", deprecated("/v1/admin/audit", ah.admin(ah.auditLog)))
+	mux.HandleFunc("/admin/snapshots", deprecated("/v1/admin/sources/{source}/snapshots", ah.admin(ah.snapshots)))
+	mux.HandleFunc("/admin/snapshots/rollback", deprecated("/v1/admin/sources/{source}/snapshots/{id}/rollback", ah.admin(ah.rollback)))
+	mux.HandleFunc("/admin/proposals", deprecated("/v1/admin/proposals", ah.admin(ah.proposals)))
+	mux.HandleFunc("/admin/proposals/approve", deprecated("/v1/admin/proposals/{id}/approve", ah.admin(ah.resolveProposal(true))))
+	mux.HandleFunc("/admin/proposals/reject", deprecated("/v1/admin/proposals/{id}/reject", ah.admin(ah.resolveProposal(false))))
+
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("/{$}", ah.greet)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		ah.writeProblem(w, r, api.CodeNotFound, "no route "+r.URL.Path)
+	})
+	return mux
+}
+
+// Регистрация пути с обработчиками по методам. На остальные методы отвечает METHOD_NOT_ALLOWED
+// с заголовком Allow, а не текстом по умолчанию http.ServeMux
+func (ah *APIHandler) route(mux *http.ServeMux, path string, methods map[string]http.HandlerFunc) {
+	allowed := make([]string, 0, len(methods))
+	for method, h := range methods {
+		mux.HandleFunc(method+" "+path, h)
+		allowed = append(allowed, method)
+	}
+	allow := strings.Join(allowed, ", ")
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		ah.writeProblem(w, r, api.CodeMethodNotAllowed, "Use "+allow)
+	})
+}
+
+// Прежний путь запроса. Ответ не меняется, заголовок Link указывает новый путь, если параметры пути
+// переданы в строке запроса
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if link, ok := expandPath(successor, r.URL.Query()); ok {
+			w.Header().Set("Link", "<"+link+`>; rel="successor-version"`)
+		}
+		next(w, r)
+	}
+}
+
+// Подстановка параметров в шаблон пути /v1. ok ложно, если какого то параметра нет
+func expandPath(pattern string, params url.Values) (path string, ok bool) {
+	for _, name := range pathParams {
+		placeholder := "{" + name + "}"
+		if !strings.Contains(pattern, placeholder) {
+			continue
+		}
+		v := params.Get(name)
+		if v == "" {
+			return "", false
+		}
+		pattern = strings.ReplaceAll(pattern, placeholder, url.PathEscape(v))
+	}
+	return pattern, true
+}
+
+// Параметры запроса из строки запроса и пути. Ошибка, если строку запроса нельзя разобрать
+func requestParams(r *http.Request) (url.Values, error) {
+	params, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range pathParams {
+		if v := r.PathValue(name); v != "" {
+			params.Set(name, v)
+		}
+	}
+	return params, nil
+}
+
+// Разбор параметров запроса с ответом INVALID_REQUEST на неверную строку запроса
+func (ah *APIHandler) params(w http.ResponseWriter, r *http.Request) (url.Values, bool) {
+	params, err := requestParams(r)
+	if err != nil {
+		ah.writeProblem(w, r, api.CodeInvalidRequest, "Wrong query passed")
+		return nil, false
+	}
+	return params, true
+}
@@ -0,0 +1,332 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"main/internal/pkg/domain"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Создание Parser для источника, описанного в конфигурации. Тип данных берется из описания
+func NewGenericParser(def domain.SourceDefinition) *Parser {
+	return &Parser{datatype: strings.ToUpper(def.Format), def: &def}
+}
+
+// Разбор тела ответа описанного источника в записи GenericRecord по селекторам из описания
+func (p *Parser) parseGeneric(body []byte) (res []domain.GenericRecord, err error) {
+	switch p.datatype {
+	case "JSON":
+		return p.parseGenericJSON(body)
+	case "XML":
+		return p.parseGenericXML(body)
+	case "CSV":
+		return p.parseGenericCSV(body)
+	}
+	return res, errors.New("wrong datatype " + p.datatype + " for source " + p.def.Code)
+}
+
+// Приведение записей описанного источника к модели бд. Курсы нормализуются на номинал
+func (p *Parser) genericToDTO(records []domain.GenericRecord) (dom []domain.CurrModel, err error) {
+	def := p.def
+	layout := def.DateFormat
+	if layout == "" {
+		layout = time.DateOnly
+	}
+	for _, r := range records {
+		if domain.NormalizeCurrCode(r.Code) == "" {
+			continue
+		}
+		date := time.Now().Format(time.DateOnly)
+		if r.Date != "" {
+			parsed, err := time.Parse(layout, strings.TrimSpace(r.Date))
+			if err != nil {
+				return dom, errors.New("wrong date " + r.Date + " in source " + def.Code + ". Abort")
+			}
+			date = parsed.Format(time.DateOnly)
+		}
+		nominal := 1.0
+		if r.Nominal != "" {
+			if nominal, err = p.genericFloat(r.Nominal); err != nil || nominal <= 0 {
+				return dom, errors.New("wrong nominal in source " + def.Code + " for curr " + r.Code + ". Abort")
+			}
+		}
+		buy, err := p.genericFloat(r.Buy)
+		if err != nil {
+			return dom, errors.New("wrong RatioBuy in source " + def.Code + " for curr " + r.Code + ". Abort")
+		}
+		sell := buy
+		if def.Fields.Sell != "" {
+			if sell, err = p.genericFloat(r.Sell); err != nil {
+				return dom, errors.New("wrong RatioSell in source " + def.Code + " for curr " + r.Code + ". Abort")
+			}
+		}
+		name := r.Name
+		if name == "" {
+			name = r.Code
+		}
+		dom = append(dom, domain.ToCurrModel(date, def.Code, domain.NormalizeCurrCode(r.Code), strings.TrimSpace(name),
+			strconv.FormatFloat(buy/nominal, 'f', -1, 64), strconv.FormatFloat(sell/nominal, 'f', -1, 64)))
+	}
+	if len(dom) == 0 {
+		logger.Println("Nil data in source " + def.Code)
+		return dom, errors.New("parsed nil data from source " + def.Code + ". abort")
+	}
+	return dom, nil
+}
+
+// Число с учетом десятичного разделителя источника
+func (p *Parser) genericFloat(val string) (float64, error) {
+	val = strings.TrimSpace(val)
+	if p.def.DecimalSeparator == "," {
+		val = strings.ReplaceAll(strings.ReplaceAll(val, ".", ""), ",", ".")
+	}
+	//Разделители разрядов
+	val = strings.NewReplacer(" ", "", "\u00a0", "").Replace(val)
+	return strconv.ParseFloat(val, 64)
+}
+
+// JSON: путь к списку записей через точку, "$" или пустой путь - корень документа
+func (p *Parser) parseGenericJSON(body []byte) (res []domain.GenericRecord, err error) {
+	var root interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err = d.Decode(&root); err != nil {
+		return res, err
+	}
+	items, ok := jsonPath(root, p.def.Items).([]interface{})
+	if !ok {
+		return res, errors.New("no list found by path " + p.def.Items + " in source " + p.def.Code)
+	}
+	field := func(item interface{}, path string) string {
+		if path == "" {
+			return ""
+		}
+		if strings.HasPrefix(path, "$.") {
+			return jsonString(jsonPath(root, path))
+		}
+		return jsonString(jsonPath(item, path))
+	}
+	f := p.def.Fields
+	for _, item := range items {
+		res = append(res, domain.GenericRecord{
+			Date:    field(item, f.Date),
+			Code:    field(item, f.Code),
+			Name:    field(item, f.Name),
+			Nominal: field(item, f.Nominal),
+			Buy:     field(item, f.Buy),
+			Sell:    field(item, f.Sell),
+		})
+	}
+	return res, nil
+}
+
+// Значение по пути через точку. Числовые сегменты пути обращаются к элементам списка
+func jsonPath(node interface{}, path string) interface{} {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return node
+	}
+	for _, seg := range strings.Split(path, ".") {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			node = n[seg]
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil
+			}
+			node = n[i]
+		default:
+			return nil
+		}
+	}
+	return node
+}
+
+func jsonString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	return ""
+}
+
+// Узел XML-документа для выборки по пути
+type xmlNode struct {
+	name     string
+	attrs    map[string]string
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// Построение дерева XML-документа. Кодировка определяется по заголовку документа
+func parseXMLTree(body []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.CharsetReader = charset.NewReaderLabel
+	var root *xmlNode
+	stack := make([]*xmlNode, 0)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: make(map[string]string, len(t.Attr))}
+			for _, a := range t.Attr {
+				//Объявления пространств имен не являются данными
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+					continue
+				}
+				n.attrs[a.Name.Local] = a.Value
+			}
+			if len(stack) == 0 {
+				root = n
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) != 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("empty xml document")
+	}
+	return root, nil
+}
+
+// Все узлы по пути через "/" относительно узла
+func (n *xmlNode) selectAll(path string) []*xmlNode {
+	nodes := []*xmlNode{n}
+	for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		if seg == "" || seg == "." {
+			continue
+		}
+		next := make([]*xmlNode, 0)
+		for _, node := range nodes {
+			for _, c := range node.children {
+				if c.name == seg {
+					next = append(next, c)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// Значение по пути. Последний сегмент вида "@name" выбирает атрибут
+func (n *xmlNode) value(path string) string {
+	if path == "" {
+		return ""
+	}
+	attr := ""
+	if i := strings.LastIndex(path, "@"); i >= 0 {
+		path, attr = strings.TrimSuffix(path[:i], "/"), path[i+1:]
+	}
+	nodes := n.selectAll(path)
+	if len(nodes) == 0 {
+		return ""
+	}
+	if attr != "" {
+		return nodes[0].attrs[attr]
+	}
+	return strings.TrimSpace(nodes[0].text.String())
+}
+
+// XML: путь к записям через "/" начиная с корневого элемента, например "ValCurs/Valute"
+func (p *Parser) parseGenericXML(body []byte) (res []domain.GenericRecord, err error) {
+	root, err := parseXMLTree(body)
+	if err != nil {
+		return res, err
+	}
+	//Путь начинается с корневого элемента. Для выборки он оборачивается в фиктивный узел
+	doc := &xmlNode{children: []*xmlNode{root}}
+	items := doc.selectAll(p.def.Items)
+	if len(items) == 0 {
+		return res, errors.New("no items found by path " + p.def.Items + " in source " + p.def.Code)
+	}
+	field := func(item *xmlNode, path string) string {
+		if strings.HasPrefix(path, "/") {
+			return doc.value(path)
+		}
+		return item.value(path)
+	}
+	f := p.def.Fields
+	for _, item := range items {
+		res = append(res, domain.GenericRecord{
+			Date:    field(item, f.Date),
+			Code:    field(item, f.Code),
+			Name:    field(item, f.Name),
+			Nominal: field(item, f.Nominal),
+			Buy:     field(item, f.Buy),
+			Sell:    field(item, f.Sell),
+		})
+	}
+	return res, nil
+}
+
+// CSV: первая строка - заголовок, поля выбираются по названию колонки
+func (p *Parser) parseGenericCSV(body []byte) (res []domain.GenericRecord, err error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))))
+	if p.def.CSVDelimiter != "" {
+		r.Comma = []rune(p.def.CSVDelimiter)[0]
+	}
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return res, err
+	}
+	if len(rows) < 2 {
+		return res, errors.New("no rows in source " + p.def.Code)
+	}
+	columns := make(map[string]int, len(rows[0]))
+	for i, c := range rows[0] {
+		columns[strings.TrimSpace(c)] = i
+	}
+	f := p.def.Fields
+	for _, name := range []string{f.Code, f.Buy, f.Sell, f.Name, f.Nominal, f.Date} {
+		if _, ok := columns[name]; name != "" && !ok {
+			return res, errors.New("no column " + name + " in source " + p.def.Code)
+		}
+	}
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if name == "" || !ok || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+	for _, row := range rows[1:] {
+		res = append(res, domain.GenericRecord{
+			Date:    field(row, f.Date),
+			Code:    field(row, f.Code),
+			Name:    field(row, f.Name),
+			Nominal: field(row, f.Nominal),
+			Buy:     field(row, f.Buy),
+			Sell:    field(row, f.Sell),
+		})
+	}
+	return res, nil
+}
@@ -12,29 +12,46 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html/charset"
 )
 
 const SourceRU = "RU"
 const SourceTH = "TH"
+const SourceKZ = "KZ"
+const SourceRUMetals = "RU_METALS"
+
+// Псевдокоды драгоценных металлов по кодам ЦБ РФ
+var metalCodes = map[string][2]string{
+	"1": {"XAU", "Золото"},
+	"2": {"XAG", "Серебро"},
+	"3": {"XPT", "Платина"},
+	"4": {"XPD", "Палладий"},
+}
 
 // Структура Parser
 type Parser struct {
 	datatype string
+	//Описание источника из конфигурации. Пусто для встроенных источников
+	def *domain.SourceDefinition
 }
 
 var logger = log.New(os.Stdout, "Parser ", log.LstdFlags|log.Lshortfile)
 
 // Создание нового Parser. Parser реализует парсинг тела ответа в зависимости от типа данных. Нужен тип данных тела ответа
 func NewParser(datatype string) *Parser {
-	return &Parser{datatype}
+	return &Parser{datatype: datatype}
 }
 
 // Метод Parser. В зависимости от тела ответа и источника идет приведение к структурам пакета domain.
 // Возвращает ненулевую ошибку если тело пусто или такого источника нет
 func (p *Parser) Parse(source string, body []byte) (res interface{}, err error) {
 	var toParse interface{}
+	//Источник описан в конфигурации
+	if p.def != nil && p.def.Code == source {
+		return p.parseGeneric(body)
+	}
 
 	//Поиск по источнику
 	switch source {
@@ -47,6 +64,10 @@ func (p *Parser) Parse(source string, body []byte) (res interface{}, err error)
 		toParse = new(domain.RUsourceDTO)
 	case SourceTH:
 		toParse = new(domain.THsourceDTO)
+	case SourceKZ:
+		toParse = new(domain.KZsourceDTO)
+	case SourceRUMetals:
+		toParse = new(domain.RUMetalsDTO)
 	}
 
 	switch p.datatype {
@@ -93,19 +114,25 @@ func (p *Parser) Parse(source string, body []byte) (res interface{}, err error)
 }
 
 func (p *Parser) ParseCurrstoDTO(newCurr interface{}, source string) (dom []domain.CurrModel, err error) {
+	if p.def != nil && p.def.Code == source {
+		records, ok := newCurr.([]domain.GenericRecord)
+		if !ok {
+			return dom, errors.New("wrong data for source " + source + " provided")
+		}
+		return p.genericToDTO(records)
+	}
 	//При разных источниках разные структуры ответа
 	switch source {
 	case SourceRU:
 		{
 			RUDTO := newCurr.(*domain.RUsourceDTO)
-			splt := strings.Split(RUDTO.Date, ".")
-			//Приведение даты к формату yyyy-mm-dd
-			newDate := splt[2] + "-" + splt[1] + "-" + splt[0]
-			//Случай получения пустых данных
-			if len(newDate) == 0 {
+			//Приведение даты к формату yyyy-mm-dd. Случай получения пустых данных
+			date, err := time.Parse("02.01.2006", RUDTO.Date)
+			if err != nil || len(RUDTO.Valute) == 0 {
 				logger.Println("Nil data in source RU")
 				return []domain.CurrModel{}, errors.New("parsed nil data from source RU. abort")
 			}
+			newDate := date.Format(time.DateOnly)
 			for _, curr := range RUDTO.Valute {
 				dom = append(dom, domain.ToCurrModel(
 					newDate, SourceRU,
@@ -153,6 +180,84 @@ func (p *Parser) ParseCurrstoDTO(newCurr interface{}, source string) (dom []doma
 			}
 
 		}
+	case SourceKZ:
+		{
+			KZDTO := newCurr.(*domain.KZsourceDTO)
+			for _, curr := range KZDTO.Item {
+				//Код валюты берется из fc, а если его нет - из title, поэтому в схеме оба поля необязательны
+				code := strings.TrimSpace(curr.FC)
+				if code == "" {
+					code = strings.TrimSpace(curr.Title)
+				}
+				if code == "" {
+					logger.Println("no currency code in source KZ. Abort")
+					return dom, errors.New("no currency code in source KZ. Abort")
+				}
+				//Без названия валюты, как и в описанных источниках, названием служит код
+				name := strings.TrimSpace(curr.FullName)
+				if name == "" {
+					name = code
+				}
+				//Приведение даты к формату yyyy-mm-dd
+				date, err := time.Parse("02.01.2006", strings.TrimSpace(curr.PubDate))
+				if err != nil {
+					logger.Println("wrong date in source KZ for curr " + code + ". Abort " + err.Error())
+					return dom, errors.New("wrong date in source KZ for curr " + code + ". Abort")
+				}
+				rate, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(curr.Description), ",", ".", 1), 64)
+				if err != nil {
+					logger.Println("wrong rate in source KZ for curr " + code + ". Abort " + err.Error())
+					return dom, errors.New("wrong rate in source KZ for curr " + code + ". Abort")
+				}
+				//Курс публикуется за quant единиц валюты. Далее идет нормализация
+				//(соотношение тенге к единице искомой валюты)
+				quant, err := strconv.ParseFloat(strings.TrimSpace(curr.Quant), 64)
+				if err != nil || quant <= 0 {
+					logger.Println("wrong amount of currency in source KZ for curr " + code + ". Abort")
+					return dom, errors.New("wrong amount of currency in source KZ for curr " + code + ". Abort")
+				}
+				ratio := strconv.FormatFloat(rate/quant, 'f', 7, 64)
+				dom = append(dom, domain.ToCurrModel(date.Format(time.DateOnly), SourceKZ, code, name, ratio, ratio))
+			}
+			//Случай получения пустых данных
+			if len(dom) == 0 {
+				logger.Println("Nil data in source KZ")
+				return dom, errors.New("parsed nil data from source KZ. abort")
+			}
+		}
+	case SourceRUMetals:
+		{
+			MetalsDTO := newCurr.(*domain.RUMetalsDTO)
+			//Запрос охватывает несколько дней, для каждого металла берется последняя цена
+			latest := make(map[string]domain.CurrModel, len(metalCodes))
+			for _, rec := range MetalsDTO.Record {
+				metal, ok := metalCodes[rec.Code]
+				if !ok {
+					continue
+				}
+				date, err := time.Parse("02.01.2006", rec.Date)
+				if err != nil {
+					logger.Println("wrong date in source RU_METALS for metal " + metal[0] + ". Abort " + err.Error())
+					return dom, errors.New("wrong date in source RU_METALS for metal " + metal[0] + ". Abort")
+				}
+				newDate := date.Format(time.DateOnly)
+				if prev, ok := latest[metal[0]]; ok && prev.Date > newDate {
+					continue
+				}
+				latest[metal[0]] = domain.ToCurrModel(newDate, SourceRUMetals, metal[0], metal[1],
+					strings.TrimSpace(rec.Buy), strings.TrimSpace(rec.Sell))
+			}
+			//Случай получения пустых данных
+			if len(latest) == 0 {
+				logger.Println("Nil data in source RU_METALS")
+				return dom, errors.New("parsed nil data from source RU_METALS. abort")
+			}
+			for _, code := range []string{"XAU", "XAG", "XPT", "XPD"} {
+				if m, ok := latest[code]; ok {
+					dom = append(dom, m)
+				}
+			}
+		}
 	default:
 		return dom, errors.New("wrong source " + source + " provided")
 	}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"main/internal/pkg/domain"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Приведение тела ответа с ключевыми ставками к модели бд. Формат определяется источником.
+// Возвращает ненулевую ошибку, если тело не разобрано или ставок нет
+func (p *Parser) ParsePolicyRates(source string, body []byte) (res []domain.PolicyRate, err error) {
+	switch source {
+	case SourceRU:
+		{
+			var dto domain.RUPolicyDTO
+			d := xml.NewDecoder(bytes.NewReader(body))
+			d.CharsetReader = charset.NewReaderLabel
+			if err = d.Decode(&dto); err != nil {
+				return res, err
+			}
+			for _, kr := range dto.KR {
+				if res, err = appendPolicyRate(res, source, kr.DT, kr.Rate); err != nil {
+					return res, err
+				}
+			}
+		}
+	case SourceTH:
+		{
+			var dto domain.THPolicyDTO
+			if err = json.Unmarshal(body, &dto); err != nil {
+				return res, err
+			}
+			for _, pr := range dto.Result.Data {
+				if res, err = appendPolicyRate(res, source, pr.Period, pr.PolicyRate); err != nil {
+					return res, err
+				}
+			}
+		}
+	default:
+		return res, errors.New("no policy rates for source " + source)
+	}
+	if len(res) == 0 {
+		logger.Println("Nil policy rates in source " + source)
+		return res, errors.New("parsed nil policy rates from source " + source + ". abort")
+	}
+	return res, nil
+}
+
+// Проверка и добавление ставки. Дата приводится к формату yyyy-mm-dd
+func appendPolicyRate(res []domain.PolicyRate, source string, date string, rate string) ([]domain.PolicyRate, error) {
+	date = strings.TrimSpace(date)
+	rate = strings.Replace(strings.TrimSpace(rate), ",", ".", 1)
+	if len(date) < 10 {
+		return res, errors.New("wrong policy rate date " + date + " in source " + source + ". Abort")
+	}
+	if _, err := time.Parse(time.DateOnly, date[:10]); err != nil {
+		return res, errors.New("wrong policy rate date " + date + " in source " + source + ". Abort")
+	}
+	if _, err := strconv.ParseFloat(rate, 64); err != nil {
+		return res, errors.New("wrong policy rate " + rate + " in source " + source + ". Abort")
+	}
+	return append(res, domain.PolicyRate{Source: source, Date: date[:10], Rate: rate}), nil
+}
@@ -0,0 +1,320 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"main/internal/pkg/domain"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Тип значения поля схемы
+type valueKind int
+
+const (
+	//Значение не проверяется
+	anyValue valueKind = iota
+	//Строка
+	textValue
+	//Число (в XML допускается запятая, в JSON число передается строкой)
+	numberValue
+	//Дата в формате layout
+	dateValue
+	//Объект JSON или элемент XML с дочерними элементами
+	objectValue
+	//Список JSON
+	arrayValue
+)
+
+// Узел ожидаемой схемы тела ответа
+type schemaNode struct {
+	required bool
+	kind     valueKind
+	layout   string
+	//Атрибуты элемента (только XML)
+	attrs map[string]*schemaNode
+	//Дочерние элементы или поля объекта
+	fields map[string]*schemaNode
+	//Схема элемента списка (только JSON)
+	items *schemaNode
+	//Поля объекта не проверяются
+	open bool
+}
+
+func req(kind valueKind) *schemaNode { return &schemaNode{required: true, kind: kind} }
+func opt(kind valueKind) *schemaNode { return &schemaNode{kind: kind} }
+func reqDate(layout string) *schemaNode {
+	return &schemaNode{required: true, kind: dateValue, layout: layout}
+}
+
+// Схемы тел ответа встроенных источников. Корень XML-схемы - фиктивный узел с корневым элементом документа
+var schemas = map[string]*schemaNode{
+	SourceRU: {kind: objectValue, fields: map[string]*schemaNode{
+		"ValCurs": {required: true, kind: objectValue,
+			attrs: map[string]*schemaNode{"Date": reqDate("02.01.2006"), "name": opt(textValue)},
+			fields: map[string]*schemaNode{
+				"Valute": {required: true, kind: objectValue,
+					attrs: map[string]*schemaNode{"ID": opt(textValue)},
+					fields: map[string]*schemaNode{
+						"NumCode":   opt(textValue),
+						"CharCode":  req(textValue),
+						"Nominal":   req(numberValue),
+						"Name":      req(textValue),
+						"Value":     req(numberValue),
+						"VunitRate": req(numberValue),
+					}},
+			}},
+	}},
+	SourceTH: {required: true, kind: objectValue, fields: map[string]*schemaNode{
+		"result": {required: true, kind: objectValue, fields: map[string]*schemaNode{
+			"api":       opt(textValue),
+			"timestamp": opt(textValue),
+			"data": {required: true, kind: objectValue, fields: map[string]*schemaNode{
+				"data_header": {kind: objectValue, open: true},
+				"data_detail": {required: true, kind: arrayValue, items: &schemaNode{kind: objectValue, fields: map[string]*schemaNode{
+					"period":            reqDate(time.DateOnly),
+					"currency_id":       req(textValue),
+					"currency_name_th":  opt(textValue),
+					"currency_name_eng": req(textValue),
+					"buying_sight":      opt(numberValue),
+					"buying_transfer":   req(numberValue),
+					"selling":           req(numberValue),
+					"mid_rate":          opt(numberValue),
+				}}},
+			}},
+		}},
+	}},
+	SourceKZ: {kind: objectValue, fields: map[string]*schemaNode{
+		"rss": {required: true, kind: objectValue,
+			attrs: map[string]*schemaNode{"version": opt(textValue)},
+			fields: map[string]*schemaNode{
+				"channel": {required: true, kind: objectValue, fields: map[string]*schemaNode{
+					"generator":   opt(textValue),
+					"title":       opt(textValue),
+					"link":        opt(textValue),
+					"description": opt(textValue),
+					"language":    opt(textValue),
+					"copyright":   opt(textValue),
+					"item": {required: true, kind: objectValue, fields: map[string]*schemaNode{
+						"fullname":    opt(textValue),
+						"title":       opt(textValue),
+						"fc":          opt(textValue),
+						"pubDate":     reqDate("02.01.2006"),
+						"description": req(numberValue),
+						"quant":       req(numberValue),
+						"index":       opt(textValue),
+						"change":      opt(textValue),
+						"link":        opt(textValue),
+					}},
+				}},
+			}},
+	}},
+	SourceRUMetals: {kind: objectValue, fields: map[string]*schemaNode{
+		"Metall": {required: true, kind: objectValue,
+			attrs: map[string]*schemaNode{"FromDate": opt(textValue), "ToDate": opt(textValue), "name": opt(textValue)},
+			fields: map[string]*schemaNode{
+				"Record": {kind: objectValue,
+					attrs: map[string]*schemaNode{"Date": reqDate("02.01.2006"), "Code": req(textValue)},
+					fields: map[string]*schemaNode{
+						"Buy":  req(numberValue),
+						"Sell": req(numberValue),
+					}},
+			}},
+	}},
+}
+
+// Сборщик расхождений. Повторяющиеся расхождения (например, в каждой валюте) попадают в отчет один раз
+type driftCollector struct {
+	issues []domain.DriftIssue
+	seen   map[string]bool
+}
+
+func (c *driftCollector) add(kind domain.DriftKind, path string, detail string) {
+	key := string(kind) + " " + path
+	if c.seen[key] {
+		return
+	}
+	c.seen[key] = true
+	c.issues = append(c.issues, domain.DriftIssue{Kind: kind, Path: path, Detail: detail})
+}
+
+// Проверка тела ответа встроенного источника по ожидаемой схеме: новые поля, отсутствующие обязательные поля
+// и изменившиеся типы значений. Для источников без схемы возвращает пустой список
+func (p *Parser) CheckSchema(source string, body []byte) []domain.DriftIssue {
+	schema, ok := schemas[source]
+	if !ok {
+		return nil
+	}
+	c := &driftCollector{seen: make(map[string]bool)}
+	switch p.datatype {
+	case "XML":
+		root, err := parseXMLTree(body)
+		if err != nil {
+			c.add(domain.DriftMalformed, "", err.Error())
+			return c.issues
+		}
+		c.checkXML("", &xmlNode{children: []*xmlNode{root}}, schema)
+	case "JSON":
+		var root interface{}
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		if err := d.Decode(&root); err != nil {
+			c.add(domain.DriftMalformed, "", err.Error())
+			return c.issues
+		}
+		c.checkJSON("", root, schema)
+	}
+	return c.issues
+}
+
+func joinPath(path string, name string, sep string) string {
+	if path == "" {
+		return name
+	}
+	return path + sep + name
+}
+
+// Проверка значения листового поля
+func (c *driftCollector) checkValue(path string, val string, schema *schemaNode) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		if schema.required && schema.kind != anyValue {
+			c.add(domain.DriftMissingField, path, "empty value")
+		}
+		return
+	}
+	switch schema.kind {
+	case numberValue:
+		if _, err := strconv.ParseFloat(strings.Replace(val, ",", ".", 1), 64); err != nil {
+			c.add(domain.DriftChangedType, path, "expected number, got "+strconv.Quote(val))
+		}
+	case dateValue:
+		if _, err := time.Parse(schema.layout, val); err != nil {
+			c.add(domain.DriftChangedType, path, "expected date in format "+schema.layout+", got "+strconv.Quote(val))
+		}
+	}
+}
+
+// Проверка элемента XML
+func (c *driftCollector) checkXML(path string, node *xmlNode, schema *schemaNode) {
+	for _, name := range sortedKeys(node.attrs) {
+		attrSchema, ok := schema.attrs[name]
+		if !ok {
+			if !schema.open {
+				c.add(domain.DriftUnknownField, path+"/@"+name, "")
+			}
+			continue
+		}
+		c.checkValue(path+"/@"+name, node.attrs[name], attrSchema)
+	}
+	for name, attrSchema := range schema.attrs {
+		if _, ok := node.attrs[name]; !ok && attrSchema.required {
+			c.add(domain.DriftMissingField, path+"/@"+name, "")
+		}
+	}
+	if schema.kind != objectValue {
+		if len(node.children) != 0 {
+			c.add(domain.DriftChangedType, path, "expected value, got element with children")
+			return
+		}
+		c.checkValue(path, node.text.String(), schema)
+		return
+	}
+	found := make(map[string]bool, len(node.children))
+	for _, child := range node.children {
+		childPath := joinPath(path, child.name, "/")
+		found[child.name] = true
+		childSchema, ok := schema.fields[child.name]
+		if !ok {
+			if !schema.open {
+				c.add(domain.DriftUnknownField, childPath, "")
+			}
+			continue
+		}
+		c.checkXML(childPath, child, childSchema)
+	}
+	for name, childSchema := range schema.fields {
+		if !found[name] && childSchema.required {
+			c.add(domain.DriftMissingField, joinPath(path, name, "/"), "")
+		}
+	}
+}
+
+// Проверка значения JSON
+func (c *driftCollector) checkJSON(path string, val interface{}, schema *schemaNode) {
+	switch schema.kind {
+	case objectValue:
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			c.add(domain.DriftChangedType, path, fmt.Sprintf("expected object, got %s", jsonKind(val)))
+			return
+		}
+		if schema.open {
+			return
+		}
+		for _, name := range sortedKeys(obj) {
+			fieldSchema, ok := schema.fields[name]
+			if !ok {
+				c.add(domain.DriftUnknownField, joinPath(path, name, "."), "")
+				continue
+			}
+			if obj[name] == nil {
+				continue
+			}
+			c.checkJSON(joinPath(path, name, "."), obj[name], fieldSchema)
+		}
+		for name, fieldSchema := range schema.fields {
+			if v, ok := obj[name]; (!ok || v == nil) && fieldSchema.required {
+				c.add(domain.DriftMissingField, joinPath(path, name, "."), "")
+			}
+		}
+	case arrayValue:
+		arr, ok := val.([]interface{})
+		if !ok {
+			c.add(domain.DriftChangedType, path, fmt.Sprintf("expected list, got %s", jsonKind(val)))
+			return
+		}
+		for _, item := range arr {
+			c.checkJSON(path+"[]", item, schema.items)
+		}
+	case anyValue:
+	default:
+		//Листовые значения источники передают строками
+		s, ok := val.(string)
+		if !ok {
+			c.add(domain.DriftChangedType, path, fmt.Sprintf("expected string, got %s", jsonKind(val)))
+			return
+		}
+		c.checkValue(path, s, schema)
+	}
+}
+
+func jsonKind(val interface{}) string {
+	switch val.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "list"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "bool"
+	case nil:
+		return "null"
+	}
+	return "unknown"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
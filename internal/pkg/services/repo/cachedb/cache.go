@@ -0,0 +1,167 @@
+// cachedb хранит курсы действующих снимков в памяти процесса поверх репозитория бд.
+// Курсы меняются раз в день, поэтому запросы '/convert' и '/getAll' почти всегда обходятся без бд
+package cachedb
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"main/internal/pkg/domain"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+var logger = log.New(os.Stdout, "cachedb ", log.LstdFlags)
+
+// Счетчики обращений к кэшу, доступны по '/debug/vars'
+var (
+	metrics = expvar.NewMap("db_cache")
+	hits    = new(expvar.Int)
+	misses  = new(expvar.Int)
+)
+
+func init() {
+	metrics.Set("hits", hits)
+	metrics.Set("misses", misses)
+	metrics.Set("hit_ratio", expvar.Func(func() any {
+		h, m := hits.Value(), misses.Value()
+		if h+m == 0 {
+			return 0.0
+		}
+		return float64(h) / float64(h+m)
+	}))
+}
+
+// Рассылка сообщений об изменении курсов источника между репликами
+type Broadcaster interface {
+	// Отправка сообщения об изменении действующего снимка источника
+	Publish(ctx context.Context, source string) (err error)
+	// Получение сообщений до закрытия ctx. resync вызывается после переподключения, когда сообщения могли быть пропущены
+	Subscribe(ctx context.Context, changed func(source string), resync func())
+}
+
+// Кэш курсов действующих снимков поверх domain.DatabaseService. Источник читается из бд целиком при первом обращении
+// и хранится не дольше ttl. После записи или активации снимка источник удаляется из кэша, остальные реплики
+// получают сообщение через Broadcaster. Описания снимков и курсы прежних снимков читаются из бд
+type CachedRepository struct {
+	domain.DatabaseService
+	ttl   time.Duration
+	bus   Broadcaster
+	mu    sync.RWMutex
+	items map[string]entry
+	//Поколение кэша растет при каждом сбросе, чтобы чтение, начатое до сброса, не попало в кэш
+	gen uint64
+}
+
+// Курсы источника в кэше
+type entry struct {
+	rates   []domain.CurrModel
+	byCode  map[string]int
+	expires time.Time
+}
+
+// Создание кэша над репозиторием db. Без bus кэш сбрасывается только при записи через эту реплику и по ttl
+func NewCachedRepository(ctx context.Context, db domain.DatabaseService, ttl time.Duration, bus Broadcaster) *CachedRepository {
+	c := &CachedRepository{DatabaseService: db, ttl: ttl, bus: bus, items: make(map[string]entry)}
+	if bus != nil {
+		go bus.Subscribe(ctx, c.invalidate, c.invalidateAll)
+	}
+	return c
+}
+
+// Курсы источника из кэша или из бд. Ошибка чтения бд не кэшируется
+func (c *CachedRepository) load(ctx context.Context, source string) (entry, error) {
+	c.mu.RLock()
+	e, ok := c.items[source]
+	gen := c.gen
+	c.mu.RUnlock()
+	if ok && time.Now().Before(e.expires) {
+		hits.Add(1)
+		return e, nil
+	}
+	misses.Add(1)
+	rates, err := c.DatabaseService.GetAllBySource(ctx, source)
+	if err != nil {
+		return e, err
+	}
+	e = entry{rates: rates, byCode: make(map[string]int, len(rates)), expires: time.Now().Add(c.ttl)}
+	for i, r := range rates {
+		e.byCode[r.Code] = i
+	}
+	c.mu.Lock()
+	if c.gen == gen {
+		c.items[source] = e
+	}
+	c.mu.Unlock()
+	return e, nil
+}
+
+// Получение валюты действующего снимка. Если источник не читается целиком (например, в нем поврежденная запись),
+// валюта читается из бд
+func (c *CachedRepository) GetBySourceAndKey(ctx context.Context, source string, key string) (res domain.CurrModel, err error) {
+	e, err := c.load(ctx, source)
+	if errors.Is(err, domain.ErrCorruptRecord) {
+		return c.DatabaseService.GetBySourceAndKey(ctx, source, key)
+	}
+	if err != nil {
+		return res, err
+	}
+	i, ok := e.byCode[key]
+	if !ok {
+		return res, &domain.RepoError{Kind: domain.ErrNotFound, Key: source + " " + key}
+	}
+	return e.rates[i], nil
+}
+
+// Получение курсов действующего снимка. Возвращается копия, которую вызывающий может менять
+func (c *CachedRepository) GetAllBySource(ctx context.Context, source string) (res []domain.CurrModel, err error) {
+	e, err := c.load(ctx, source)
+	if err != nil {
+		return res, err
+	}
+	return slices.Clone(e.rates), nil
+}
+
+// Запись снимка со сбросом источника в кэше всех реплик
+func (c *CachedRepository) StoreSnapshot(ctx context.Context, snap domain.Snapshot, rates []domain.CurrModel) (err error) {
+	err = c.DatabaseService.StoreSnapshot(ctx, snap, rates)
+	c.changed(ctx, snap.Source)
+	return err
+}
+
+// Активация снимка со сбросом источника в кэше всех реплик
+func (c *CachedRepository) ActivateSnapshot(ctx context.Context, source string, id string) (err error) {
+	err = c.DatabaseService.ActivateSnapshot(ctx, source, id)
+	c.changed(ctx, source)
+	return err
+}
+
+// Сброс источника после записи. Сбрасывается и при ошибке записи: транзакция могла примениться до обрыва связи
+func (c *CachedRepository) changed(ctx context.Context, source string) {
+	c.invalidate(source)
+	if c.bus == nil {
+		return
+	}
+	if err := c.bus.Publish(ctx, source); err != nil {
+		logger.Printf("Cannot publish invalidation of source %s, other replicas refresh it in %s. Error: %s", source, c.ttl, err.Error())
+	}
+}
+
+// Удаление источника из кэша
+func (c *CachedRepository) invalidate(source string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, source)
+	c.gen++
+}
+
+// Удаление всех источников из кэша
+func (c *CachedRepository) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.items)
+	c.gen++
+}
@@ -0,0 +1,54 @@
+package memdb
+
+import (
+	"context"
+	"encoding/json"
+	"main/internal/pkg/domain"
+)
+
+// Количество хранимых записей журнала
+const maxAuditEntries = 10000
+
+// Репозиторий журнала изменений в памяти. Последняя запись - в начале
+type AuditRepository struct {
+	*Store
+}
+
+// Создание нового репозитория. Нужно хранилище в памяти
+func NewAuditRepository(s *Store) *AuditRepository {
+	return &AuditRepository{s}
+}
+
+// Добавление записи в начало журнала. Записи сверх maxAuditEntries удаляются
+func (r *AuditRepository) AppendAudit(ctx context.Context, e domain.AuditEntry) (err error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	r.data.Audit = prepend(r.data.Audit, data, maxAuditEntries)
+	return nil
+}
+
+// Получение последних limit записей журнала
+func (r *AuditRepository) GetAudit(ctx context.Context, limit int) (res []domain.AuditEntry, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	vals := r.data.Audit[:min(limit, len(r.data.Audit))]
+	res = make([]domain.AuditEntry, 0, len(vals))
+	for _, v := range vals {
+		var e domain.AuditEntry
+		if err := json.Unmarshal(v, &e); err != nil {
+			return res, corrupt("audit", err)
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
@@ -0,0 +1,221 @@
+package memdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"main/internal/pkg/domain"
+	"sort"
+	"time"
+)
+
+// Репозиторий хранения курсов в памяти
+type CurrModelRepository struct {
+	*Store
+}
+
+// Создание нового репозитория. Нужно хранилище в памяти
+func NewCurrModelRepository(s *Store) *CurrModelRepository {
+	return &CurrModelRepository{s}
+}
+
+// Чтение валюты снимка. Запись без кода или с неразбираемым JSON считается поврежденной
+func decodeCurr(source string, id string, data []byte) (res domain.CurrModel, err error) {
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, corrupt("snap:"+source+":"+id, err)
+	}
+	if res.Code == "" {
+		return res, corrupt("snap:"+source+":"+id, errors.New("empty currency code"))
+	}
+	res.Source = source
+	res.Snapshot = id
+	return res, nil
+}
+
+// Получение данных по источнику и коду валюты из действующего снимка.
+// Если валюты нет, возвращает ошибку вида domain.ErrNotFound
+func (r *CurrModelRepository) GetBySourceAndKey(ctx context.Context, source string, key string) (res domain.CurrModel, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	id := r.data.Current[source]
+	data, ok := r.data.Snaps[source][id][key]
+	if !ok {
+		return res, &domain.RepoError{Kind: domain.ErrNotFound, Key: source + ":" + key}
+	}
+	return decodeCurr(source, id, data)
+}
+
+// Получение данных по источнику из действующего снимка
+func (r *CurrModelRepository) GetAllBySource(ctx context.Context, source string) (res []domain.CurrModel, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	id, ok := r.data.Current[source]
+	if !ok {
+		return res, nil
+	}
+	return r.snapshotRates(source, id)
+}
+
+// Получение курсов снимка, отсортированных по коду валюты. Если снимка нет, возвращается пустой список
+func (r *CurrModelRepository) GetSnapshotRates(ctx context.Context, source string, id string) (res []domain.CurrModel, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	return r.snapshotRates(source, id)
+}
+
+func (r *CurrModelRepository) snapshotRates(source string, id string) (res []domain.CurrModel, err error) {
+	vals := r.data.Snaps[source][id]
+	res = make([]domain.CurrModel, 0, len(vals))
+	for _, v := range vals {
+		curr, err := decodeCurr(source, id, v)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, curr)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Code < res[j].Code })
+	return res, nil
+}
+
+// Запись снимка и перевод указателя действующего снимка под одной блокировкой.
+// Под той же блокировкой проверяется токен ограждения снимка
+func (r *CurrModelRepository) StoreSnapshot(ctx context.Context, snap domain.Snapshot, rates []domain.CurrModel) (err error) {
+	return r.storeSnapshot(snap, rates, true)
+}
+
+// Запись снимка без перевода указателя действующего снимка
+func (r *CurrModelRepository) AddSnapshot(ctx context.Context, snap domain.Snapshot, rates []domain.CurrModel) (err error) {
+	return r.storeSnapshot(snap, rates, false)
+}
+
+func (r *CurrModelRepository) storeSnapshot(snap domain.Snapshot, rates []domain.CurrModel, activate bool) (err error) {
+	fields := make(map[string]json.RawMessage, len(rates))
+	for _, c := range rates {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		fields[c.Code] = data
+	}
+	snap.Count = len(fields)
+	snap.Active = false
+	info, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if _, err = time.Parse(time.RFC3339, snap.Created); err != nil {
+		return err
+	}
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if snap.Fence != 0 {
+		if r.fences[snap.Source] > snap.Fence {
+			return domain.ErrNotLeader
+		}
+		r.fences[snap.Source] = snap.Fence
+	}
+	if r.data.Snaps[snap.Source] == nil {
+		r.data.Snaps[snap.Source] = make(map[string]map[string]json.RawMessage)
+		r.data.SnapInfo[snap.Source] = make(map[string]json.RawMessage)
+	}
+	//Повторная запись снимка с тем же идентификатором дополняет его, как HSET в Redis
+	if old, ok := r.data.Snaps[snap.Source][snap.ID]; ok {
+		for code, data := range old {
+			if _, ok := fields[code]; !ok {
+				fields[code] = data
+			}
+		}
+	}
+	r.data.Snaps[snap.Source][snap.ID] = fields
+	r.data.SnapInfo[snap.Source][snap.ID] = info
+	if activate {
+		r.data.Current[snap.Source] = snap.ID
+	}
+	return nil
+}
+
+// Активация ранее записанного снимка. Если снимка нет, возвращает ошибку вида domain.ErrNotFound
+func (r *CurrModelRepository) ActivateSnapshot(ctx context.Context, source string, id string) (err error) {
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, ok := r.data.SnapInfo[source][id]; !ok {
+		return &domain.RepoError{Kind: domain.ErrNotFound, Key: "snap:" + source + ":" + id}
+	}
+	r.data.Current[source] = id
+	return nil
+}
+
+// Получение описаний снимков источника от новых к старым
+func (r *CurrModelRepository) GetSnapshots(ctx context.Context, source string) (res []domain.Snapshot, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	infos := r.data.SnapInfo[source]
+	if len(infos) == 0 {
+		return res, nil
+	}
+	created := make(map[string]int64, len(infos))
+	res = make([]domain.Snapshot, 0, len(infos))
+	for _, v := range infos {
+		var snap domain.Snapshot
+		if err := json.Unmarshal(v, &snap); err != nil {
+			return res, corrupt("snapinfo:"+source, err)
+		}
+		t, _ := time.Parse(time.RFC3339, snap.Created)
+		created[snap.ID] = t.Unix()
+		snap.Active = snap.ID == r.data.Current[source]
+		res = append(res, snap)
+	}
+	//Порядок как у ZREVRANGE: по времени записи, при равном времени - по идентификатору
+	sort.Slice(res, func(i, j int) bool {
+		if created[res[i].ID] != created[res[j].ID] {
+			return created[res[i].ID] > created[res[j].ID]
+		}
+		return res[i].ID > res[j].ID
+	})
+	return res, nil
+}
+
+// Удаление старых снимков источника сверх keep последних. Действующий снимок не удаляется
+func (r *CurrModelRepository) PruneSnapshots(ctx context.Context, source string, keep int) (removed []string, err error) {
+	snaps, err := r.GetSnapshots(ctx, source)
+	if err != nil || len(snaps) <= keep {
+		return nil, err
+	}
+	unlock, err := r.lock(true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	for _, snap := range snaps[keep:] {
+		if snap.ID == r.data.Current[source] {
+			continue
+		}
+		delete(r.data.Snaps[source], snap.ID)
+		delete(r.data.SnapInfo[source], snap.ID)
+		removed = append(removed, snap.ID)
+	}
+	return removed, nil
+}
+
+// Закрытие хранилища с записью DB_FILE. Вызывается в main перед выходом после остановки сервера
+func (r *CurrModelRepository) Close(ctx context.Context) (err error) {
+	return r.Store.Close()
+}
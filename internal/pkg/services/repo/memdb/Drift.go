@@ -0,0 +1,67 @@
+package memdb
+
+import (
+	"context"
+	"encoding/json"
+	"main/internal/pkg/domain"
+)
+
+// Количество хранимых отчетов по источнику
+const maxDriftReports = 50
+
+// Репозиторий отчетов о расхождении схем в памяти. Отчеты источника хранятся от последнего к первому
+type DriftRepository struct {
+	*Store
+}
+
+// Создание нового репозитория. Нужно хранилище в памяти
+func NewDriftRepository(s *Store) *DriftRepository {
+	return &DriftRepository{s}
+}
+
+// Запись отчета в начало списка. Старые отчеты сверх maxDriftReports удаляются
+func (r *DriftRepository) StoreDrift(ctx context.Context, report domain.DriftReport) (err error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	r.data.Drift[report.Source] = prepend(r.data.Drift[report.Source], data, maxDriftReports)
+	return nil
+}
+
+// Получение отчетов источника, начиная с последнего
+func (r *DriftRepository) GetDrifts(ctx context.Context, source string) (res []domain.DriftReport, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	vals := r.data.Drift[source]
+	res = make([]domain.DriftReport, 0, len(vals))
+	for _, v := range vals {
+		var report domain.DriftReport
+		if err := json.Unmarshal(v, &report); err != nil {
+			return res, corrupt("drift:"+source, err)
+		}
+		res = append(res, report)
+	}
+	return res, nil
+}
+
+// Добавление записи в начало списка с обрезкой до limit записей, как LPUSH и LTRIM в Redis
+func prepend(list []json.RawMessage, data json.RawMessage, limit int) []json.RawMessage {
+	res := make([]json.RawMessage, 0, min(len(list)+1, limit))
+	res = append(res, data)
+	for _, v := range list {
+		if len(res) == limit {
+			break
+		}
+		res = append(res, v)
+	}
+	return res
+}
@@ -0,0 +1,62 @@
+package memdb
+
+import (
+	"context"
+	"time"
+)
+
+// Репозиторий аренды лидерства в памяти. Хранилище доступно только своему процессу,
+// поэтому аренду получает единственная реплика. Аренда не записывается в файл хранилища
+type LeaseRepository struct {
+	*Store
+	holder  string
+	token   int64
+	expires time.Time
+}
+
+// Создание нового репозитория. Нужно хранилище в памяти
+func NewLeaseRepository(s *Store) *LeaseRepository {
+	return &LeaseRepository{Store: s}
+}
+
+// Получение аренды на ttl или продление аренды holder
+func (r *LeaseRepository) AcquireLease(ctx context.Context, holder string, ttl time.Duration) (token int64, err error) {
+	unlock, err := r.lock(true)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	now := time.Now()
+	if now.Before(r.expires) && r.holder != holder {
+		return 0, nil
+	}
+	if !now.Before(r.expires) {
+		r.token++
+		r.holder = holder
+	}
+	r.expires = now.Add(ttl)
+	return r.token, nil
+}
+
+// Проверка, что аренда с токеном token еще действует
+func (r *LeaseRepository) CheckLease(ctx context.Context, token int64) (valid bool, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	return r.token == token && time.Now().Before(r.expires), nil
+}
+
+// Освобождение аренды holder
+func (r *LeaseRepository) ReleaseLease(ctx context.Context, holder string) (err error) {
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if r.holder == holder {
+		r.expires = time.Time{}
+	}
+	return nil
+}
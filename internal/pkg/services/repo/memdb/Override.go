@@ -0,0 +1,84 @@
+package memdb
+
+import (
+	"context"
+	"encoding/json"
+	"main/internal/pkg/domain"
+	"sort"
+)
+
+// Репозиторий ручных курсов в памяти. Курсы источника хранятся в JSON по кодам валют
+type OverrideRepository struct {
+	*Store
+}
+
+// Создание нового репозитория. Нужно хранилище в памяти
+func NewOverrideRepository(s *Store) *OverrideRepository {
+	return &OverrideRepository{s}
+}
+
+// Запись или замена ручного курса
+func (r *OverrideRepository) StoreOverride(ctx context.Context, o domain.RateOverride) (err error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if r.data.Overrides[o.Source] == nil {
+		r.data.Overrides[o.Source] = make(map[string]json.RawMessage)
+	}
+	r.data.Overrides[o.Source][o.Code] = data
+	return nil
+}
+
+// Удаление ручного курса
+func (r *OverrideRepository) DeleteOverride(ctx context.Context, source string, code string) (err error) {
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	delete(r.data.Overrides[source], code)
+	return nil
+}
+
+// Получение ручного курса. Если курса нет, возвращается курс с пустым Code
+func (r *OverrideRepository) GetOverride(ctx context.Context, source string, code string) (res domain.RateOverride, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	data, ok := r.data.Overrides[source][code]
+	if !ok {
+		return res, nil
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, corrupt("override:"+source+" "+code, err)
+	}
+	return res, nil
+}
+
+// Получение ручных курсов источника, отсортированных по коду валюты
+func (r *OverrideRepository) GetOverrides(ctx context.Context, source string) (res []domain.RateOverride, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	vals := r.data.Overrides[source]
+	res = make([]domain.RateOverride, 0, len(vals))
+	for _, v := range vals {
+		var o domain.RateOverride
+		if err := json.Unmarshal(v, &o); err != nil {
+			return res, corrupt("override:"+source, err)
+		}
+		res = append(res, o)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Code < res[j].Code })
+	return res, nil
+}
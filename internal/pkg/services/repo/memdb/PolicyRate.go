@@ -0,0 +1,48 @@
+package memdb
+
+import (
+	"context"
+	"main/internal/pkg/domain"
+	"sort"
+)
+
+// Репозиторий ключевых ставок в памяти. История источника хранится по датам
+type PolicyRateRepository struct {
+	*Store
+}
+
+// Создание нового репозитория. Нужно хранилище в памяти
+func NewPolicyRateRepository(s *Store) *PolicyRateRepository {
+	return &PolicyRateRepository{s}
+}
+
+// Получение истории ставок источника, отсортированной по дате вступления в силу
+func (r *PolicyRateRepository) GetPolicyRates(ctx context.Context, source string) (res []domain.PolicyRate, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	vals := r.data.Policy[source]
+	res = make([]domain.PolicyRate, 0, len(vals))
+	for date, rate := range vals {
+		res = append(res, domain.PolicyRate{Source: source, Date: date, Rate: rate})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Date < res[j].Date })
+	return res, nil
+}
+
+// Замена истории ставок источника
+func (r *PolicyRateRepository) StorePolicyRates(ctx context.Context, source string, rates []domain.PolicyRate) (err error) {
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	vals := make(map[string]string, len(rates))
+	for _, rate := range rates {
+		vals[rate.Date] = rate.Rate
+	}
+	r.data.Policy[source] = vals
+	return nil
+}
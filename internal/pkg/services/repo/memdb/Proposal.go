@@ -0,0 +1,95 @@
+package memdb
+
+import (
+	"context"
+	"encoding/json"
+	"main/internal/pkg/domain"
+	"sort"
+)
+
+// Репозиторий предложений в памяти. Предложения хранятся в JSON по идентификатору
+type ProposalRepository struct {
+	*Store
+}
+
+// Создание нового репозитория. Нужно хранилище в памяти
+func NewProposalRepository(s *Store) *ProposalRepository {
+	return &ProposalRepository{s}
+}
+
+// Запись или перезапись предложения
+func (r *ProposalRepository) StoreProposal(ctx context.Context, p domain.Proposal) (err error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	r.data.Proposals[p.ID] = data
+	return nil
+}
+
+// Перезапись ожидающего решения предложения. Статус проверяется и меняется под одной блокировкой
+func (r *ProposalRepository) ResolveProposal(ctx context.Context, p domain.Proposal) (resolved bool, err error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return false, err
+	}
+	unlock, err := r.lock(true)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	old, ok := r.data.Proposals[p.ID]
+	if !ok {
+		return false, nil
+	}
+	var stored domain.Proposal
+	if err = json.Unmarshal(old, &stored); err != nil {
+		return false, corrupt("proposal:"+p.ID, err)
+	}
+	if stored.Status != domain.ProposalPending {
+		return false, nil
+	}
+	r.data.Proposals[p.ID] = data
+	return true, nil
+}
+
+// Получение предложения по идентификатору. Если предложения нет, возвращается предложение с пустым ID
+func (r *ProposalRepository) GetProposal(ctx context.Context, id string) (res domain.Proposal, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	data, ok := r.data.Proposals[id]
+	if !ok {
+		return res, nil
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, corrupt("proposal:"+id, err)
+	}
+	return res, nil
+}
+
+// Получение всех предложений от новых к старым
+func (r *ProposalRepository) GetProposals(ctx context.Context) (res []domain.Proposal, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	res = make([]domain.Proposal, 0, len(r.data.Proposals))
+	for id, v := range r.data.Proposals {
+		var p domain.Proposal
+		if err := json.Unmarshal(v, &p); err != nil {
+			return res, corrupt("proposal:"+id, err)
+		}
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Created > res[j].Created })
+	return res, nil
+}
@@ -0,0 +1,72 @@
+package memdb
+
+import (
+	"context"
+	"encoding/json"
+	"main/internal/pkg/domain"
+	"sort"
+)
+
+// Репозиторий снимков в карантине в памяти. Снимки хранятся в JSON по идентификатору
+type QuarantineRepository struct {
+	*Store
+}
+
+// Создание нового репозитория. Нужно хранилище в памяти
+func NewQuarantineRepository(s *Store) *QuarantineRepository {
+	return &QuarantineRepository{s}
+}
+
+// Запись или перезапись снимка
+func (r *QuarantineRepository) StoreQuarantine(ctx context.Context, q domain.QuarantinedSnapshot) (err error) {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	r.data.Quarantine[q.ID] = data
+	return nil
+}
+
+// Получение снимка по идентификатору. Если снимка нет, возвращается снимок с пустым ID
+func (r *QuarantineRepository) GetQuarantine(ctx context.Context, id string) (res domain.QuarantinedSnapshot, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	data, ok := r.data.Quarantine[id]
+	if !ok {
+		return res, nil
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, corrupt("quarantine:"+id, err)
+	}
+	return res, nil
+}
+
+// Получение снимков источника (всех источников при пустом source) от новых к старым
+func (r *QuarantineRepository) GetAllQuarantine(ctx context.Context, source string) (res []domain.QuarantinedSnapshot, err error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+	res = make([]domain.QuarantinedSnapshot, 0, len(r.data.Quarantine))
+	for id, v := range r.data.Quarantine {
+		var q domain.QuarantinedSnapshot
+		if err := json.Unmarshal(v, &q); err != nil {
+			return res, corrupt("quarantine:"+id, err)
+		}
+		if source != "" && q.Source != source {
+			continue
+		}
+		res = append(res, q)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Created > res[j].Created })
+	return res, nil
+}
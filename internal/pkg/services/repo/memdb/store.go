@@ -0,0 +1,153 @@
+package memdb
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"main/internal/pkg/domain"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var logger = log.New(os.Stdout, "memdb ", log.LstdFlags)
+
+// Хранилище в памяти процесса для запуска без Redis. Записи хранятся в JSON так же, как в Redis,
+// поэтому поля, которые не попадают в бд, и при чтении ведут себя одинаково.
+// При заданном файле данные загружаются из него при создании и записываются в него при закрытии
+type Store struct {
+	mu     sync.RWMutex
+	path   string
+	closed bool
+	data   state
+	//Последний токен ограждения, с которым записан снимок источника. Токены аренды не переживают
+	//перезапуск процесса, поэтому и токены снимков в файл не записываются
+	fences map[string]int64
+}
+
+// Данные хранилища. Структура повторяет ключи Redis
+type state struct {
+	//Курсы снимков: источник -> снимок -> код валюты
+	Snaps map[string]map[string]map[string]json.RawMessage `json:"snaps"`
+	//Описания снимков: источник -> снимок
+	SnapInfo map[string]map[string]json.RawMessage `json:"snap_info"`
+	//Действующий снимок источника
+	Current map[string]string `json:"current"`
+	//Ключевые ставки: источник -> дата
+	Policy map[string]map[string]string `json:"policy"`
+	//Отчеты о расхождении схем источника, последний - первый
+	Drift map[string][]json.RawMessage `json:"drift"`
+	//Снимки в карантине по идентификатору
+	Quarantine map[string]json.RawMessage `json:"quarantine"`
+	//Ручные курсы: источник -> код валюты
+	Overrides map[string]map[string]json.RawMessage `json:"overrides"`
+	//Журнал изменений, последняя запись - первая
+	Audit []json.RawMessage `json:"audit"`
+	//Предложения по идентификатору
+	Proposals map[string]json.RawMessage `json:"proposals"`
+}
+
+// Создание хранилища. При непустом path данные загружаются из файла, если он есть
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, fences: make(map[string]int64)}
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			if err := json.Unmarshal(raw, &s.data); err != nil {
+				return nil, &domain.RepoError{Kind: domain.ErrCorruptRecord, Key: path, Err: err}
+			}
+			logger.Printf("Loaded data from %s", path)
+		}
+	}
+	s.data.init()
+	return s, nil
+}
+
+func (d *state) init() {
+	if d.Snaps == nil {
+		d.Snaps = make(map[string]map[string]map[string]json.RawMessage)
+	}
+	if d.SnapInfo == nil {
+		d.SnapInfo = make(map[string]map[string]json.RawMessage)
+	}
+	if d.Current == nil {
+		d.Current = make(map[string]string)
+	}
+	if d.Policy == nil {
+		d.Policy = make(map[string]map[string]string)
+	}
+	if d.Drift == nil {
+		d.Drift = make(map[string][]json.RawMessage)
+	}
+	if d.Quarantine == nil {
+		d.Quarantine = make(map[string]json.RawMessage)
+	}
+	if d.Overrides == nil {
+		d.Overrides = make(map[string]map[string]json.RawMessage)
+	}
+	if d.Proposals == nil {
+		d.Proposals = make(map[string]json.RawMessage)
+	}
+}
+
+// Блокировка хранилища на чтение или запись. После закрытия возвращает ошибку вида domain.ErrConnLost
+func (s *Store) lock(write bool) (unlock func(), err error) {
+	if write {
+		s.mu.Lock()
+		unlock = s.mu.Unlock
+	} else {
+		s.mu.RLock()
+		unlock = s.mu.RUnlock
+	}
+	if s.closed {
+		unlock()
+		return nil, &domain.RepoError{Kind: domain.ErrConnLost, Err: errors.New("memory store is closed")}
+	}
+	return unlock, nil
+}
+
+// Закрытие хранилища. При заданном файле данные записываются в него через временный файл,
+// чтобы при сбое записи сохранился прежний файл
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.path == "" {
+		return nil
+	}
+	raw, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(raw); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Printf("Saved data to %s", s.path)
+	return nil
+}
+
+// Ошибка чтения поврежденной записи
+func corrupt(key string, err error) error {
+	return &domain.RepoError{Kind: domain.ErrCorruptRecord, Key: key, Err: err}
+}
@@ -0,0 +1,59 @@
+package redisdb
+
+import (
+	"context"
+	"encoding/json"
+	"main/internal/pkg/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Количество хранимых записей журнала изменений
+const maxAuditEntries = 10000
+
+// Репозиторий журнала изменений в бд Redis. Записи хранятся в списке "audit", последняя - в начале
+type AuditRepository struct {
+	connection
+}
+
+// Создание нового репозитория журнала. Нужен клиент redis
+func NewAuditRepository(client *Client, maxRetries int) *AuditRepository {
+	return &AuditRepository{newConnection(client, maxRetries)}
+}
+
+// Добавление записи в начало журнала. Записи сверх maxAuditEntries удаляются
+func (r *AuditRepository) AppendAudit(ctx context.Context, e domain.AuditEntry) (err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, r.keys.audit(), data)
+		pipe.LTrim(ctx, r.keys.audit(), 0, maxAuditEntries-1)
+		return nil
+	})
+	return wrapErr(r.keys.audit(), err)
+}
+
+// Получение последних limit записей журнала
+func (r *AuditRepository) GetAudit(ctx context.Context, limit int) (res []domain.AuditEntry, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return res, err
+	}
+	vals, err := r.conn.LRange(ctx, r.keys.audit(), 0, int64(limit)-1).Result()
+	if err != nil {
+		return res, wrapErr(r.keys.audit(), err)
+	}
+	res = make([]domain.AuditEntry, 0, len(vals))
+	for _, v := range vals {
+		var e domain.AuditEntry
+		if err := json.Unmarshal([]byte(v), &e); err != nil {
+			return res, corrupt(r.keys.audit(), err)
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
@@ -2,124 +2,259 @@ package redisdb
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
-	"log"
 	"main/internal/pkg/domain"
-	"os"
-	"strconv"
+	"sort"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// Количество попыток записи снимка с токеном ограждения, если ключ токена изменился во время транзакции
+const fenceRetries = 3
+
 // Репозиторий хранения данных в бд Redis
 type CurrModelRepository struct {
-	conn       *redis.Client
-	maxRetries int
+	connection
 }
 
 // Создание нового репозитория. Нужен клиент redis
-func NewCurrModelRepository(conn *redis.Client, maxRetries int) *CurrModelRepository {
-	return &CurrModelRepository{conn, maxRetries}
+func NewCurrModelRepository(client *Client, maxRetries int) *CurrModelRepository {
+	return &CurrModelRepository{newConnection(client, maxRetries)}
 }
 
-// Проверка подключения. Если клиент отключен от бд, будет проведено переподключение к бд с таймаутом 1 секунда
-func (r *CurrModelRepository) checkConn(ctx context.Context) error {
-	if err := r.conn.Ping(ctx).Err(); err != nil {
-		err = r.Reconnect(r.conn.Options().DialTimeout, ctx, r.maxRetries)
-		if err != nil {
-			return err
-		}
+// Идентификатор действующего снимка источника. Пустая строка, если снимков еще нет
+func (r *CurrModelRepository) currentSnapshot(ctx context.Context, source string) (string, error) {
+	id, err := r.conn.Get(ctx, r.keys.current(source)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return id, wrapErr(r.keys.current(source), err)
+}
+
+// Чтение валюты снимка. Запись без кода или с неразбираемым JSON считается поврежденной
+func (r *CurrModelRepository) decodeCurr(source string, id string, data string) (res domain.CurrModel, err error) {
+	if err = json.Unmarshal([]byte(data), &res); err != nil {
+		return res, corrupt(r.keys.snap(source, id), err)
+	}
+	if res.Code == "" {
+		return res, corrupt(r.keys.snap(source, id), errors.New("empty currency code"))
 	}
-	return nil
+	res.Source = source
+	res.Snapshot = id
+	return res, nil
 }
 
-// Получение данных по источнику и коду валюты. Ключи хранятся в виде "SOURCE:CODE"
+// Получение данных по источнику и коду валюты из действующего снимка.
+// Если валюты нет, возвращает ошибку вида domain.ErrNotFound
 func (r *CurrModelRepository) GetBySourceAndKey(ctx context.Context, source string, key string) (res domain.CurrModel, err error) {
 	if err := r.checkConn(ctx); err != nil {
 		return res, err
 	}
-	err = r.conn.HGetAll(ctx, source+":"+key).Scan(&res)
+	id, err := r.currentSnapshot(ctx, source)
 	if err != nil {
-		log.Fatal(err)
 		return res, err
 	}
-	return res, nil
+	if id == "" {
+		return res, &domain.RepoError{Kind: domain.ErrNotFound, Key: r.keys.current(source)}
+	}
+	data, err := r.conn.HGet(ctx, r.keys.snap(source, id), key).Result()
+	if err != nil {
+		return res, wrapErr(r.keys.snap(source, id)+" "+key, err)
+	}
+	return r.decodeCurr(source, id, data)
 }
 
-// Получение данных по источнику и коду валюты.
+// Получение данных по источнику из действующего снимка
 func (r *CurrModelRepository) GetAllBySource(ctx context.Context, source string) (res []domain.CurrModel, err error) {
 	if err := r.checkConn(ctx); err != nil {
 		return res, err
 	}
-	keys, err := r.conn.Keys(ctx, source+":*").Result()
+	id, err := r.currentSnapshot(ctx, source)
 	if err != nil {
 		return res, err
 	}
-	var vals domain.CurrModel
+	if id == "" {
+		return res, nil
+	}
+	return r.GetSnapshotRates(ctx, source, id)
+}
+
+// Получение курсов снимка, отсортированных по коду валюты. Если снимка нет, возвращается пустой список
+func (r *CurrModelRepository) GetSnapshotRates(ctx context.Context, source string, id string) (res []domain.CurrModel, err error) {
 	if err := r.checkConn(ctx); err != nil {
 		return res, err
 	}
-	for _, v := range keys {
-		err := r.conn.HGetAll(ctx, v).Scan(&vals)
+	vals, err := r.conn.HGetAll(ctx, r.keys.snap(source, id)).Result()
+	if err != nil {
+		return res, wrapErr(r.keys.snap(source, id), err)
+	}
+	res = make([]domain.CurrModel, 0, len(vals))
+	for _, v := range vals {
+		curr, err := r.decodeCurr(source, id, v)
 		if err != nil {
 			return res, err
 		}
-		res = append(res, vals)
+		res = append(res, curr)
 	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Code < res[j].Code })
 	return res, nil
 }
 
-// Cохранение данных по источнику и коду валюты. В бд будет храниться по ключу "SOURCE:CODE"
-func (r *CurrModelRepository) Store(ctx context.Context, curr domain.CurrModel) (err error) {
+// Запись снимка и перевод указателя действующего снимка в одной транзакции MULTI/EXEC.
+// Снимок с токеном ограждения записывается под WATCH ключа токена источника
+func (r *CurrModelRepository) StoreSnapshot(ctx context.Context, snap domain.Snapshot, rates []domain.CurrModel) (err error) {
+	return r.storeSnapshot(ctx, snap, rates, true)
+}
+
+// Запись снимка без перевода указателя действующего снимка
+func (r *CurrModelRepository) AddSnapshot(ctx context.Context, snap domain.Snapshot, rates []domain.CurrModel) (err error) {
+	return r.storeSnapshot(ctx, snap, rates, false)
+}
+
+func (r *CurrModelRepository) storeSnapshot(ctx context.Context, snap domain.Snapshot, rates []domain.CurrModel, activate bool) (err error) {
 	if err := r.checkConn(ctx); err != nil {
 		return err
 	}
-	key := curr.Source + ":" + curr.Code
-	err = r.conn.HSet(ctx, key, curr).Err()
+	fields := make(map[string]interface{}, len(rates))
+	for _, c := range rates {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		fields[c.Code] = data
+	}
+	snap.Count = len(fields)
+	snap.Active = false
+	info, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	created, err := time.Parse(time.RFC3339, snap.Created)
 	if err != nil {
 		return err
 	}
-	return nil
+	write := func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, r.keys.snap(snap.Source, snap.ID), fields)
+		pipe.HSet(ctx, r.keys.snapInfo(snap.Source), snap.ID, info)
+		pipe.ZAdd(ctx, r.keys.snapIndex(snap.Source), redis.Z{Score: float64(created.Unix()), Member: snap.ID})
+		if activate {
+			pipe.Set(ctx, r.keys.current(snap.Source), snap.ID, 0)
+		}
+		if snap.Fence != 0 {
+			pipe.Set(ctx, r.keys.sourceFence(snap.Source), snap.Fence, 0)
+		}
+		return nil
+	}
+	if snap.Fence == 0 {
+		_, err = r.conn.TxPipelined(ctx, write)
+		return wrapErr(r.keys.snap(snap.Source, snap.ID), err)
+	}
+	//Токен проверяется под WATCH: если другой лидер запишет снимок между проверкой и EXEC,
+	//транзакция не выполнится и проверка повторится с его токеном
+	for i := 0; i < fenceRetries; i++ {
+		err = r.conn.Watch(ctx, func(tx *redis.Tx) error {
+			last, err := tx.Get(ctx, r.keys.sourceFence(snap.Source)).Int64()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			if last > snap.Fence {
+				return domain.ErrNotLeader
+			}
+			_, err = tx.TxPipelined(ctx, write)
+			return err
+		}, r.keys.sourceFence(snap.Source))
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if errors.Is(err, domain.ErrNotLeader) {
+		return err
+	}
+	return wrapErr(r.keys.snap(snap.Source, snap.ID), err)
 }
 
-// Закрытие подключения к бд. Реализуется в main через горутину graceful shutdown
-func (r *CurrModelRepository) Close(ctx context.Context) (err error) {
-	return r.conn.Close()
+// Активация ранее записанного снимка. Если снимка нет, возвращает ошибку вида domain.ErrNotFound
+func (r *CurrModelRepository) ActivateSnapshot(ctx context.Context, source string, id string) (err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return err
+	}
+	if err = r.conn.ZScore(ctx, r.keys.snapIndex(source), id).Err(); err != nil {
+		return wrapErr(r.keys.snap(source, id), err)
+	}
+	return wrapErr(r.keys.current(source), r.conn.Set(ctx, r.keys.current(source), id, 0).Err())
 }
 
-// Reconnect переподключает к бд с интервалом 1 секунда. Прерывается и возвращает ненулевую ошибку при закрытии контекста.
-func (r *CurrModelRepository) Reconnect(timeWait time.Duration, ctx context.Context, maxRetries int) (err error) {
-	logger := log.New(os.Stdout, "Reconnect ", log.LstdFlags)
-	logger.Printf("Checking connect")
-	err = r.conn.Ping(ctx).Err()
+// Получение описаний снимков источника от новых к старым
+func (r *CurrModelRepository) GetSnapshots(ctx context.Context, source string) (res []domain.Snapshot, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return res, err
+	}
+	ids, err := r.conn.ZRevRange(ctx, r.keys.snapIndex(source), 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return res, wrapErr(r.keys.snapIndex(source), err)
+	}
+	current, err := r.currentSnapshot(ctx, source)
 	if err != nil {
-		logger.Print("Connect with db was lost. Error: " + err.Error())
-		attempt := 0
-		ticker := time.NewTicker(timeWait)
-		for range ticker.C {
-			select {
-			case <-ctx.Done():
-				logger.Print("Gracefully stopping")
-				return errors.New("exiting")
-			default:
-				if attempt > maxRetries {
-					logger.Printf("%s", "Cannot connect to db after"+strconv.FormatInt(int64(attempt), 10)+" attempt. Will try again later")
-					return errors.New("no connect with db now")
-				}
-				attempt++
-				logger.Printf("Started reconnecting with DB")
-				err = r.conn.Ping(ctx).Err()
-				if err == nil {
-					logger.Printf("Successfuly reconnected")
-					return nil
-				}
-				logger.Printf("Reconnect failed. Waiting for %d sec.", timeWait)
-			}
-
+		return res, err
+	}
+	infos, err := r.conn.HMGet(ctx, r.keys.snapInfo(source), ids...).Result()
+	if err != nil {
+		return res, wrapErr(r.keys.snapInfo(source), err)
+	}
+	res = make([]domain.Snapshot, 0, len(ids))
+	for _, v := range infos {
+		data, ok := v.(string)
+		if !ok {
+			continue
 		}
+		var snap domain.Snapshot
+		if err := json.Unmarshal([]byte(data), &snap); err != nil {
+			return res, corrupt(r.keys.snapInfo(source), err)
+		}
+		snap.Active = snap.ID == current
+		res = append(res, snap)
+	}
+	return res, nil
+}
 
+// Удаление старых снимков источника сверх keep последних. Действующий снимок не удаляется
+func (r *CurrModelRepository) PruneSnapshots(ctx context.Context, source string, keep int) (removed []string, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return nil, err
+	}
+	ids, err := r.conn.ZRevRange(ctx, r.keys.snapIndex(source), int64(keep), -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, wrapErr(r.keys.snapIndex(source), err)
+	}
+	current, err := r.currentSnapshot(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if id != current {
+			removed = append(removed, id)
+		}
 	}
-	logger.Printf("Connect is ok. Continuing to do business logic")
-	return nil
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	_, err = r.conn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range removed {
+			pipe.Del(ctx, r.keys.snap(source, id))
+			pipe.HDel(ctx, r.keys.snapInfo(source), id)
+			pipe.ZRem(ctx, r.keys.snapIndex(source), id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrapErr(r.keys.snapIndex(source), err)
+	}
+	return removed, nil
+}
+
+// Закрытие подключения к бд. Реализуется в main через горутину graceful shutdown
+func (r *CurrModelRepository) Close(ctx context.Context) (err error) {
+	return r.conn.Close()
 }
@@ -0,0 +1,60 @@
+package redisdb
+
+import (
+	"context"
+	"encoding/json"
+	"main/internal/pkg/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Количество хранимых отчетов о расхождении схемы на источник
+const maxDriftReports = 50
+
+// Репозиторий отчетов о расхождении схем в бд Redis. Отчеты источника хранятся в списке "drift:SOURCE"
+type DriftRepository struct {
+	connection
+}
+
+// Создание нового репозитория отчетов. Нужен клиент redis
+func NewDriftRepository(client *Client, maxRetries int) *DriftRepository {
+	return &DriftRepository{newConnection(client, maxRetries)}
+}
+
+// Запись отчета в начало списка. Старые отчеты сверх maxDriftReports удаляются
+func (r *DriftRepository) StoreDrift(ctx context.Context, report domain.DriftReport) (err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return err
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	key := r.keys.drift(report.Source)
+	_, err = r.conn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, data)
+		pipe.LTrim(ctx, key, 0, maxDriftReports-1)
+		return nil
+	})
+	return wrapErr(key, err)
+}
+
+// Получение отчетов источника, начиная с последнего
+func (r *DriftRepository) GetDrifts(ctx context.Context, source string) (res []domain.DriftReport, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return res, err
+	}
+	vals, err := r.conn.LRange(ctx, r.keys.drift(source), 0, -1).Result()
+	if err != nil {
+		return res, wrapErr(r.keys.drift(source), err)
+	}
+	res = make([]domain.DriftReport, 0, len(vals))
+	for _, v := range vals {
+		var report domain.DriftReport
+		if err := json.Unmarshal([]byte(v), &report); err != nil {
+			return res, corrupt(r.keys.drift(source), err)
+		}
+		res = append(res, report)
+	}
+	return res, nil
+}
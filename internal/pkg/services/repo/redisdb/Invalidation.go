@@ -0,0 +1,64 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Рассылка сообщений об изменении курсов источника через pub/sub Redis. Сообщение - код источника.
+// Pub/sub не хранит сообщения, поэтому после переподключения подписчик сбрасывает кэш целиком
+type Invalidator struct {
+	connection
+}
+
+// Создание рассылки. Нужен клиент redis
+func NewInvalidator(client *Client, maxRetries int) *Invalidator {
+	return &Invalidator{newConnection(client, maxRetries)}
+}
+
+// Отправка сообщения об изменении источника
+func (r *Invalidator) Publish(ctx context.Context, source string) (err error) {
+	return wrapErr(r.keys.invalidation(), r.conn.Publish(ctx, r.keys.invalidation(), source).Err())
+}
+
+// Получение сообщений до закрытия ctx или клиента. resync вызывается при каждой подписке, в том числе
+// после переподключения
+func (r *Invalidator) Subscribe(ctx context.Context, changed func(source string), resync func()) {
+	logger := log.New(os.Stdout, "Invalidator ", log.LstdFlags)
+	pubsub := r.conn.Subscribe(ctx, r.keys.invalidation())
+	defer pubsub.Close()
+	//Закрытие подписки прерывает ожидание сообщения
+	go func() {
+		<-ctx.Done()
+		pubsub.Close()
+	}()
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if ctx.Err() != nil || errors.Is(err, redis.ErrClosed) {
+			return
+		}
+		if err != nil {
+			//Следующий Receive переподключится и подпишется заново
+			logger.Printf("Subscription to %s lost, retrying in %s. Error: %s", r.keys.invalidation(), r.retryWait, err.Error())
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(r.retryWait):
+			}
+			continue
+		}
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if m.Kind == "subscribe" {
+				resync()
+			}
+		case *redis.Message:
+			changed(m.Payload)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Получение или продление аренды. Значение аренды - "токен:реплика", токен берется из счетчика ограждения,
+// поэтому каждая новая аренда получает больший токен. Возвращает токен или 0, если аренду держит другая реплика
+var acquireLease = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v then
+	local token, holder = string.match(v, '^(%d+):(.*)$')
+	if holder == ARGV[1] then
+		redis.call('PEXPIRE', KEYS[1], ARGV[2])
+		return tonumber(token)
+	end
+	return 0
+end
+local token = redis.call('INCR', KEYS[2])
+redis.call('SET', KEYS[1], token .. ':' .. ARGV[1], 'PX', ARGV[2])
+return token
+`)
+
+// Удаление аренды, только если ее держит реплика ARGV[1]
+var releaseLease = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v and string.match(v, '^%d+:(.*)$') == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Репозиторий аренды лидерства в бд Redis. Аренда хранится в ключе с истечением, счетчик токенов ограждения -
+// в отдельном ключе без истечения. Запросы не переподключаются к бд, чтобы не задерживать продление дольше срока аренды
+type LeaseRepository struct {
+	connection
+}
+
+// Создание нового репозитория аренды. Нужен клиент redis
+func NewLeaseRepository(client *Client, maxRetries int) *LeaseRepository {
+	return &LeaseRepository{newConnection(client, maxRetries)}
+}
+
+// Получение аренды на ttl или продление аренды holder
+func (r *LeaseRepository) AcquireLease(ctx context.Context, holder string, ttl time.Duration) (token int64, err error) {
+	keys := []string{r.keys.lease(), r.keys.fence()}
+	token, err = acquireLease.Run(ctx, r.conn, keys, holder, ttl.Milliseconds()).Int64()
+	return token, wrapErr(r.keys.lease(), err)
+}
+
+// Проверка, что аренда с токеном token еще действует
+func (r *LeaseRepository) CheckLease(ctx context.Context, token int64) (valid bool, err error) {
+	v, err := r.conn.Get(ctx, r.keys.lease()).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, wrapErr(r.keys.lease(), err)
+	}
+	return strings.HasPrefix(v, strconv.FormatInt(token, 10)+":"), nil
+}
+
+// Освобождение аренды holder. Другая реплика может получить аренду сразу, не дожидаясь истечения
+func (r *LeaseRepository) ReleaseLease(ctx context.Context, holder string) (err error) {
+	return wrapErr(r.keys.lease(), releaseLease.Run(ctx, r.conn, []string{r.keys.lease()}, holder).Err())
+}
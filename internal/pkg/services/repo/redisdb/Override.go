@@ -0,0 +1,80 @@
+package redisdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"main/internal/pkg/domain"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Репозиторий ручных курсов в бд Redis. Курсы источника хранятся в JSON в хэше "override:SOURCE" с полями-кодами валют
+type OverrideRepository struct {
+	connection
+}
+
+// Создание нового репозитория ручных курсов. Нужен клиент redis
+func NewOverrideRepository(client *Client, maxRetries int) *OverrideRepository {
+	return &OverrideRepository{newConnection(client, maxRetries)}
+}
+
+// Запись или замена ручного курса
+func (r *OverrideRepository) StoreOverride(ctx context.Context, o domain.RateOverride) (err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return err
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return wrapErr(r.keys.override(o.Source), r.conn.HSet(ctx, r.keys.override(o.Source), o.Code, data).Err())
+}
+
+// Удаление ручного курса
+func (r *OverrideRepository) DeleteOverride(ctx context.Context, source string, code string) (err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return err
+	}
+	return wrapErr(r.keys.override(source), r.conn.HDel(ctx, r.keys.override(source), code).Err())
+}
+
+// Получение ручного курса. Если курса нет, возвращается курс с пустым Code
+func (r *OverrideRepository) GetOverride(ctx context.Context, source string, code string) (res domain.RateOverride, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return res, err
+	}
+	data, err := r.conn.HGet(ctx, r.keys.override(source), code).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return res, nil
+	}
+	if err != nil {
+		return res, wrapErr(r.keys.override(source), err)
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, corrupt(r.keys.override(source)+" "+code, err)
+	}
+	return res, nil
+}
+
+// Получение ручных курсов источника, отсортированных по коду валюты
+func (r *OverrideRepository) GetOverrides(ctx context.Context, source string) (res []domain.RateOverride, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return res, err
+	}
+	vals, err := r.conn.HGetAll(ctx, r.keys.override(source)).Result()
+	if err != nil {
+		return res, wrapErr(r.keys.override(source), err)
+	}
+	res = make([]domain.RateOverride, 0, len(vals))
+	for _, v := range vals {
+		var o domain.RateOverride
+		if err := json.Unmarshal([]byte(v), &o); err != nil {
+			return res, corrupt(r.keys.override(source), err)
+		}
+		res = append(res, o)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Code < res[j].Code })
+	return res, nil
+}
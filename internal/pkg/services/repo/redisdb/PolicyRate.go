@@ -0,0 +1,52 @@
+package redisdb
+
+import (
+	"context"
+	"main/internal/pkg/domain"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Репозиторий ключевых ставок в бд Redis. История источника хранится в хэше "policy:SOURCE" с полями-датами
+type PolicyRateRepository struct {
+	connection
+}
+
+// Создание нового репозитория ключевых ставок. Нужен клиент redis
+func NewPolicyRateRepository(client *Client, maxRetries int) *PolicyRateRepository {
+	return &PolicyRateRepository{newConnection(client, maxRetries)}
+}
+
+// Получение истории ставок источника, отсортированной по дате вступления в силу
+func (r *PolicyRateRepository) GetPolicyRates(ctx context.Context, source string) (res []domain.PolicyRate, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return res, err
+	}
+	vals, err := r.conn.HGetAll(ctx, r.keys.policy(source)).Result()
+	if err != nil {
+		return res, wrapErr(r.keys.policy(source), err)
+	}
+	res = make([]domain.PolicyRate, 0, len(vals))
+	for date, rate := range vals {
+		res = append(res, domain.PolicyRate{Source: source, Date: date, Rate: rate})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Date < res[j].Date })
+	return res, nil
+}
+
+// Замена истории ставок источника. Старая история удаляется в той же транзакции
+func (r *PolicyRateRepository) StorePolicyRates(ctx context.Context, source string, rates []domain.PolicyRate) (err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return err
+	}
+	key := r.keys.policy(source)
+	_, err = r.conn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		for _, rate := range rates {
+			pipe.HSet(ctx, key, rate.Date, rate.Rate)
+		}
+		return nil
+	})
+	return wrapErr(key, err)
+}
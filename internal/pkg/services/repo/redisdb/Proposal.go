@@ -0,0 +1,101 @@
+package redisdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"main/internal/pkg/domain"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Перезапись предложения KEYS[1] значением ARGV[1], только если сохраненное предложение в статусе pending
+var resolveProposal = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if not v or cjson.decode(v).status ~= 'pending' then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1])
+return 1
+`)
+
+// Репозиторий предложений в бд Redis. Предложение хранится в JSON по ключу "proposal:ID",
+// идентификаторы всех предложений - в множестве r.keys.proposalIndex()
+type ProposalRepository struct {
+	connection
+}
+
+// Создание нового репозитория предложений. Нужен клиент redis
+func NewProposalRepository(client *Client, maxRetries int) *ProposalRepository {
+	return &ProposalRepository{newConnection(client, maxRetries)}
+}
+
+// Запись или перезапись предложения
+func (r *ProposalRepository) StoreProposal(ctx context.Context, p domain.Proposal) (err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return err
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.keys.proposal(p.ID), data, 0)
+		pipe.SAdd(ctx, r.keys.proposalIndex(), p.ID)
+		return nil
+	})
+	return wrapErr(r.keys.proposal(p.ID), err)
+}
+
+// Перезапись ожидающего решения предложения. Статус проверяется и меняется одним скриптом Lua
+func (r *ProposalRepository) ResolveProposal(ctx context.Context, p domain.Proposal) (resolved bool, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return false, err
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return false, err
+	}
+	n, err := resolveProposal.Run(ctx, r.conn, []string{r.keys.proposal(p.ID)}, data).Int()
+	return n == 1, wrapErr(r.keys.proposal(p.ID), err)
+}
+
+// Получение предложения по идентификатору. Если предложения нет, возвращается предложение с пустым ID
+func (r *ProposalRepository) GetProposal(ctx context.Context, id string) (res domain.Proposal, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return res, err
+	}
+	data, err := r.conn.Get(ctx, r.keys.proposal(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return res, nil
+	}
+	if err != nil {
+		return res, wrapErr(r.keys.proposal(id), err)
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, corrupt(r.keys.proposal(id), err)
+	}
+	return res, nil
+}
+
+// Получение всех предложений от новых к старым
+func (r *ProposalRepository) GetProposals(ctx context.Context) (res []domain.Proposal, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return res, err
+	}
+	vals, err := r.getIndexed(ctx, r.keys.proposalIndex(), r.keys.proposal(""))
+	if err != nil {
+		return res, err
+	}
+	res = make([]domain.Proposal, 0, len(vals))
+	for _, v := range vals {
+		var p domain.Proposal
+		if err := json.Unmarshal([]byte(v), &p); err != nil {
+			return res, corrupt(r.keys.proposalIndex(), err)
+		}
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Created > res[j].Created })
+	return res, nil
+}
@@ -0,0 +1,81 @@
+package redisdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"main/internal/pkg/domain"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Репозиторий снимков в карантине в бд Redis. Снимок хранится в JSON по ключу "quarantine:ID",
+// идентификаторы всех снимков - в множестве r.keys.quarantineIndex()
+type QuarantineRepository struct {
+	connection
+}
+
+// Создание нового репозитория снимков в карантине. Нужен клиент redis
+func NewQuarantineRepository(client *Client, maxRetries int) *QuarantineRepository {
+	return &QuarantineRepository{newConnection(client, maxRetries)}
+}
+
+// Запись или перезапись снимка
+func (r *QuarantineRepository) StoreQuarantine(ctx context.Context, q domain.QuarantinedSnapshot) (err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return err
+	}
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.keys.quarantine(q.ID), data, 0)
+		pipe.SAdd(ctx, r.keys.quarantineIndex(), q.ID)
+		return nil
+	})
+	return wrapErr(r.keys.quarantine(q.ID), err)
+}
+
+// Получение снимка по идентификатору. Если снимка нет, возвращается снимок с пустым ID
+func (r *QuarantineRepository) GetQuarantine(ctx context.Context, id string) (res domain.QuarantinedSnapshot, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return res, err
+	}
+	data, err := r.conn.Get(ctx, r.keys.quarantine(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return res, nil
+	}
+	if err != nil {
+		return res, wrapErr(r.keys.quarantine(id), err)
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, corrupt(r.keys.quarantine(id), err)
+	}
+	return res, nil
+}
+
+// Получение снимков источника (всех источников при пустом source) от новых к старым
+func (r *QuarantineRepository) GetAllQuarantine(ctx context.Context, source string) (res []domain.QuarantinedSnapshot, err error) {
+	if err := r.checkConn(ctx); err != nil {
+		return res, err
+	}
+	vals, err := r.getIndexed(ctx, r.keys.quarantineIndex(), r.keys.quarantine(""))
+	if err != nil {
+		return res, err
+	}
+	res = make([]domain.QuarantinedSnapshot, 0, len(vals))
+	for _, v := range vals {
+		var q domain.QuarantinedSnapshot
+		if err := json.Unmarshal([]byte(v), &q); err != nil {
+			return res, corrupt(r.keys.quarantineIndex(), err)
+		}
+		if source != "" && q.Source != source {
+			continue
+		}
+		res = append(res, q)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Created > res[j].Created })
+	return res, nil
+}
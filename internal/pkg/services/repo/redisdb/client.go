@@ -0,0 +1,111 @@
+package redisdb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"main/config"
+	"os"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Подключение к Redis, общее для репозиториев: standalone, sentinel или cluster
+type Client struct {
+	conn redis.UniversalClient
+	keys keyspace
+	down *atomic.Bool
+}
+
+// Создание клиента по настройкам бд. Для standalone адрес берется из url (redis:// или rediss://),
+// для sentinel и cluster - из cfg.Addrs
+func NewClient(url string, cfg config.DbConfig) (*Client, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		MasterName:       cfg.MasterName,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		SentinelUsername: cfg.SentinelUsername,
+		SentinelPassword: cfg.SentinelPassword,
+		DB:               cfg.DB,
+	}
+	switch cfg.Mode {
+	case config.DbStandalone, "":
+		parsed, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, err
+		}
+		opts.Addrs = []string{parsed.Addr}
+		opts.DB = parsed.DB
+		opts.TLSConfig = parsed.TLSConfig
+		if opts.Username == "" && opts.Password == "" {
+			opts.Username, opts.Password = parsed.Username, parsed.Password
+		}
+		//Без имени мастера и с одним адресом создается обычный клиент
+		opts.MasterName = ""
+	case config.DbSentinel:
+		if len(cfg.Addrs) == 0 || cfg.MasterName == "" {
+			return nil, errors.New("sentinel mode needs DB_ADDRS and DB_MASTER")
+		}
+	case config.DbCluster:
+		if len(cfg.Addrs) == 0 {
+			return nil, errors.New("cluster mode needs DB_ADDRS")
+		}
+		opts.MasterName = ""
+		opts.DB = 0
+	default:
+		return nil, errors.New("wrong db mode " + cfg.Mode + ". use standalone, sentinel or cluster")
+	}
+	if cfg.TLS || cfg.CAFile != "" || cfg.CertFile != "" {
+		tlsConfig, err := newTLSConfig(cfg, opts.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	var conn redis.UniversalClient
+	if cfg.Mode == config.DbCluster {
+		//Кластер создается явно: NewUniversalClient выбирает кластер только при нескольких адресах
+		conn = redis.NewClusterClient(opts.Cluster())
+	} else {
+		conn = redis.NewUniversalClient(opts)
+	}
+	return &Client{conn: conn, keys: keyspace{tags: cfg.HashTags || cfg.Mode == config.DbCluster, ns: namespace}, down: new(atomic.Bool)}, nil
+}
+
+// Настройки TLS: корневые сертификаты для проверки сервера и сертификат клиента
+func newTLSConfig(cfg config.DbConfig, base *tls.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if base != nil {
+		tlsConfig = base.Clone()
+	}
+	tlsConfig.MinVersion = tls.VersionTLS12
+	if cfg.ServerName != "" {
+		tlsConfig.ServerName = cfg.ServerName
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Закрытие подключения к бд
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
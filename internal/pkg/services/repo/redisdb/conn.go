@@ -0,0 +1,173 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"log"
+	"main/internal/pkg/domain"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Подключение к бд, общее для репозиториев пакета
+type connection struct {
+	conn       redis.UniversalClient
+	maxRetries int
+	//Интервал между попытками переподключения
+	retryWait time.Duration
+	keys      keyspace
+	//Связь с бд потеряна, идет фоновое переподключение. Общий для репозиториев клиента
+	down *atomic.Bool
+}
+
+func newConnection(client *Client, maxRetries int) connection {
+	retryWait := 5 * time.Second
+	switch c := client.conn.(type) {
+	case *redis.Client:
+		retryWait = c.Options().DialTimeout
+	case *redis.ClusterClient:
+		retryWait = c.Options().DialTimeout
+	}
+	return connection{conn: client.conn, maxRetries: maxRetries, retryWait: retryWait, keys: client.keys, down: client.down}
+}
+
+// Перебор ключей по шаблону курсором SCAN. В кластере ключи перебираются на каждом мастер-узле
+func (r *connection) scanKeys(ctx context.Context, match string) (keys []string, err error) {
+	scan := func(ctx context.Context, c redis.Cmdable) ([]string, error) {
+		res := make([]string, 0)
+		iter := c.Scan(ctx, 0, match, scanCount).Iterator()
+		for iter.Next(ctx) {
+			res = append(res, iter.Val())
+		}
+		return res, iter.Err()
+	}
+	cluster, ok := r.conn.(*redis.ClusterClient)
+	if !ok {
+		return scan(ctx, r.conn)
+	}
+	var mu sync.Mutex
+	err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		res, err := scan(ctx, node)
+		mu.Lock()
+		keys = append(keys, res...)
+		mu.Unlock()
+		return err
+	})
+	return keys, err
+}
+
+// Значения строковых ключей prefix+ID для всех ID из множества index одним запросом MGET.
+// Ключи, удаленные после записи в множество, пропускаются
+func (r *connection) getIndexed(ctx context.Context, index string, prefix string) (res []string, err error) {
+	ids, err := r.conn.SMembers(ctx, index).Result()
+	if err != nil || len(ids) == 0 {
+		return res, wrapErr(index, err)
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = prefix + id
+	}
+	vals, err := r.conn.MGet(ctx, keys...).Result()
+	if err != nil {
+		return res, wrapErr(index, err)
+	}
+	res = make([]string, 0, len(vals))
+	for _, v := range vals {
+		if s, ok := v.(string); ok {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+// Проверка подключения в запросе. Пока бд недоступна, ошибка вида domain.ErrConnLost возвращается сразу,
+// без ожидания: переподключение идет в фоне, запрос не задерживается
+func (r *connection) checkConn(ctx context.Context) error {
+	if r.down.Load() {
+		return &domain.RepoError{Kind: domain.ErrConnLost, Err: errors.New("no connect with db now")}
+	}
+	if err := r.conn.Ping(ctx).Err(); err != nil {
+		if r.down.CompareAndSwap(false, true) {
+			go r.reconnectInBackground()
+		}
+		return &domain.RepoError{Kind: domain.ErrConnLost, Err: err}
+	}
+	return nil
+}
+
+// Проверка подключения с ожиданием. Если клиент отключен от бд, будет проведено переподключение к бд.
+// Нужна при запуске, когда без бд работать нельзя. При неудаче возвращает ошибку вида domain.ErrConnLost
+func (r *connection) waitConn(ctx context.Context) error {
+	if err := r.conn.Ping(ctx).Err(); err != nil {
+		err = r.Reconnect(r.retryWait, ctx, r.maxRetries)
+		if err != nil {
+			return &domain.RepoError{Kind: domain.ErrConnLost, Err: err}
+		}
+	}
+	return nil
+}
+
+// Фоновое переподключение после потери связи с бд. Попытки повторяются, пока бд не ответит или клиент не будет закрыт
+func (r *connection) reconnectInBackground() {
+	logger := log.New(os.Stdout, "Reconnect ", log.LstdFlags)
+	logger.Print("Connect with db was lost, reconnecting in background")
+	ticker := time.NewTicker(r.retryWait)
+	defer ticker.Stop()
+	for attempt := 1; ; attempt++ {
+		<-ticker.C
+		ctx, cancel := context.WithTimeout(context.Background(), r.retryWait)
+		err := r.conn.Ping(ctx).Err()
+		cancel()
+		switch {
+		case err == nil:
+			r.down.Store(false)
+			logger.Printf("Successfuly reconnected after %d attempts", attempt)
+			return
+		case errors.Is(err, redis.ErrClosed):
+			return
+		case attempt%max(r.maxRetries, 1) == 0:
+			logger.Printf("Cannot connect to db after %d attempts. Will try again later. Error: %s", attempt, err.Error())
+		}
+	}
+}
+
+// Reconnect переподключает к бд с интервалом 1 секунда. Прерывается и возвращает ненулевую ошибку при закрытии контекста.
+func (r *connection) Reconnect(timeWait time.Duration, ctx context.Context, maxRetries int) (err error) {
+	logger := log.New(os.Stdout, "Reconnect ", log.LstdFlags)
+	logger.Printf("Checking connect")
+	err = r.conn.Ping(ctx).Err()
+	if err != nil {
+		logger.Print("Connect with db was lost. Error: " + err.Error())
+		attempt := 0
+		ticker := time.NewTicker(timeWait)
+		for range ticker.C {
+			select {
+			case <-ctx.Done():
+				logger.Print("Gracefully stopping")
+				return errors.New("exiting")
+			default:
+				if attempt > maxRetries {
+					logger.Printf("%s", "Cannot connect to db after"+strconv.FormatInt(int64(attempt), 10)+" attempt. Will try again later")
+					return errors.New("no connect with db now")
+				}
+				attempt++
+				logger.Printf("Started reconnecting with DB")
+				err = r.conn.Ping(ctx).Err()
+				if err == nil {
+					logger.Printf("Successfuly reconnected")
+					return nil
+				}
+				logger.Printf("Reconnect failed. Waiting for %d sec.", timeWait)
+			}
+
+		}
+
+	}
+	logger.Printf("Connect is ok. Continuing to do business logic")
+	return nil
+}
@@ -0,0 +1,65 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"main/internal/pkg/domain"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Ответы сервера о записи не того вида или значении, которое нельзя разобрать.
+// Остальные ошибки сервера (READONLY, LOADING, MOVED, CROSSSLOT, NOAUTH и т.п.) говорят о состоянии бд, а не записи
+var corruptReplies = []string{
+	"WRONGTYPE",
+	"ERR value is not",
+	"ERR hash value is not",
+	"ERR increment or decrement would overflow",
+	"ERR Bad data format",
+	"ERR DUMP payload",
+}
+
+// Приведение ошибки клиента redis к типизированной ошибке хранилища.
+// Поврежденной считается запись не того вида или с неразбираемым значением, остальные ошибки - потеря связи с бд
+func wrapErr(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var repoErr *domain.RepoError
+	if errors.As(err, &repoErr) {
+		return err
+	}
+	kind := domain.ErrConnLost
+	var netErr net.Error
+	var redisErr redis.Error
+	var numErr *strconv.NumError
+	switch {
+	case errors.Is(err, redis.Nil):
+		return &domain.RepoError{Kind: domain.ErrNotFound, Key: key}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		kind = domain.ErrDBTimeout
+	case errors.As(err, &redisErr) && isCorruptReply(redisErr.Error()):
+		kind = domain.ErrCorruptRecord
+	case errors.As(err, &numErr):
+		//Значение получено, но клиент не смог его разобрать
+		kind = domain.ErrCorruptRecord
+	}
+	return &domain.RepoError{Kind: kind, Key: key, Err: err}
+}
+
+func isCorruptReply(msg string) bool {
+	for _, prefix := range corruptReplies {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ошибка чтения поврежденной записи
+func corrupt(key string, err error) error {
+	return &domain.RepoError{Kind: domain.ErrCorruptRecord, Key: key, Err: err}
+}
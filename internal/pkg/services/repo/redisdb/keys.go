@@ -0,0 +1,51 @@
+package redisdb
+
+// Размер порции ключей за один шаг SCAN
+const scanCount = 100
+
+// Пространство ключей сервиса. Все ключи начинаются с него, версия схемы хранится в ключе namespace+"schema"
+const namespace = "currency:"
+
+// Построение ключей бд. Ключи снимков курсов источника:
+//
+//	currency:snap:SOURCE:ID   - хэш курсов снимка, поле - код валюты, значение - JSON
+//	currency:snaps:SOURCE     - упорядоченное множество идентификаторов снимков по времени записи
+//	currency:snapinfo:SOURCE  - хэш описаний снимков, поле - идентификатор снимка
+//	currency:current:SOURCE   - идентификатор действующего снимка
+//	currency:fence:SOURCE     - последний токен ограждения, с которым записан снимок
+//
+// При включенных хэш-тегах SOURCE записывается как {SOURCE}, и все ключи источника попадают в один слот кластера,
+// что нужно для транзакции записи снимка. Так же группируются ключи снимков в карантине, предложений
+// и аренды лидерства, которая выдается скриптом Lua.
+// Ключи без пространства (ns пустой) использовались до версии схемы 1 и нужны только для миграции
+type keyspace struct {
+	tags bool
+	ns   string
+}
+
+func (k keyspace) tag(s string) string {
+	if k.tags {
+		return "{" + s + "}"
+	}
+	return s
+}
+
+func (k keyspace) schema() string { return k.ns + "schema" }
+func (k keyspace) snap(source string, id string) string {
+	return k.ns + "snap:" + k.tag(source) + ":" + id
+}
+func (k keyspace) snapIndex(source string) string   { return k.ns + "snaps:" + k.tag(source) }
+func (k keyspace) snapInfo(source string) string    { return k.ns + "snapinfo:" + k.tag(source) }
+func (k keyspace) current(source string) string     { return k.ns + "current:" + k.tag(source) }
+func (k keyspace) sourceFence(source string) string { return k.ns + "fence:" + k.tag(source) }
+func (k keyspace) quarantine(id string) string      { return k.ns + k.tag("quarantine") + ":" + id }
+func (k keyspace) quarantineIndex() string          { return k.ns + k.tag("quarantine") + ":index" }
+func (k keyspace) proposal(id string) string        { return k.ns + k.tag("proposal") + ":" + id }
+func (k keyspace) proposalIndex() string            { return k.ns + k.tag("proposal") + ":index" }
+func (k keyspace) override(source string) string    { return k.ns + "override:" + source }
+func (k keyspace) policy(source string) string      { return k.ns + "policy:" + source }
+func (k keyspace) drift(source string) string       { return k.ns + "drift:" + source }
+func (k keyspace) audit() string                    { return k.ns + "audit" }
+func (k keyspace) lease() string                    { return k.ns + k.tag("leader") + ":lease" }
+func (k keyspace) fence() string                    { return k.ns + k.tag("leader") + ":fence" }
+func (k keyspace) invalidation() string             { return k.ns + "invalidate" }
@@ -0,0 +1,405 @@
+package redisdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/pkg/domain"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Версия схемы ключей, с которой работает сервис. Изменение формата записей требует новой версии и шага в migrations
+const SchemaVersion = 1
+
+// Шаги миграции: migrations[i] переводит данные с версии i на i+1. Шаги повторяемы: повторный запуск после сбоя
+// доводит миграцию до конца, не портя уже перенесенные данные
+var migrations = []func(ctx context.Context, m *migrator) error{
+	migrateNamespace,
+}
+
+// Версия схемы в бд. 0, если отметки версии нет
+func (r *connection) schemaVersion(ctx context.Context) (int, error) {
+	val, err := r.conn.Get(ctx, r.keys.schema()).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, wrapErr(r.keys.schema(), err)
+	}
+	version, err := strconv.Atoi(val)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("unknown db schema version %q", val)
+	}
+	return version, nil
+}
+
+// Проверка версии схемы перед запуском сервиса. sources - коды всех источников сервиса.
+// Бд без данных сервиса отмечается текущей версией, ключи других сервисов в общей бд не учитываются.
+// Данные без отметки версии, старой или неизвестной версии нужно перевести командой migrate
+func (c *Client) CheckSchema(ctx context.Context, maxRetries int, sources []string) error {
+	r := newConnection(c, maxRetries)
+	if err := r.waitConn(ctx); err != nil {
+		return err
+	}
+	version, err := r.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version == SchemaVersion:
+		return nil
+	case version > SchemaVersion:
+		return fmt.Errorf("unknown db schema version %d, this build supports version %d", version, SchemaVersion)
+	case version > 0:
+		return fmt.Errorf("db schema version %d is outdated, run migrate to upgrade to version %d", version, SchemaVersion)
+	}
+	m := &migrator{connection: r, old: keyspace{tags: c.keys.tags}, sources: sources}
+	found, err := m.hasData(ctx)
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("db has data without schema version, run migrate to upgrade to version %d", SchemaVersion)
+	}
+	return wrapErr(r.keys.schema(), r.conn.Set(ctx, r.keys.schema(), SchemaVersion, 0).Err())
+}
+
+// Состояние миграции
+type migrator struct {
+	connection
+	//Ключи версии 0
+	old keyspace
+	//Коды источников сервиса. Ключи версии 0 других источников не трогаются
+	sources []string
+	dryRun  bool
+	logger  *log.Logger
+	//Количество измененных ключей
+	changed int
+}
+
+// Запись изменения в лог и его выполнение. При пробном запуске изменение только пишется в лог
+func (m *migrator) apply(action string, fn func() error) error {
+	m.changed++
+	if m.dryRun {
+		m.logger.Println("dry run: " + action)
+		return nil
+	}
+	m.logger.Println(action)
+	return fn()
+}
+
+// Перевод данных на версию SchemaVersion. sources - коды всех источников сервиса. Возвращает версию схемы до миграции.
+// При dryRun данные не меняются, изменения только пишутся в лог
+func (c *Client) Migrate(ctx context.Context, maxRetries int, sources []string, dryRun bool, logger *log.Logger) (from int, err error) {
+	m := &migrator{connection: newConnection(c, maxRetries), old: keyspace{tags: c.keys.tags}, sources: sources, dryRun: dryRun, logger: logger}
+	if err := m.waitConn(ctx); err != nil {
+		return 0, err
+	}
+	if from, err = m.schemaVersion(ctx); err != nil {
+		return from, err
+	}
+	if from > SchemaVersion {
+		return from, fmt.Errorf("unknown db schema version %d, this build supports version %d", from, SchemaVersion)
+	}
+	for v := from; v < SchemaVersion; v++ {
+		logger.Printf("Migrating schema version %d to %d", v, v+1)
+		if err := migrations[v](ctx, m); err != nil {
+			return from, err
+		}
+		err := m.apply(fmt.Sprintf("set %s to %d", m.keys.schema(), v+1), func() error {
+			return wrapErr(m.keys.schema(), m.conn.Set(ctx, m.keys.schema(), v+1, 0).Err())
+		})
+		if err != nil {
+			return from, err
+		}
+	}
+	logger.Printf("Schema version %d, %d keys changed", SchemaVersion, m.changed)
+	return from, nil
+}
+
+// Валюта версии 0. Поля хэша названы по полям структуры, описание не зависит от domain.CurrModel
+type legacyCurr struct {
+	Date      string `redis:"Date"`
+	Code      string `redis:"Code"`
+	Name      string `redis:"Name"`
+	RatioBuy  string `redis:"RatioBuy"`
+	RatioSell string `redis:"RatioSell"`
+}
+
+// Ключи версии 0: шаблон поиска, тип значения и полное имя ключа. Ключ считается ключом сервиса, только если
+// совпадают имя и тип, а у множеств-индексов и журнала - еще и содержимое
+type legacyPattern struct {
+	match string
+	name  *regexp.Regexp
+	kind  string
+	check func(ctx context.Context, key string) (bool, error)
+}
+
+// Идентификатор, созданный сервисом: PREFIX-20060102150405-1a2b3c4d
+func idPattern(prefixes ...string) string {
+	quoted := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		quoted[i] = regexp.QuoteMeta(p)
+	}
+	return `(?:` + strings.Join(quoted, "|") + `)-\d{14}-[0-9a-f]{8}`
+}
+
+// Шаблоны ключей версии 0 для источников сервиса
+func (m *migrator) legacyPatterns() []legacyPattern {
+	exact := func(key string) *regexp.Regexp { return regexp.MustCompile("^" + regexp.QuoteMeta(key) + "$") }
+	quarantineID := regexp.MustCompile("^" + idPattern(m.sources...) + "$")
+	proposalID := regexp.MustCompile("^" + idPattern("P") + "$")
+	var res []legacyPattern
+	for _, source := range m.sources {
+		res = append(res,
+			legacyPattern{m.old.snap(source, "*"), regexp.MustCompile("^" + regexp.QuoteMeta(m.old.snap(source, source+"-")) + `\S+$`), "hash", nil},
+			legacyPattern{m.old.snapIndex(source), exact(m.old.snapIndex(source)), "zset", nil},
+			legacyPattern{m.old.snapInfo(source), exact(m.old.snapInfo(source)), "hash", nil},
+			legacyPattern{m.old.current(source), exact(m.old.current(source)), "string", nil},
+			legacyPattern{m.old.override(source), exact(m.old.override(source)), "hash", nil},
+			legacyPattern{m.old.policy(source), exact(m.old.policy(source)), "hash", nil},
+			legacyPattern{m.old.drift(source), exact(m.old.drift(source)), "list", nil},
+		)
+	}
+	res = append(res,
+		legacyPattern{m.old.quarantine("*"), regexp.MustCompile("^" + regexp.QuoteMeta(m.old.quarantine("")) + idPattern(m.sources...) + "$"), "string", nil},
+		legacyPattern{m.old.quarantineIndex(), exact(m.old.quarantineIndex()), "set", m.membersMatch(quarantineID)},
+		legacyPattern{m.old.proposal("*"), regexp.MustCompile("^" + regexp.QuoteMeta(m.old.proposal("")) + idPattern("P") + "$"), "string", nil},
+		legacyPattern{m.old.proposalIndex(), exact(m.old.proposalIndex()), "set", m.membersMatch(proposalID)},
+		legacyPattern{m.old.audit(), exact(m.old.audit()), "list", m.isAuditLog},
+	)
+	return res
+}
+
+// Все элементы множества - идентификаторы сервиса
+func (m *migrator) membersMatch(id *regexp.Regexp) func(ctx context.Context, key string) (bool, error) {
+	return func(ctx context.Context, key string) (bool, error) {
+		members, err := m.conn.SMembers(ctx, key).Result()
+		if err != nil {
+			return false, wrapErr(key, err)
+		}
+		for _, member := range members {
+			if !id.MatchString(member) {
+				return false, nil
+			}
+		}
+		return len(members) != 0, nil
+	}
+}
+
+// Журнал изменений сервиса: первая запись читается как domain.AuditEntry с действием и источником
+func (m *migrator) isAuditLog(ctx context.Context, key string) (bool, error) {
+	val, err := m.conn.LIndex(ctx, key, 0).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, wrapErr(key, err)
+	}
+	var entry domain.AuditEntry
+	if json.Unmarshal([]byte(val), &entry) != nil {
+		return false, nil
+	}
+	return entry.Action != "" && slices.Contains(m.sources, entry.Source), nil
+}
+
+// Проверка ключа по шаблону
+func (m *migrator) matches(ctx context.Context, key string, p legacyPattern) (bool, error) {
+	if !p.name.MatchString(key) {
+		return false, nil
+	}
+	kind, err := m.conn.Type(ctx, key).Result()
+	if err != nil {
+		return false, wrapErr(key, err)
+	}
+	if kind != p.kind {
+		return false, nil
+	}
+	if p.check == nil {
+		return true, nil
+	}
+	return p.check(ctx, key)
+}
+
+// Хэш валюты версии 0 "SOURCE:CODE": хэш, поле Code которого совпадает с кодом в ключе
+func (m *migrator) isLegacyCurr(ctx context.Context, key string) (bool, error) {
+	kind, err := m.conn.Type(ctx, key).Result()
+	if err != nil {
+		return false, wrapErr(key, err)
+	}
+	if kind != "hash" {
+		return false, nil
+	}
+	code, err := m.conn.HGet(ctx, key, "Code").Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, wrapErr(key, err)
+	}
+	return key[strings.LastIndex(key, ":")+1:] == code, nil
+}
+
+// Ключи версии 0 сервиса: ключи для переноса в пространство namespace и хэши валют по источникам.
+// Ключи, не опознанные как ключи сервиса, пропускаются и пишутся в лог
+func (m *migrator) legacyKeys(ctx context.Context) (moves []string, currs map[string][]string, err error) {
+	for _, p := range m.legacyPatterns() {
+		keys, err := m.scanKeys(ctx, p.match)
+		if err != nil {
+			return nil, nil, wrapErr(p.match, err)
+		}
+		for _, key := range keys {
+			ok, err := m.matches(ctx, key, p)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				moves = append(moves, key)
+			} else {
+				m.skip(key)
+			}
+		}
+	}
+	currs = make(map[string][]string)
+	for _, source := range m.sources {
+		keys, err := m.scanKeys(ctx, source+":[A-Z][A-Z][A-Z]")
+		if err != nil {
+			return nil, nil, wrapErr(source+":*", err)
+		}
+		for _, key := range keys {
+			ok, err := m.isLegacyCurr(ctx, key)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				currs[source] = append(currs[source], key)
+			} else {
+				m.skip(key)
+			}
+		}
+	}
+	return moves, currs, nil
+}
+
+func (m *migrator) skip(key string) {
+	if m.logger != nil {
+		m.logger.Println("skip " + key + ": not a key of this service")
+	}
+}
+
+// Есть ли в бд данные сервиса: ключи в пространстве namespace или ключи версии 0
+func (m *migrator) hasData(ctx context.Context) (bool, error) {
+	keys, err := m.scanKeys(ctx, namespace+"*")
+	if err != nil {
+		return false, wrapErr(namespace+"*", err)
+	}
+	if len(keys) != 0 {
+		return true, nil
+	}
+	moves, currs, err := m.legacyKeys(ctx)
+	return len(moves)+len(currs) != 0, err
+}
+
+// Миграция 0 -> 1. Ключи источников сервиса переносятся в пространство namespace. Хэши валют "SOURCE:CODE",
+// записанные до появления снимков, становятся снимком источника с происхождением migration, если у источника
+// нет снимков, иначе удаляются. Ключи других сервисов в общей бд не переносятся и не удаляются
+func migrateNamespace(ctx context.Context, m *migrator) error {
+	moves, currs, err := m.legacyKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, key := range moves {
+		if err := m.move(ctx, key, namespace+key); err != nil {
+			return err
+		}
+	}
+	sources := make([]string, 0, len(currs))
+	for source := range currs {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		if err := m.convertLegacy(ctx, source, currs[source]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Перенос ключа с сохранением типа и срока жизни. Если ключ уже перенесен, он перезаписывается
+func (m *migrator) move(ctx context.Context, from string, to string) error {
+	return m.apply("move "+from+" -> "+to, func() error {
+		dump, err := m.conn.Dump(ctx, from).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		if err != nil {
+			return wrapErr(from, err)
+		}
+		ttl, err := m.conn.PTTL(ctx, from).Result()
+		if err != nil {
+			return wrapErr(from, err)
+		}
+		if ttl < 0 {
+			ttl = 0
+		}
+		if err = m.conn.RestoreReplace(ctx, to, ttl, dump).Err(); err != nil {
+			return wrapErr(to, err)
+		}
+		return wrapErr(from, m.conn.Del(ctx, from).Err())
+	})
+}
+
+// Запись хэшей валют источника снимком и удаление хэшей
+func (m *migrator) convertLegacy(ctx context.Context, source string, keys []string) error {
+	sort.Strings(keys)
+	current, err := m.conn.Exists(ctx, m.keys.current(source), m.old.current(source)).Result()
+	if err != nil {
+		return wrapErr(m.keys.current(source), err)
+	}
+	if current == 0 {
+		rates := make([]domain.CurrModel, 0, len(keys))
+		date := ""
+		for _, key := range keys {
+			var c legacyCurr
+			cmd := m.conn.HGetAll(ctx, key)
+			if err := cmd.Err(); err != nil {
+				return wrapErr(key, err)
+			}
+			if err := cmd.Scan(&c); err != nil {
+				return corrupt(key, err)
+			}
+			if c.Code == "" {
+				return corrupt(key, errors.New("empty currency code"))
+			}
+			rates = append(rates, domain.ToCurrModel(c.Date, source, c.Code, c.Name, c.RatioBuy, c.RatioSell))
+			date = max(date, c.Date)
+		}
+		snap := domain.Snapshot{ID: source + "-legacy", Source: source, Created: time.Now().Format(time.RFC3339),
+			Date: date, Origin: domain.SnapshotMigration}
+		err := m.apply(fmt.Sprintf("store %d currencies of %s as snapshot %s", len(rates), source, snap.ID), func() error {
+			return (&CurrModelRepository{m.connection}).StoreSnapshot(ctx, snap, rates)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		err := m.apply("delete "+key, func() error {
+			return wrapErr(key, m.conn.Del(ctx, key).Err())
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"main/internal/pkg/domain"
+)
+
+// Количество хранимых записей журнала
+const maxAuditEntries = 10000
+
+// Репозиторий журнала изменений в SQLite. Запись хранится в JSON, время, автор, действие и валюта -
+// в отдельных столбцах для отчетов
+type AuditRepository struct {
+	*DB
+}
+
+// Создание нового репозитория. Нужно подключение к SQLite
+func NewAuditRepository(db *DB) *AuditRepository {
+	return &AuditRepository{db}
+}
+
+// Добавление записи в журнал. Записи сверх maxAuditEntries удаляются
+func (r *AuditRepository) AppendAudit(ctx context.Context, e domain.AuditEntry) (err error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return wrapErr("audit", r.tx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO audit (time, actor, action, source, code, data) VALUES (?, ?, ?, ?, ?, ?)`,
+			e.Time, e.Actor, e.Action, e.Source, e.Code, data)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM audit WHERE id <= (SELECT max(id) FROM audit) - ?`, maxAuditEntries)
+		return err
+	}))
+}
+
+// Получение последних limit записей журнала
+func (r *AuditRepository) GetAudit(ctx context.Context, limit int) (res []domain.AuditEntry, err error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT data FROM audit ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return res, wrapErr("audit", err)
+	}
+	defer rows.Close()
+	res = make([]domain.AuditEntry, 0)
+	for rows.Next() {
+		var data []byte
+		var e domain.AuditEntry
+		if err := rows.Scan(&data); err != nil {
+			return res, wrapErr("audit", err)
+		}
+		if err := json.Unmarshal(data, &e); err != nil {
+			return res, corrupt("audit", err)
+		}
+		res = append(res, e)
+	}
+	return res, wrapErr("audit", rows.Err())
+}
@@ -0,0 +1,231 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"main/internal/pkg/domain"
+	"time"
+)
+
+// Репозиторий хранения курсов в SQLite. Название валюты хранится в курсе каждого снимка,
+// currencies содержит валюты источника с последним названием
+type CurrModelRepository struct {
+	*DB
+}
+
+// Создание нового репозитория. Нужно подключение к SQLite
+func NewCurrModelRepository(db *DB) *CurrModelRepository {
+	return &CurrModelRepository{db}
+}
+
+// Курсы с названиями валют
+const selectRates = `SELECT r.snapshot, r.date, r.code, r.name, r.ratio_buy, r.ratio_sell, r.override FROM rates r `
+
+// Чтение курсов из строк запроса selectRates
+func scanRates(source string, rows *sql.Rows) (res []domain.CurrModel, err error) {
+	defer rows.Close()
+	res = make([]domain.CurrModel, 0)
+	for rows.Next() {
+		curr := domain.CurrModel{Source: source}
+		var override sql.NullString
+		if err := rows.Scan(&curr.Snapshot, &curr.Date, &curr.Code, &curr.Name, &curr.RatioBuy, &curr.RatioSell, &override); err != nil {
+			return res, wrapErr("rates "+source, err)
+		}
+		if override.Valid {
+			curr.Override = &domain.RateOverride{}
+			if err := json.Unmarshal([]byte(override.String), curr.Override); err != nil {
+				return res, corrupt("rates "+source+" "+curr.Code, err)
+			}
+		}
+		res = append(res, curr)
+	}
+	return res, wrapErr("rates "+source, rows.Err())
+}
+
+// Получение данных по источнику и коду валюты из действующего снимка.
+// Если валюты нет, возвращает ошибку вида domain.ErrNotFound
+func (r *CurrModelRepository) GetBySourceAndKey(ctx context.Context, source string, key string) (res domain.CurrModel, err error) {
+	rows, err := r.db.QueryContext(ctx, selectRates+`JOIN sources s ON s.code = r.source AND s.current_snapshot = r.snapshot
+		WHERE r.source = ? AND r.code = ?`, source, key)
+	if err != nil {
+		return res, wrapErr("rates "+source, err)
+	}
+	curr, err := scanRates(source, rows)
+	if err != nil {
+		return res, err
+	}
+	if len(curr) == 0 {
+		return res, &domain.RepoError{Kind: domain.ErrNotFound, Key: "rates " + source + " " + key}
+	}
+	return curr[0], nil
+}
+
+// Получение данных по источнику из действующего снимка
+func (r *CurrModelRepository) GetAllBySource(ctx context.Context, source string) (res []domain.CurrModel, err error) {
+	rows, err := r.db.QueryContext(ctx, selectRates+`JOIN sources s ON s.code = r.source AND s.current_snapshot = r.snapshot
+		WHERE r.source = ? ORDER BY r.code`, source)
+	if err != nil {
+		return res, wrapErr("rates "+source, err)
+	}
+	return scanRates(source, rows)
+}
+
+// Получение курсов снимка, отсортированных по коду валюты. Если снимка нет, возвращается пустой список
+func (r *CurrModelRepository) GetSnapshotRates(ctx context.Context, source string, id string) (res []domain.CurrModel, err error) {
+	rows, err := r.db.QueryContext(ctx, selectRates+`WHERE r.source = ? AND r.snapshot = ? ORDER BY r.code`, source, id)
+	if err != nil {
+		return res, wrapErr("rates "+source, err)
+	}
+	return scanRates(source, rows)
+}
+
+// Запись снимка и перевод указателя действующего снимка в одной транзакции.
+// Повторная запись снимка с тем же идентификатором дополняет его курсы.
+// Токен ограждения снимка сравнивается с токеном источника в той же транзакции
+func (r *CurrModelRepository) StoreSnapshot(ctx context.Context, snap domain.Snapshot, rates []domain.CurrModel) (err error) {
+	return r.storeSnapshot(ctx, snap, rates, true)
+}
+
+// Запись снимка без перевода указателя действующего снимка
+func (r *CurrModelRepository) AddSnapshot(ctx context.Context, snap domain.Snapshot, rates []domain.CurrModel) (err error) {
+	return r.storeSnapshot(ctx, snap, rates, false)
+}
+
+func (r *CurrModelRepository) storeSnapshot(ctx context.Context, snap domain.Snapshot, rates []domain.CurrModel, activate bool) (err error) {
+	created, err := time.Parse(time.RFC3339, snap.Created)
+	if err != nil {
+		return err
+	}
+	codes := make(map[string]bool, len(rates))
+	overrides := make([]sql.NullString, len(rates))
+	for i, c := range rates {
+		codes[c.Code] = true
+		if c.Override == nil {
+			continue
+		}
+		data, err := json.Marshal(c.Override)
+		if err != nil {
+			return err
+		}
+		overrides[i] = sql.NullString{String: string(data), Valid: true}
+	}
+	return wrapErr("snapshot "+snap.Source+" "+snap.ID, r.tx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO sources (code) VALUES (?) ON CONFLICT DO NOTHING`, snap.Source); err != nil {
+			return err
+		}
+		if snap.Fence != 0 {
+			res, err := tx.ExecContext(ctx, `UPDATE sources SET fence = ? WHERE code = ? AND fence <= ?`, snap.Fence, snap.Source, snap.Fence)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return domain.ErrNotLeader
+			}
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO snapshots (source, id, created, created_at, date, origin, count, hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT DO UPDATE SET created = excluded.created, created_at = excluded.created_at, date = excluded.date,
+			origin = excluded.origin, count = excluded.count, hash = excluded.hash`,
+			snap.Source, snap.ID, created.Unix(), snap.Created, snap.Date, snap.Origin, len(codes), snap.Hash)
+		if err != nil {
+			return err
+		}
+		for i, c := range rates {
+			_, err := tx.ExecContext(ctx, `INSERT INTO currencies (source, code, name) VALUES (?, ?, ?)
+				ON CONFLICT DO UPDATE SET name = excluded.name`, snap.Source, c.Code, c.Name)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO rates (source, snapshot, code, name, date, ratio_buy, ratio_sell, override)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT DO UPDATE SET name = excluded.name, date = excluded.date, ratio_buy = excluded.ratio_buy,
+				ratio_sell = excluded.ratio_sell, override = excluded.override`,
+				snap.Source, snap.ID, c.Code, c.Name, c.Date, c.RatioBuy, c.RatioSell, overrides[i])
+			if err != nil {
+				return err
+			}
+		}
+		if !activate {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE sources SET current_snapshot = ? WHERE code = ?`, snap.ID, snap.Source)
+		return err
+	}))
+}
+
+// Активация ранее записанного снимка. Если снимка нет, возвращает ошибку вида domain.ErrNotFound
+func (r *CurrModelRepository) ActivateSnapshot(ctx context.Context, source string, id string) (err error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE sources SET current_snapshot = ?
+		WHERE code = ? AND EXISTS (SELECT 1 FROM snapshots WHERE source = ? AND id = ?)`, id, source, source, id)
+	if err != nil {
+		return wrapErr("snapshot "+source+" "+id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return wrapErr("snapshot "+source+" "+id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// Получение описаний снимков источника от новых к старым
+func (r *CurrModelRepository) GetSnapshots(ctx context.Context, source string) (res []domain.Snapshot, err error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT sn.id, sn.created_at, sn.date, sn.origin, sn.count, sn.hash, sn.id IS s.current_snapshot
+		FROM snapshots sn JOIN sources s ON s.code = sn.source
+		WHERE sn.source = ? ORDER BY sn.created DESC, sn.id DESC`, source)
+	if err != nil {
+		return res, wrapErr("snapshots "+source, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		snap := domain.Snapshot{Source: source}
+		if err := rows.Scan(&snap.ID, &snap.Created, &snap.Date, &snap.Origin, &snap.Count, &snap.Hash, &snap.Active); err != nil {
+			return res, wrapErr("snapshots "+source, err)
+		}
+		res = append(res, snap)
+	}
+	return res, wrapErr("snapshots "+source, rows.Err())
+}
+
+// Удаление старых снимков источника сверх keep последних вместе с их курсами. Действующий снимок не удаляется
+func (r *CurrModelRepository) PruneSnapshots(ctx context.Context, source string, keep int) (removed []string, err error) {
+	err = r.tx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT sn.id FROM snapshots sn JOIN sources s ON s.code = sn.source
+			WHERE sn.source = ? AND sn.id IS NOT s.current_snapshot AND sn.id NOT IN
+			(SELECT id FROM snapshots WHERE source = ? ORDER BY created DESC, id DESC LIMIT ?)`, source, source, keep)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			removed = append(removed, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, id := range removed {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM rates WHERE source = ? AND snapshot = ?`, source, id); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM snapshots WHERE source = ? AND id = ?`, source, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrapErr("snapshots "+source, err)
+	}
+	return removed, nil
+}
+
+// Закрытие подключения к бд. Реализуется в main через горутину graceful shutdown
+func (r *CurrModelRepository) Close(ctx context.Context) (err error) {
+	return r.DB.Close()
+}
@@ -0,0 +1,59 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"main/internal/pkg/domain"
+)
+
+// Количество хранимых отчетов по источнику
+const maxDriftReports = 50
+
+// Репозиторий отчетов о расхождении схем в SQLite. Отчеты хранятся в JSON в таблице drift_reports
+type DriftRepository struct {
+	*DB
+}
+
+// Создание нового репозитория. Нужно подключение к SQLite
+func NewDriftRepository(db *DB) *DriftRepository {
+	return &DriftRepository{db}
+}
+
+// Запись отчета. Старые отчеты сверх maxDriftReports удаляются
+func (r *DriftRepository) StoreDrift(ctx context.Context, report domain.DriftReport) (err error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return wrapErr("drift_reports "+report.Source, r.tx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO drift_reports (source, data) VALUES (?, ?)`, report.Source, data); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM drift_reports WHERE source = ? AND id NOT IN
+			(SELECT id FROM drift_reports WHERE source = ? ORDER BY id DESC LIMIT ?)`, report.Source, report.Source, maxDriftReports)
+		return err
+	}))
+}
+
+// Получение отчетов источника, начиная с последнего
+func (r *DriftRepository) GetDrifts(ctx context.Context, source string) (res []domain.DriftReport, err error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT data FROM drift_reports WHERE source = ? ORDER BY id DESC`, source)
+	if err != nil {
+		return res, wrapErr("drift_reports "+source, err)
+	}
+	defer rows.Close()
+	res = make([]domain.DriftReport, 0)
+	for rows.Next() {
+		var data []byte
+		var report domain.DriftReport
+		if err := rows.Scan(&data); err != nil {
+			return res, wrapErr("drift_reports "+source, err)
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			return res, corrupt("drift_reports "+source, err)
+		}
+		res = append(res, report)
+	}
+	return res, wrapErr("drift_reports "+source, rows.Err())
+}
@@ -0,0 +1,63 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Имя аренды обновления источников
+const leaderLease = "leader"
+
+// Репозиторий аренды лидерства в SQLite. Аренду делят процессы, открывшие один файл бд.
+// Срок аренды хранится в миллисекундах Unix, токен растет с каждой новой арендой
+type LeaseRepository struct {
+	*DB
+}
+
+// Создание нового репозитория. Нужно подключение к SQLite
+func NewLeaseRepository(db *DB) *LeaseRepository {
+	return &LeaseRepository{db}
+}
+
+// Получение аренды на ttl или продление аренды holder
+func (r *LeaseRepository) AcquireLease(ctx context.Context, holder string, ttl time.Duration) (token int64, err error) {
+	err = r.tx(ctx, func(tx *sql.Tx) error {
+		now := time.Now().UnixMilli()
+		var owner string
+		var expires int64
+		err := tx.QueryRowContext(ctx, `SELECT holder, token, expires FROM leases WHERE name = ?`, leaderLease).Scan(&owner, &token, &expires)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		switch {
+		case expires > now && owner != holder:
+			token = 0
+			return nil
+		case expires <= now:
+			token++
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO leases (name, holder, token, expires) VALUES (?, ?, ?, ?)
+			ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, token = excluded.token, expires = excluded.expires`,
+			leaderLease, holder, token, now+ttl.Milliseconds())
+		return err
+	})
+	if err != nil {
+		return 0, wrapErr("leases", err)
+	}
+	return token, nil
+}
+
+// Проверка, что аренда с токеном token еще действует
+func (r *LeaseRepository) CheckLease(ctx context.Context, token int64) (valid bool, err error) {
+	err = r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM leases WHERE name = ? AND token = ? AND expires > ?)`,
+		leaderLease, token, time.Now().UnixMilli()).Scan(&valid)
+	return valid, wrapErr("leases", err)
+}
+
+// Освобождение аренды holder
+func (r *LeaseRepository) ReleaseLease(ctx context.Context, holder string) (err error) {
+	_, err = r.db.ExecContext(ctx, `UPDATE leases SET expires = 0 WHERE name = ? AND holder = ?`, leaderLease, holder)
+	return wrapErr("leases", err)
+}
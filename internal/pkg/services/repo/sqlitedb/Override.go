@@ -0,0 +1,74 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"main/internal/pkg/domain"
+)
+
+// Репозиторий ручных курсов в SQLite. Курс хранится в JSON в таблице overrides
+type OverrideRepository struct {
+	*DB
+}
+
+// Создание нового репозитория. Нужно подключение к SQLite
+func NewOverrideRepository(db *DB) *OverrideRepository {
+	return &OverrideRepository{db}
+}
+
+// Запись или замена ручного курса
+func (r *OverrideRepository) StoreOverride(ctx context.Context, o domain.RateOverride) (err error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `INSERT INTO overrides (source, code, data) VALUES (?, ?, ?)
+		ON CONFLICT DO UPDATE SET data = excluded.data`, o.Source, o.Code, data)
+	return wrapErr("overrides "+o.Source, err)
+}
+
+// Удаление ручного курса
+func (r *OverrideRepository) DeleteOverride(ctx context.Context, source string, code string) (err error) {
+	_, err = r.db.ExecContext(ctx, `DELETE FROM overrides WHERE source = ? AND code = ?`, source, code)
+	return wrapErr("overrides "+source, err)
+}
+
+// Получение ручного курса. Если курса нет, возвращается курс с пустым Code
+func (r *OverrideRepository) GetOverride(ctx context.Context, source string, code string) (res domain.RateOverride, err error) {
+	var data []byte
+	err = r.db.QueryRowContext(ctx, `SELECT data FROM overrides WHERE source = ? AND code = ?`, source, code).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return res, nil
+	}
+	if err != nil {
+		return res, wrapErr("overrides "+source, err)
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, corrupt("overrides "+source+" "+code, err)
+	}
+	return res, nil
+}
+
+// Получение ручных курсов источника, отсортированных по коду валюты
+func (r *OverrideRepository) GetOverrides(ctx context.Context, source string) (res []domain.RateOverride, err error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT data FROM overrides WHERE source = ? ORDER BY code`, source)
+	if err != nil {
+		return res, wrapErr("overrides "+source, err)
+	}
+	defer rows.Close()
+	res = make([]domain.RateOverride, 0)
+	for rows.Next() {
+		var data []byte
+		var o domain.RateOverride
+		if err := rows.Scan(&data); err != nil {
+			return res, wrapErr("overrides "+source, err)
+		}
+		if err := json.Unmarshal(data, &o); err != nil {
+			return res, corrupt("overrides "+source, err)
+		}
+		res = append(res, o)
+	}
+	return res, wrapErr("overrides "+source, rows.Err())
+}
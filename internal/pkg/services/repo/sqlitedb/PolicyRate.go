@@ -0,0 +1,52 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"main/internal/pkg/domain"
+)
+
+// Репозиторий ключевых ставок в SQLite. История источника хранится в таблице policy_rates
+type PolicyRateRepository struct {
+	*DB
+}
+
+// Создание нового репозитория. Нужно подключение к SQLite
+func NewPolicyRateRepository(db *DB) *PolicyRateRepository {
+	return &PolicyRateRepository{db}
+}
+
+// Получение истории ставок источника, отсортированной по дате вступления в силу
+func (r *PolicyRateRepository) GetPolicyRates(ctx context.Context, source string) (res []domain.PolicyRate, err error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT date, rate FROM policy_rates WHERE source = ? ORDER BY date`, source)
+	if err != nil {
+		return res, wrapErr("policy_rates "+source, err)
+	}
+	defer rows.Close()
+	res = make([]domain.PolicyRate, 0)
+	for rows.Next() {
+		rate := domain.PolicyRate{Source: source}
+		if err := rows.Scan(&rate.Date, &rate.Rate); err != nil {
+			return res, wrapErr("policy_rates "+source, err)
+		}
+		res = append(res, rate)
+	}
+	return res, wrapErr("policy_rates "+source, rows.Err())
+}
+
+// Замена истории ставок источника. Старая история удаляется в той же транзакции
+func (r *PolicyRateRepository) StorePolicyRates(ctx context.Context, source string, rates []domain.PolicyRate) (err error) {
+	return wrapErr("policy_rates "+source, r.tx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM policy_rates WHERE source = ?`, source); err != nil {
+			return err
+		}
+		for _, rate := range rates {
+			_, err := tx.ExecContext(ctx, `INSERT INTO policy_rates (source, date, rate) VALUES (?, ?, ?)
+				ON CONFLICT DO UPDATE SET rate = excluded.rate`, source, rate.Date, rate.Rate)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,84 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"main/internal/pkg/domain"
+)
+
+// Репозиторий предложений в SQLite. Предложение хранится в JSON в таблице proposals
+type ProposalRepository struct {
+	*DB
+}
+
+// Создание нового репозитория. Нужно подключение к SQLite
+func NewProposalRepository(db *DB) *ProposalRepository {
+	return &ProposalRepository{db}
+}
+
+// Запись или перезапись предложения
+func (r *ProposalRepository) StoreProposal(ctx context.Context, p domain.Proposal) (err error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `INSERT INTO proposals (id, created, status, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT DO UPDATE SET created = excluded.created, status = excluded.status, data = excluded.data`,
+		p.ID, p.Created, p.Status, data)
+	return wrapErr("proposals "+p.ID, err)
+}
+
+// Перезапись ожидающего решения предложения одним запросом с условием на статус
+func (r *ProposalRepository) ResolveProposal(ctx context.Context, p domain.Proposal) (resolved bool, err error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return false, err
+	}
+	res, err := r.db.ExecContext(ctx, `UPDATE proposals SET status = ?, data = ? WHERE id = ? AND status = ?`,
+		p.Status, data, p.ID, domain.ProposalPending)
+	if err != nil {
+		return false, wrapErr("proposals "+p.ID, err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, wrapErr("proposals "+p.ID, err)
+}
+
+// Получение предложения по идентификатору. Если предложения нет, возвращается предложение с пустым ID
+func (r *ProposalRepository) GetProposal(ctx context.Context, id string) (res domain.Proposal, err error) {
+	var data []byte
+	err = r.db.QueryRowContext(ctx, `SELECT data FROM proposals WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return res, nil
+	}
+	if err != nil {
+		return res, wrapErr("proposals "+id, err)
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, corrupt("proposals "+id, err)
+	}
+	return res, nil
+}
+
+// Получение всех предложений от новых к старым
+func (r *ProposalRepository) GetProposals(ctx context.Context) (res []domain.Proposal, err error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT data FROM proposals ORDER BY created DESC`)
+	if err != nil {
+		return res, wrapErr("proposals", err)
+	}
+	defer rows.Close()
+	res = make([]domain.Proposal, 0)
+	for rows.Next() {
+		var data []byte
+		var p domain.Proposal
+		if err := rows.Scan(&data); err != nil {
+			return res, wrapErr("proposals", err)
+		}
+		if err := json.Unmarshal(data, &p); err != nil {
+			return res, corrupt("proposals", err)
+		}
+		res = append(res, p)
+	}
+	return res, wrapErr("proposals", rows.Err())
+}
@@ -0,0 +1,69 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"main/internal/pkg/domain"
+)
+
+// Репозиторий снимков в карантине в SQLite. Снимок хранится в JSON в таблице quarantine
+type QuarantineRepository struct {
+	*DB
+}
+
+// Создание нового репозитория. Нужно подключение к SQLite
+func NewQuarantineRepository(db *DB) *QuarantineRepository {
+	return &QuarantineRepository{db}
+}
+
+// Запись или перезапись снимка
+func (r *QuarantineRepository) StoreQuarantine(ctx context.Context, q domain.QuarantinedSnapshot) (err error) {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `INSERT INTO quarantine (id, source, created, status, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT DO UPDATE SET source = excluded.source, created = excluded.created, status = excluded.status, data = excluded.data`,
+		q.ID, q.Source, q.Created, q.Status, data)
+	return wrapErr("quarantine "+q.ID, err)
+}
+
+// Получение снимка по идентификатору. Если снимка нет, возвращается снимок с пустым ID
+func (r *QuarantineRepository) GetQuarantine(ctx context.Context, id string) (res domain.QuarantinedSnapshot, err error) {
+	var data []byte
+	err = r.db.QueryRowContext(ctx, `SELECT data FROM quarantine WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return res, nil
+	}
+	if err != nil {
+		return res, wrapErr("quarantine "+id, err)
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, corrupt("quarantine "+id, err)
+	}
+	return res, nil
+}
+
+// Получение снимков источника (всех источников при пустом source) от новых к старым
+func (r *QuarantineRepository) GetAllQuarantine(ctx context.Context, source string) (res []domain.QuarantinedSnapshot, err error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT data FROM quarantine WHERE ? = '' OR source = ? ORDER BY created DESC`, source, source)
+	if err != nil {
+		return res, wrapErr("quarantine", err)
+	}
+	defer rows.Close()
+	res = make([]domain.QuarantinedSnapshot, 0)
+	for rows.Next() {
+		var data []byte
+		var q domain.QuarantinedSnapshot
+		if err := rows.Scan(&data); err != nil {
+			return res, wrapErr("quarantine", err)
+		}
+		if err := json.Unmarshal(data, &q); err != nil {
+			return res, corrupt("quarantine", err)
+		}
+		res = append(res, q)
+	}
+	return res, wrapErr("quarantine", rows.Err())
+}
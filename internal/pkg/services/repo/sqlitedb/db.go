@@ -0,0 +1,50 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
+)
+
+var logger = log.New(os.Stdout, "sqlitedb ", log.LstdFlags)
+
+// Подключение к файлу SQLite, общее для репозиториев пакета. Записи идут через транзакции
+// с немедленной блокировкой, читатели в режиме WAL не ждут писателя
+type DB struct {
+	db *sql.DB
+}
+
+// Открытие бд и применение недостающих миграций схемы. Файл создается, если его нет
+func Open(ctx context.Context, path string) (*DB, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_pragma=journal_mode(wal)")
+	if err != nil {
+		return nil, err
+	}
+	if err = migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, wrapErr(path, err)
+	}
+	return &DB{db}, nil
+}
+
+// Выполнение fn в транзакции. При ошибке fn транзакция откатывается
+func (d *DB) tx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Закрытие подключения к бд
+func (d *DB) Close() error {
+	return d.db.Close()
+}
@@ -0,0 +1,37 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"main/internal/pkg/domain"
+
+	"github.com/ncruces/go-sqlite3"
+)
+
+// Приведение ошибки SQLite к типизированной ошибке хранилища.
+// Занятая другим процессом бд считается таймаутом, поврежденный файл и нарушение схемы - повреждением записи
+func wrapErr(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var repoErr *domain.RepoError
+	if errors.As(err, &repoErr) || errors.Is(err, domain.ErrNotLeader) {
+		return err
+	}
+	kind := domain.ErrConnLost
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return &domain.RepoError{Kind: domain.ErrNotFound, Key: key}
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, sqlite3.BUSY):
+		kind = domain.ErrDBTimeout
+	case errors.Is(err, sqlite3.CORRUPT), errors.Is(err, sqlite3.NOTADB), errors.Is(err, sqlite3.MISMATCH), errors.Is(err, sqlite3.CONSTRAINT):
+		kind = domain.ErrCorruptRecord
+	}
+	return &domain.RepoError{Kind: kind, Key: key, Err: err}
+}
+
+// Ошибка чтения поврежденной записи
+func corrupt(key string, err error) error {
+	return &domain.RepoError{Kind: domain.ErrCorruptRecord, Key: key, Err: err}
+}
@@ -0,0 +1,127 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+)
+
+// Миграции схемы по порядку. Номер примененной миграции хранится в PRAGMA user_version.
+// Примененные миграции не меняются, изменения схемы добавляются новой миграцией в конец
+var migrations = []string{
+	//1: источники, валюты, снимки и курсы валют снимков по дате курса. Название валюты хранится в курсе снимка,
+	//currencies содержит последнее название
+	`CREATE TABLE sources (
+		code TEXT PRIMARY KEY,
+		current_snapshot TEXT
+	);
+	CREATE TABLE currencies (
+		source TEXT NOT NULL REFERENCES sources (code),
+		code TEXT NOT NULL,
+		name TEXT NOT NULL,
+		PRIMARY KEY (source, code)
+	);
+	CREATE TABLE snapshots (
+		source TEXT NOT NULL REFERENCES sources (code),
+		id TEXT NOT NULL,
+		created INTEGER NOT NULL,
+		created_at TEXT NOT NULL,
+		date TEXT NOT NULL,
+		origin TEXT NOT NULL,
+		count INTEGER NOT NULL,
+		PRIMARY KEY (source, id)
+	);
+	CREATE INDEX snapshots_created ON snapshots (source, created);
+	CREATE TABLE rates (
+		source TEXT NOT NULL,
+		snapshot TEXT NOT NULL,
+		code TEXT NOT NULL,
+		name TEXT NOT NULL,
+		date TEXT NOT NULL,
+		ratio_buy TEXT NOT NULL,
+		ratio_sell TEXT NOT NULL,
+		override TEXT,
+		PRIMARY KEY (source, snapshot, code),
+		FOREIGN KEY (source, snapshot) REFERENCES snapshots (source, id),
+		FOREIGN KEY (source, code) REFERENCES currencies (source, code)
+	);
+	CREATE INDEX rates_date ON rates (source, code, date);`,
+	//2: ключевые ставки, отчеты о расхождении схем, карантин, ручные курсы, журнал и предложения
+	`CREATE TABLE policy_rates (
+		source TEXT NOT NULL,
+		date TEXT NOT NULL,
+		rate TEXT NOT NULL,
+		PRIMARY KEY (source, date)
+	);
+	CREATE TABLE drift_reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		source TEXT NOT NULL,
+		data TEXT NOT NULL
+	);
+	CREATE INDEX drift_reports_source ON drift_reports (source, id);
+	CREATE TABLE quarantine (
+		id TEXT PRIMARY KEY,
+		source TEXT NOT NULL,
+		created TEXT NOT NULL,
+		status TEXT NOT NULL,
+		data TEXT NOT NULL
+	);
+	CREATE TABLE overrides (
+		source TEXT NOT NULL,
+		code TEXT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (source, code)
+	);
+	CREATE TABLE audit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		source TEXT NOT NULL,
+		code TEXT NOT NULL,
+		data TEXT NOT NULL
+	);
+	CREATE TABLE proposals (
+		id TEXT PRIMARY KEY,
+		created TEXT NOT NULL,
+		status TEXT NOT NULL,
+		data TEXT NOT NULL
+	);`,
+	//3: аренда лидерства. Строка аренды не удаляется, чтобы токен следующей аренды был больше
+	`CREATE TABLE leases (
+		name TEXT PRIMARY KEY,
+		holder TEXT NOT NULL,
+		token INTEGER NOT NULL,
+		expires INTEGER NOT NULL
+	);`,
+	//4: хэш курсов снимка, у прежних снимков пустой
+	`ALTER TABLE snapshots ADD COLUMN hash TEXT NOT NULL DEFAULT '';`,
+	//5: последний токен ограждения, с которым записан снимок источника
+	`ALTER TABLE sources ADD COLUMN fence INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// Применение миграций, которых еще нет в бд. Каждая миграция применяется в своей транзакции
+func migrate(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, migrations[i]); err == nil {
+			_, err = tx.ExecContext(ctx, "PRAGMA user_version = "+strconv.Itoa(i+1))
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		logger.Printf("Applied migration %d", i+1)
+	}
+	return nil
+}
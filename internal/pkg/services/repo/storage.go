@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"main/config"
+	"main/internal/pkg/domain"
+	"main/internal/pkg/services/repo/cachedb"
+	"main/internal/pkg/services/repo/memdb"
+	"main/internal/pkg/services/repo/redisdb"
+	"main/internal/pkg/services/repo/sqlitedb"
+	"time"
+)
+
+// Реализации хранилищ сервиса в выбранной бд
+type Storage struct {
+	Database   domain.DatabaseService
+	Policy     domain.PolicyRateService
+	Drift      domain.DriftService
+	Quarantine domain.QuarantineService
+	Override   domain.OverrideService
+	Audit      domain.AuditService
+	Proposal   domain.ProposalService
+	Lease      domain.LeaseService
+}
+
+// Создание хранилищ по DB_BACKEND: redis (по умолчанию), memory или sqlite.
+// Курсы действующих снимков читаются через кэш, если CACHE_TTL не 0
+func NewStorage(ctx context.Context, AppConfig *config.AppConfig) (*Storage, error) {
+	storage, bus, err := newStorage(ctx, AppConfig)
+	if err != nil || AppConfig.CacheTTL <= 0 {
+		return storage, err
+	}
+	storage.Database = cachedb.NewCachedRepository(ctx, storage.Database, time.Duration(AppConfig.CacheTTL)*time.Second, bus)
+	return storage, nil
+}
+
+// Хранилища выбранной бд и рассылка сброса кэша между репликами. Рассылка есть только у Redis
+func newStorage(ctx context.Context, AppConfig *config.AppConfig) (*Storage, cachedb.Broadcaster, error) {
+	switch AppConfig.DbBackend {
+	case config.DbRedis, "":
+		client, err := redisdb.NewClient(AppConfig.DbUrl, AppConfig.Db)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := client.CheckSchema(ctx, AppConfig.DbAttempts, AppConfig.KnownSources()); err != nil {
+			client.Close()
+			return nil, nil, err
+		}
+		return &Storage{
+			Database:   redisdb.NewCurrModelRepository(client, AppConfig.DbAttempts),
+			Policy:     redisdb.NewPolicyRateRepository(client, AppConfig.DbAttempts),
+			Drift:      redisdb.NewDriftRepository(client, AppConfig.DbAttempts),
+			Quarantine: redisdb.NewQuarantineRepository(client, AppConfig.DbAttempts),
+			Override:   redisdb.NewOverrideRepository(client, AppConfig.DbAttempts),
+			Audit:      redisdb.NewAuditRepository(client, AppConfig.DbAttempts),
+			Proposal:   redisdb.NewProposalRepository(client, AppConfig.DbAttempts),
+			Lease:      redisdb.NewLeaseRepository(client, AppConfig.DbAttempts),
+		}, redisdb.NewInvalidator(client, AppConfig.DbAttempts), nil
+	case config.DbMemory:
+		store, err := memdb.NewStore(AppConfig.DbFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &Storage{
+			Database:   memdb.NewCurrModelRepository(store),
+			Policy:     memdb.NewPolicyRateRepository(store),
+			Drift:      memdb.NewDriftRepository(store),
+			Quarantine: memdb.NewQuarantineRepository(store),
+			Override:   memdb.NewOverrideRepository(store),
+			Audit:      memdb.NewAuditRepository(store),
+			Proposal:   memdb.NewProposalRepository(store),
+			Lease:      memdb.NewLeaseRepository(store),
+		}, nil, nil
+	case config.DbSQLite:
+		if AppConfig.DbFile == "" {
+			return nil, nil, errors.New("sqlite db backend needs DB_FILE")
+		}
+		db, err := sqlitedb.Open(ctx, AppConfig.DbFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &Storage{
+			Database:   sqlitedb.NewCurrModelRepository(db),
+			Policy:     sqlitedb.NewPolicyRateRepository(db),
+			Drift:      sqlitedb.NewDriftRepository(db),
+			Quarantine: sqlitedb.NewQuarantineRepository(db),
+			Override:   sqlitedb.NewOverrideRepository(db),
+			Audit:      sqlitedb.NewAuditRepository(db),
+			Proposal:   sqlitedb.NewProposalRepository(db),
+			Lease:      sqlitedb.NewLeaseRepository(db),
+		}, nil, nil
+	}
+	return nil, nil, errors.New("wrong db backend " + AppConfig.DbBackend + ". use redis, memory or sqlite")
+}
@@ -0,0 +1,275 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"main/config"
+	"main/internal/pkg/domain"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// Хранилища всех бд. Каждое хранилище должно вести себя одинаково
+var backends = map[string]func(t *testing.T) *config.AppConfig{
+	config.DbRedis: func(t *testing.T) *config.AppConfig {
+		return &config.AppConfig{DbBackend: config.DbRedis, DbUrl: "redis://" + miniredis.RunT(t).Addr(), DbAttempts: 1}
+	},
+	config.DbMemory: func(t *testing.T) *config.AppConfig {
+		return &config.AppConfig{DbBackend: config.DbMemory}
+	},
+	config.DbSQLite: func(t *testing.T) *config.AppConfig {
+		return &config.AppConfig{DbBackend: config.DbSQLite, DbFile: filepath.Join(t.TempDir(), "currency.db")}
+	},
+}
+
+// Проверки, которые проходят все хранилища
+var conformance = map[string]func(t *testing.T, ctx context.Context, s *Storage){
+	"StoreAndGet":         testStoreAndGet,
+	"NotFound":            testNotFound,
+	"Snapshots":           testSnapshots,
+	"AddSnapshotInactive": testAddSnapshot,
+	"ActivateMissing":     testActivateMissing,
+	"PruneKeepsActive":    testPrune,
+	"NamePerSnapshot":     testNamePerSnapshot,
+	"Overrides":           testOverrides,
+	"ResolveOnlyPending":  testResolveProposal,
+	"AuditNewestFirst":    testAudit,
+	"StaleFenceRejected":  testFence,
+}
+
+func TestConformance(t *testing.T) {
+	for backend, cfg := range backends {
+		for name, check := range conformance {
+			t.Run(backend+"/"+name, func(t *testing.T) {
+				ctx := context.Background()
+				s, err := NewStorage(ctx, cfg(t))
+				if err != nil {
+					t.Fatalf("cannot open storage: %v", err)
+				}
+				t.Cleanup(func() { s.Database.Close(ctx) })
+				check(t, ctx, s)
+			})
+		}
+	}
+}
+
+func snapshot(source string, n int) domain.Snapshot {
+	return domain.Snapshot{ID: fmt.Sprintf("%s-%d", source, n), Source: source, Origin: domain.SnapshotFetch,
+		Created: time.Date(2024, 1, 1, 0, n, 0, 0, time.UTC).Format(time.RFC3339), Date: "2024-01-01"}
+}
+
+func rates(source string, buy string, codes ...string) []domain.CurrModel {
+	res := make([]domain.CurrModel, 0, len(codes))
+	for _, code := range codes {
+		res = append(res, domain.ToCurrModel("2024-01-01", source, code, "name "+code, buy, buy))
+	}
+	return res
+}
+
+func store(t *testing.T, ctx context.Context, s *Storage, snap domain.Snapshot, rates []domain.CurrModel) {
+	t.Helper()
+	if err := s.Database.StoreSnapshot(ctx, snap, rates); err != nil {
+		t.Fatalf("StoreSnapshot %s: %v", snap.ID, err)
+	}
+}
+
+func testStoreAndGet(t *testing.T, ctx context.Context, s *Storage) {
+	store(t, ctx, s, snapshot("RU", 1), rates("RU", "90", "USD", "EUR"))
+	curr, err := s.Database.GetBySourceAndKey(ctx, "RU", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curr.Code != "USD" || curr.Name != "name USD" || curr.RatioBuy != "90" || curr.Source != "RU" || curr.Snapshot != "RU-1" {
+		t.Fatalf("unexpected currency %+v", curr)
+	}
+	all, err := s.Database.GetAllBySource(ctx, "RU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].Code != "EUR" || all[1].Code != "USD" {
+		t.Fatalf("expected EUR and USD sorted by code, got %+v", all)
+	}
+}
+
+func testNotFound(t *testing.T, ctx context.Context, s *Storage) {
+	if _, err := s.Database.GetBySourceAndKey(ctx, "RU", "USD"); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected not found without snapshots, got %v", err)
+	}
+	store(t, ctx, s, snapshot("RU", 1), rates("RU", "90", "USD"))
+	if _, err := s.Database.GetBySourceAndKey(ctx, "RU", "GBP"); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected not found for missing currency, got %v", err)
+	}
+	all, err := s.Database.GetAllBySource(ctx, "TH")
+	if err != nil || len(all) != 0 {
+		t.Fatalf("expected no rates of unknown source, got %v %v", all, err)
+	}
+	snapRates, err := s.Database.GetSnapshotRates(ctx, "RU", "RU-9")
+	if err != nil || len(snapRates) != 0 {
+		t.Fatalf("expected no rates of missing snapshot, got %v %v", snapRates, err)
+	}
+}
+
+func testSnapshots(t *testing.T, ctx context.Context, s *Storage) {
+	store(t, ctx, s, snapshot("RU", 1), rates("RU", "90", "USD"))
+	store(t, ctx, s, snapshot("RU", 2), rates("RU", "91", "USD", "EUR"))
+	snaps, err := s.Database.GetSnapshots(ctx, "RU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 || snaps[0].ID != "RU-2" || !snaps[0].Active || snaps[1].Active || snaps[0].Count != 2 {
+		t.Fatalf("expected RU-2 active and newest, got %+v", snaps)
+	}
+	if err := s.Database.ActivateSnapshot(ctx, "RU", "RU-1"); err != nil {
+		t.Fatal(err)
+	}
+	curr, err := s.Database.GetBySourceAndKey(ctx, "RU", "USD")
+	if err != nil || curr.RatioBuy != "90" || curr.Snapshot != "RU-1" {
+		t.Fatalf("expected rate of RU-1 after activation, got %+v %v", curr, err)
+	}
+	old, err := s.Database.GetSnapshotRates(ctx, "RU", "RU-2")
+	if err != nil || len(old) != 2 {
+		t.Fatalf("expected rates of inactive RU-2, got %+v %v", old, err)
+	}
+}
+
+func testAddSnapshot(t *testing.T, ctx context.Context, s *Storage) {
+	store(t, ctx, s, snapshot("RU", 1), rates("RU", "90", "USD"))
+	if err := s.Database.AddSnapshot(ctx, snapshot("RU", 2), rates("RU", "91", "USD")); err != nil {
+		t.Fatal(err)
+	}
+	curr, err := s.Database.GetBySourceAndKey(ctx, "RU", "USD")
+	if err != nil || curr.Snapshot != "RU-1" {
+		t.Fatalf("expected RU-1 to stay active, got %+v %v", curr, err)
+	}
+	snaps, err := s.Database.GetSnapshots(ctx, "RU")
+	if err != nil || len(snaps) != 2 {
+		t.Fatalf("expected two snapshots, got %+v %v", snaps, err)
+	}
+}
+
+func testActivateMissing(t *testing.T, ctx context.Context, s *Storage) {
+	store(t, ctx, s, snapshot("RU", 1), rates("RU", "90", "USD"))
+	if err := s.Database.ActivateSnapshot(ctx, "RU", "RU-9"); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	curr, err := s.Database.GetBySourceAndKey(ctx, "RU", "USD")
+	if err != nil || curr.Snapshot != "RU-1" {
+		t.Fatalf("expected RU-1 to stay active, got %+v %v", curr, err)
+	}
+}
+
+func testPrune(t *testing.T, ctx context.Context, s *Storage) {
+	for n := 1; n <= 4; n++ {
+		store(t, ctx, s, snapshot("RU", n), rates("RU", "90", "USD"))
+	}
+	if err := s.Database.ActivateSnapshot(ctx, "RU", "RU-1"); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := s.Database.PruneSnapshots(ctx, "RU", 2)
+	if err != nil || len(removed) != 1 || removed[0] != "RU-2" {
+		t.Fatalf("expected RU-2 removed, got %v %v", removed, err)
+	}
+	snaps, err := s.Database.GetSnapshots(ctx, "RU")
+	if err != nil || len(snaps) != 3 || snaps[2].ID != "RU-1" || !snaps[2].Active {
+		t.Fatalf("expected RU-4, RU-3 and active RU-1, got %+v %v", snaps, err)
+	}
+	if old, err := s.Database.GetSnapshotRates(ctx, "RU", "RU-2"); err != nil || len(old) != 0 {
+		t.Fatalf("expected rates of RU-2 removed, got %+v %v", old, err)
+	}
+}
+
+func testNamePerSnapshot(t *testing.T, ctx context.Context, s *Storage) {
+	first := rates("RU", "90", "USD")
+	store(t, ctx, s, snapshot("RU", 1), first)
+	second := rates("RU", "91", "USD")
+	second[0].Name = "renamed"
+	store(t, ctx, s, snapshot("RU", 2), second)
+	old, err := s.Database.GetSnapshotRates(ctx, "RU", "RU-1")
+	if err != nil || len(old) != 1 || old[0].Name != "name USD" {
+		t.Fatalf("expected name of RU-1 unchanged, got %+v %v", old, err)
+	}
+}
+
+func testOverrides(t *testing.T, ctx context.Context, s *Storage) {
+	o := domain.RateOverride{Source: "RU", Code: "USD", RatioBuy: "100", RatioSell: "101", Reason: "test", Author: "alice",
+		Created: "2024-01-01T00:00:00Z"}
+	if err := s.Override.StoreOverride(ctx, o); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Override.GetOverride(ctx, "RU", "USD")
+	if err != nil || got != o {
+		t.Fatalf("expected %+v, got %+v %v", o, got, err)
+	}
+	if none, err := s.Override.GetOverride(ctx, "RU", "EUR"); err != nil || none.Code != "" {
+		t.Fatalf("expected empty override, got %+v %v", none, err)
+	}
+	all, err := s.Override.GetOverrides(ctx, "RU")
+	if err != nil || len(all) != 1 {
+		t.Fatalf("expected one override, got %+v %v", all, err)
+	}
+	if err := s.Override.DeleteOverride(ctx, "RU", "USD"); err != nil {
+		t.Fatal(err)
+	}
+	if all, err = s.Override.GetOverrides(ctx, "RU"); err != nil || len(all) != 0 {
+		t.Fatalf("expected no overrides after delete, got %+v %v", all, err)
+	}
+}
+
+func testResolveProposal(t *testing.T, ctx context.Context, s *Storage) {
+	p := domain.Proposal{ID: "P-1", Kind: domain.ProposalOverrideDelete, Source: "RU", Code: "USD", ProposedBy: "alice",
+		Created: "2024-01-01T00:00:00Z", Status: domain.ProposalPending}
+	if err := s.Proposal.StoreProposal(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	p.Status, p.ResolvedBy = domain.ProposalApproved, "bob"
+	if ok, err := s.Proposal.ResolveProposal(ctx, p); err != nil || !ok {
+		t.Fatalf("expected pending proposal resolved, got %v %v", ok, err)
+	}
+	p.Status, p.ResolvedBy = domain.ProposalRejected, "carol"
+	if ok, err := s.Proposal.ResolveProposal(ctx, p); err != nil || ok {
+		t.Fatalf("expected resolved proposal kept, got %v %v", ok, err)
+	}
+	got, err := s.Proposal.GetProposal(ctx, "P-1")
+	if err != nil || got.Status != domain.ProposalApproved || got.ResolvedBy != "bob" {
+		t.Fatalf("expected proposal approved by bob, got %+v %v", got, err)
+	}
+	if ok, err := s.Proposal.ResolveProposal(ctx, domain.Proposal{ID: "P-9", Status: domain.ProposalApproved}); err != nil || ok {
+		t.Fatalf("expected missing proposal not resolved, got %v %v", ok, err)
+	}
+}
+
+func testAudit(t *testing.T, ctx context.Context, s *Storage) {
+	for _, action := range []string{"override_set", "override_delete", "snapshot_rollback"} {
+		err := s.Audit.AppendAudit(ctx, domain.AuditEntry{Time: "2024-01-01T00:00:00Z", Actor: "alice", Action: action, Source: "RU"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := s.Audit.GetAudit(ctx, 2)
+	if err != nil || len(entries) != 2 || entries[0].Action != "snapshot_rollback" || entries[1].Action != "override_delete" {
+		t.Fatalf("expected two newest entries, got %+v %v", entries, err)
+	}
+}
+
+func testFence(t *testing.T, ctx context.Context, s *Storage) {
+	snap := snapshot("RU", 1)
+	snap.Fence = 2
+	store(t, ctx, s, snap, rates("RU", "90", "USD"))
+	stale := snapshot("RU", 2)
+	stale.Fence = 1
+	if err := s.Database.StoreSnapshot(ctx, stale, rates("RU", "91", "USD")); !errors.Is(err, domain.ErrNotLeader) {
+		t.Fatalf("expected stale token rejected, got %v", err)
+	}
+	curr, err := s.Database.GetBySourceAndKey(ctx, "RU", "USD")
+	if err != nil || curr.Snapshot != "RU-1" {
+		t.Fatalf("expected RU-1 to stay active, got %+v %v", curr, err)
+	}
+	newer := snapshot("RU", 3)
+	newer.Fence = 3
+	store(t, ctx, s, newer, rates("RU", "92", "USD"))
+	store(t, ctx, s, snapshot("TH", 1), rates("TH", "30", "USD"))
+}